@@ -22,15 +22,15 @@ type AccessGroup struct {
 
 	// The include group works like an OR logical operator. The user must
 	// satisfy one of the rules.
-	Include []interface{} `json:"include"`
+	Include AccessPolicyRules `json:"include"`
 
 	// The exclude group works like a NOT logical operator. The user must
 	// not satisfy all of the rules in exclude.
-	Exclude []interface{} `json:"exclude"`
+	Exclude AccessPolicyRules `json:"exclude"`
 
 	// The require group works like a AND logical operator. The user must
 	// satisfy all of the rules in require.
-	Require []interface{} `json:"require"`
+	Require AccessPolicyRules `json:"require"`
 }
 
 // AccessGroupEmail is used for managing access based on the email.
@@ -19,7 +19,9 @@ type AccessIdentityProvider struct {
 
 // AccessIdentityProviderConfiguration is the combined structure of *all*
 // identity provider configuration fields. This is done to simplify the use of
-// Access products and their relationship to each other.
+// Access products and their relationship to each other. See
+// NewAccessIdentityProvider for building it from the typed configuration of
+// a single provider.
 //
 // API reference: https://developers.cloudflare.com/access/configuring-identity-providers/
 type AccessIdentityProviderConfiguration struct {
@@ -0,0 +1,528 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Access identity provider types.
+const (
+	AccessIdentityProviderTypeAzureAD    = "azureAD"
+	AccessIdentityProviderTypeCentrify   = "centrify"
+	AccessIdentityProviderTypeFacebook   = "facebook"
+	AccessIdentityProviderTypeGitHub     = "github"
+	AccessIdentityProviderTypeGoogle     = "google"
+	AccessIdentityProviderTypeGoogleApps = "google-apps"
+	AccessIdentityProviderTypeLinkedIn   = "linkedin"
+	AccessIdentityProviderTypeOIDC       = "oidc"
+	AccessIdentityProviderTypeOkta       = "okta"
+	AccessIdentityProviderTypeOneLogin   = "onelogin"
+	AccessIdentityProviderTypeOneTimePin = "onetimepin"
+	AccessIdentityProviderTypeSAML       = "saml"
+	AccessIdentityProviderTypeYandex     = "yandex"
+)
+
+// ErrAccessIdentityProviderCheckUnsupported is returned by
+// CheckAccessIdentityProvider for identity providers which cannot be checked.
+var ErrAccessIdentityProviderCheckUnsupported = errors.New("connection checks are not supported for this identity provider")
+
+// AccessIdentityProviderConfig is the configuration of a single type of
+// identity provider. It is implemented by the AccessIdentityProvider*Config
+// types, which only hold the fields their provider supports. Their
+// RedirectURL is the callback URL to register with the provider; it is set
+// by the API and ignored when an identity provider is created.
+type AccessIdentityProviderConfig interface {
+	// IdentityProviderType returns the type of the identity provider.
+	IdentityProviderType() string
+	// Validate checks the required fields are set.
+	Validate() error
+	// Configuration converts the configuration to the combined structure
+	// sent to the API.
+	Configuration() AccessIdentityProviderConfiguration
+}
+
+// AccessIdentityProviderAzureADConfig configures Azure AD.
+type AccessIdentityProviderAzureADConfig struct {
+	ClientID      string
+	ClientSecret  string
+	DirectoryID   string
+	SupportGroups bool
+	RedirectURL   string
+}
+
+// AccessIdentityProviderCentrifyConfig configures Centrify.
+type AccessIdentityProviderCentrifyConfig struct {
+	ClientID        string
+	ClientSecret    string
+	CentrifyAccount string
+	CentrifyAppID   string
+	RedirectURL     string
+}
+
+// AccessIdentityProviderGoogleAppsConfig configures Google Workspace.
+type AccessIdentityProviderGoogleAppsConfig struct {
+	ClientID     string
+	ClientSecret string
+	AppsDomain   string
+	RedirectURL  string
+}
+
+// AccessIdentityProviderOAuthConfig configures the identity providers which
+// only need OAuth client credentials: Facebook, GitHub, Google, LinkedIn and
+// Yandex.
+type AccessIdentityProviderOAuthConfig struct {
+	Type         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// AccessIdentityProviderOIDCConfig configures a generic OpenID Connect
+// provider.
+type AccessIdentityProviderOIDCConfig struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	CertsURL     string
+	RedirectURL  string
+}
+
+// AccessIdentityProviderOktaConfig configures Okta.
+type AccessIdentityProviderOktaConfig struct {
+	ClientID     string
+	ClientSecret string
+	OktaAccount  string
+	APIToken     string
+	RedirectURL  string
+}
+
+// AccessIdentityProviderOneLoginConfig configures OneLogin.
+type AccessIdentityProviderOneLoginConfig struct {
+	ClientID        string
+	ClientSecret    string
+	OneloginAccount string
+	RedirectURL     string
+}
+
+// AccessIdentityProviderOneTimePinConfig configures one-time PIN login,
+// which has no settings.
+type AccessIdentityProviderOneTimePinConfig struct{}
+
+// AccessIdentityProviderSAMLConfig configures a generic SAML provider.
+type AccessIdentityProviderSAMLConfig struct {
+	IssuerURL          string
+	SsoTargetURL       string
+	IdpPublicCert      string
+	Attributes         []string
+	EmailAttributeName string
+	SignRequest        bool
+	RedirectURL        string
+}
+
+// NewAccessIdentityProvider validates a typed configuration and returns an
+// identity provider which can be created with CreateAccessIdentityProvider.
+func NewAccessIdentityProvider(name string, config AccessIdentityProviderConfig) (AccessIdentityProvider, error) {
+	if err := config.Validate(); err != nil {
+		return AccessIdentityProvider{}, err
+	}
+
+	return AccessIdentityProvider{
+		Name:   name,
+		Type:   config.IdentityProviderType(),
+		Config: config.Configuration(),
+	}, nil
+}
+
+// TypedConfig converts the combined configuration of an identity provider
+// to the typed configuration for its type. Settings belonging to other types
+// of identity provider have nowhere to go in the typed configuration and are
+// left out of it.
+func (p AccessIdentityProvider) TypedConfig() (AccessIdentityProviderConfig, error) {
+	c := p.Config
+	switch p.Type {
+	case AccessIdentityProviderTypeAzureAD:
+		return AccessIdentityProviderAzureADConfig{ClientID: c.ClientID, ClientSecret: c.ClientSecret, DirectoryID: c.DirectoryID, SupportGroups: c.SupportGroups, RedirectURL: c.RedirectURL}, nil
+	case AccessIdentityProviderTypeCentrify:
+		return AccessIdentityProviderCentrifyConfig{ClientID: c.ClientID, ClientSecret: c.ClientSecret, CentrifyAccount: c.CentrifyAccount, CentrifyAppID: c.CentrifyAppID, RedirectURL: c.RedirectURL}, nil
+	case AccessIdentityProviderTypeGoogleApps:
+		return AccessIdentityProviderGoogleAppsConfig{ClientID: c.ClientID, ClientSecret: c.ClientSecret, AppsDomain: c.AppsDomain, RedirectURL: c.RedirectURL}, nil
+	case AccessIdentityProviderTypeFacebook, AccessIdentityProviderTypeGitHub, AccessIdentityProviderTypeGoogle,
+		AccessIdentityProviderTypeLinkedIn, AccessIdentityProviderTypeYandex:
+		return AccessIdentityProviderOAuthConfig{Type: p.Type, ClientID: c.ClientID, ClientSecret: c.ClientSecret, RedirectURL: c.RedirectURL}, nil
+	case AccessIdentityProviderTypeOIDC:
+		return AccessIdentityProviderOIDCConfig{ClientID: c.ClientID, ClientSecret: c.ClientSecret, AuthURL: c.AuthURL, TokenURL: c.TokenURL, CertsURL: c.CertsURL, RedirectURL: c.RedirectURL}, nil
+	case AccessIdentityProviderTypeOkta:
+		return AccessIdentityProviderOktaConfig{ClientID: c.ClientID, ClientSecret: c.ClientSecret, OktaAccount: c.OktaAccount, APIToken: c.APIToken, RedirectURL: c.RedirectURL}, nil
+	case AccessIdentityProviderTypeOneLogin:
+		return AccessIdentityProviderOneLoginConfig{ClientID: c.ClientID, ClientSecret: c.ClientSecret, OneloginAccount: c.OneloginAccount, RedirectURL: c.RedirectURL}, nil
+	case AccessIdentityProviderTypeOneTimePin:
+		return AccessIdentityProviderOneTimePinConfig{}, nil
+	case AccessIdentityProviderTypeSAML:
+		return AccessIdentityProviderSAMLConfig{
+			IssuerURL:          c.IssuerURL,
+			SsoTargetURL:       c.SsoTargetURL,
+			IdpPublicCert:      c.IdpPublicCert,
+			Attributes:         c.Attributes,
+			EmailAttributeName: c.EmailAttributeName,
+			SignRequest:        c.SignRequest,
+			RedirectURL:        c.RedirectURL,
+		}, nil
+	}
+
+	return nil, errors.Errorf("unknown identity provider type %q", p.Type)
+}
+
+// ValidateAccessIdentityProvider checks that an identity provider has the
+// fields required by its type and no fields belonging to other types. Fields
+// the API sets on every identity provider, such as redirect_url, are always
+// accepted.
+func ValidateAccessIdentityProvider(p AccessIdentityProvider) error {
+	config, err := p.TypedConfig()
+	if err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	set, err := accessIdentityProviderConfigFields(p.Config)
+	if err != nil {
+		return err
+	}
+	supported, err := accessIdentityProviderConfigFields(config.Configuration())
+	if err != nil {
+		return err
+	}
+
+	var unsupported []string
+	for field := range set {
+		if !supported[field] && !accessIdentityProviderCommonFields[field] {
+			unsupported = append(unsupported, field)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return errors.Errorf("invalid %s identity provider: unsupported fields %s", p.Type, strings.Join(unsupported, ", "))
+	}
+
+	return nil
+}
+
+// accessIdentityProviderCommonFields are the configuration fields which may be
+// returned for any type of identity provider.
+var accessIdentityProviderCommonFields = map[string]bool{
+	"redirect_url": true,
+}
+
+// accessIdentityProviderConfigFields returns the JSON names of the fields
+// set in a configuration.
+func accessIdentityProviderConfigFields(c AccessIdentityProviderConfiguration) (map[string]bool, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(fields))
+	for field := range fields {
+		set[field] = true
+	}
+	return set, nil
+}
+
+// accessIdentityProviderRequired returns an error naming the fields which
+// are empty, given as name and value pairs.
+func accessIdentityProviderRequired(providerType string, fields ...string) error {
+	var missing []string
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			missing = append(missing, fields[i])
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("invalid %s identity provider: missing %s", providerType, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderAzureADConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeAzureAD
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderAzureADConfig) Validate() error {
+	return accessIdentityProviderRequired(c.IdentityProviderType(),
+		"client_id", c.ClientID, "client_secret", c.ClientSecret, "directory_id", c.DirectoryID)
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderAzureADConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{ClientID: c.ClientID, ClientSecret: c.ClientSecret, DirectoryID: c.DirectoryID, SupportGroups: c.SupportGroups, RedirectURL: c.RedirectURL}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderCentrifyConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeCentrify
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderCentrifyConfig) Validate() error {
+	return accessIdentityProviderRequired(c.IdentityProviderType(),
+		"client_id", c.ClientID, "client_secret", c.ClientSecret,
+		"centrify_account", c.CentrifyAccount, "centrify_app_id", c.CentrifyAppID)
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderCentrifyConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{ClientID: c.ClientID, ClientSecret: c.ClientSecret, CentrifyAccount: c.CentrifyAccount, CentrifyAppID: c.CentrifyAppID, RedirectURL: c.RedirectURL}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderGoogleAppsConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeGoogleApps
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderGoogleAppsConfig) Validate() error {
+	return accessIdentityProviderRequired(c.IdentityProviderType(),
+		"client_id", c.ClientID, "client_secret", c.ClientSecret, "apps_domain", c.AppsDomain)
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderGoogleAppsConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{ClientID: c.ClientID, ClientSecret: c.ClientSecret, AppsDomain: c.AppsDomain, RedirectURL: c.RedirectURL}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOAuthConfig) IdentityProviderType() string {
+	return c.Type
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOAuthConfig) Validate() error {
+	switch c.Type {
+	case AccessIdentityProviderTypeFacebook, AccessIdentityProviderTypeGitHub, AccessIdentityProviderTypeGoogle,
+		AccessIdentityProviderTypeLinkedIn, AccessIdentityProviderTypeYandex:
+	default:
+		return errors.Errorf("invalid identity provider: %q is not an OAuth identity provider type", c.Type)
+	}
+
+	return accessIdentityProviderRequired(c.Type, "client_id", c.ClientID, "client_secret", c.ClientSecret)
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOAuthConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{ClientID: c.ClientID, ClientSecret: c.ClientSecret, RedirectURL: c.RedirectURL}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOIDCConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeOIDC
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOIDCConfig) Validate() error {
+	if err := accessIdentityProviderRequired(c.IdentityProviderType(),
+		"client_id", c.ClientID, "client_secret", c.ClientSecret,
+		"auth_url", c.AuthURL, "token_url", c.TokenURL, "certs_url", c.CertsURL); err != nil {
+		return err
+	}
+
+	for _, u := range []string{c.AuthURL, c.TokenURL, c.CertsURL} {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" {
+			return errors.Errorf("invalid oidc identity provider: %q is not an https URL", u)
+		}
+	}
+
+	return nil
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOIDCConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{ClientID: c.ClientID, ClientSecret: c.ClientSecret, AuthURL: c.AuthURL, TokenURL: c.TokenURL, CertsURL: c.CertsURL, RedirectURL: c.RedirectURL}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOktaConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeOkta
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOktaConfig) Validate() error {
+	return accessIdentityProviderRequired(c.IdentityProviderType(),
+		"client_id", c.ClientID, "client_secret", c.ClientSecret, "okta_account", c.OktaAccount)
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOktaConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{ClientID: c.ClientID, ClientSecret: c.ClientSecret, OktaAccount: c.OktaAccount, APIToken: c.APIToken, RedirectURL: c.RedirectURL}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOneLoginConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeOneLogin
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOneLoginConfig) Validate() error {
+	return accessIdentityProviderRequired(c.IdentityProviderType(),
+		"client_id", c.ClientID, "client_secret", c.ClientSecret, "onelogin_account", c.OneloginAccount)
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOneLoginConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{ClientID: c.ClientID, ClientSecret: c.ClientSecret, OneloginAccount: c.OneloginAccount, RedirectURL: c.RedirectURL}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOneTimePinConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeOneTimePin
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOneTimePinConfig) Validate() error {
+	return nil
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderOneTimePinConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{}
+}
+
+// IdentityProviderType implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderSAMLConfig) IdentityProviderType() string {
+	return AccessIdentityProviderTypeSAML
+}
+
+// Validate implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderSAMLConfig) Validate() error {
+	if err := accessIdentityProviderRequired(c.IdentityProviderType(),
+		"issuer_url", c.IssuerURL, "sso_target_url", c.SsoTargetURL, "idp_public_cert", c.IdpPublicCert); err != nil {
+		return err
+	}
+
+	if _, err := parseAccessIdentityProviderCertificate(c.IdpPublicCert); err != nil {
+		return errors.Wrap(err, "invalid saml identity provider")
+	}
+
+	return nil
+}
+
+// Configuration implements AccessIdentityProviderConfig.
+func (c AccessIdentityProviderSAMLConfig) Configuration() AccessIdentityProviderConfiguration {
+	return AccessIdentityProviderConfiguration{
+		IssuerURL:          c.IssuerURL,
+		SsoTargetURL:       c.SsoTargetURL,
+		IdpPublicCert:      c.IdpPublicCert,
+		Attributes:         c.Attributes,
+		EmailAttributeName: c.EmailAttributeName,
+		SignRequest:        c.SignRequest,
+		RedirectURL:        c.RedirectURL,
+	}
+}
+
+// parseAccessIdentityProviderCertificate parses an IdP certificate, which
+// the dashboard accepts both with and without the PEM armour.
+func parseAccessIdentityProviderCertificate(cert string) (*x509.Certificate, error) {
+	cert = strings.TrimSpace(cert)
+	if !strings.HasPrefix(cert, "-----BEGIN") {
+		cert = "-----BEGIN CERTIFICATE-----\n" + cert + "\n-----END CERTIFICATE-----"
+	}
+
+	block, _ := pem.Decode([]byte(cert))
+	if block == nil {
+		return nil, errors.New("idp_public_cert is not a PEM encoded certificate")
+	}
+
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "idp_public_cert could not be parsed")
+	}
+	return parsed, nil
+}
+
+// CheckAccessIdentityProvider tests that an identity provider is reachable
+// with its configuration. The API offers no way to test a login, so this
+// fetches the provider's OpenID Connect discovery document or signing keys
+// and, for SAML, checks the IdP certificate has not expired. Providers
+// without a checkable endpoint return
+// ErrAccessIdentityProviderCheckUnsupported.
+func CheckAccessIdentityProvider(ctx context.Context, client *http.Client, config AccessIdentityProviderConfig) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	var endpoint string
+	switch c := config.(type) {
+	case AccessIdentityProviderAzureADConfig:
+		endpoint = fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0/.well-known/openid-configuration", url.PathEscape(c.DirectoryID))
+	case AccessIdentityProviderOktaConfig:
+		endpoint = accessIdentityProviderAccountURL(c.OktaAccount) + "/.well-known/openid-configuration"
+	case AccessIdentityProviderOneLoginConfig:
+		endpoint = accessIdentityProviderAccountURL(c.OneloginAccount) + "/oidc/2/.well-known/openid-configuration"
+	case AccessIdentityProviderOIDCConfig:
+		endpoint = c.CertsURL
+	case AccessIdentityProviderSAMLConfig:
+		cert, err := parseAccessIdentityProviderCertificate(c.IdpPublicCert)
+		if err != nil {
+			return err
+		}
+		if time.Now().After(cert.NotAfter) {
+			return errors.Errorf("idp_public_cert expired on %s", cert.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	default:
+		return ErrAccessIdentityProviderCheckUnsupported
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s identity provider is not reachable", config.IdentityProviderType())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s identity provider returned HTTP status %d from %s", config.IdentityProviderType(), resp.StatusCode, endpoint)
+	}
+
+	var document map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return errors.Wrapf(err, "%s identity provider returned an invalid response from %s", config.IdentityProviderType(), endpoint)
+	}
+
+	return nil
+}
+
+// accessIdentityProviderAccountURL returns the base URL of an Okta or
+// OneLogin account, which may be configured with or without a scheme.
+func accessIdentityProviderAccountURL(account string) string {
+	account = strings.TrimSuffix(account, "/")
+	if strings.Contains(account, "://") {
+		return account
+	}
+	return "https://" + account
+}
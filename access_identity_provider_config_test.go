@@ -0,0 +1,184 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAccessIdentityProvider(t *testing.T) {
+	p, err := NewAccessIdentityProvider("Okta", AccessIdentityProviderOktaConfig{
+		ClientID:     "example_id",
+		ClientSecret: "a-secret-key",
+		OktaAccount:  "https://example.okta.com",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, AccessIdentityProvider{
+			Name: "Okta",
+			Type: "okta",
+			Config: AccessIdentityProviderConfiguration{
+				ClientID:     "example_id",
+				ClientSecret: "a-secret-key",
+				OktaAccount:  "https://example.okta.com",
+			},
+		}, p)
+
+		config, err := p.TypedConfig()
+		if assert.NoError(t, err) {
+			assert.Equal(t, AccessIdentityProviderOktaConfig{
+				ClientID:     "example_id",
+				ClientSecret: "a-secret-key",
+				OktaAccount:  "https://example.okta.com",
+			}, config)
+		}
+	}
+
+	_, err = NewAccessIdentityProvider("Azure", AccessIdentityProviderAzureADConfig{ClientID: "example_id"})
+	assert.EqualError(t, err, "invalid azureAD identity provider: missing client_secret, directory_id")
+
+	_, err = NewAccessIdentityProvider("GitLab", AccessIdentityProviderOAuthConfig{Type: "gitlab", ClientID: "id", ClientSecret: "secret"})
+	assert.EqualError(t, err, `invalid identity provider: "gitlab" is not an OAuth identity provider type`)
+
+	_, err = NewAccessIdentityProvider("OIDC", AccessIdentityProviderOIDCConfig{
+		ClientID: "id", ClientSecret: "secret",
+		AuthURL: "https://example.com/auth", TokenURL: "http://example.com/token", CertsURL: "https://example.com/certs",
+	})
+	assert.EqualError(t, err, `invalid oidc identity provider: "http://example.com/token" is not an https URL`)
+
+	_, err = NewAccessIdentityProvider("SAML", AccessIdentityProviderSAMLConfig{IssuerURL: "https://example.com", SsoTargetURL: "https://example.com/sso", IdpPublicCert: "bm90IGEgY2VydA=="})
+	assert.Error(t, err)
+
+	p, err = NewAccessIdentityProvider("GitHub", AccessIdentityProviderOAuthConfig{Type: "github", ClientID: "id", ClientSecret: "secret"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "github", p.Type)
+	}
+}
+
+func TestValidateAccessIdentityProvider(t *testing.T) {
+	assert.NoError(t, ValidateAccessIdentityProvider(AccessIdentityProvider{
+		Type:   "google-apps",
+		Config: AccessIdentityProviderConfiguration{ClientID: "id", ClientSecret: "secret", AppsDomain: "example.com"},
+	}))
+
+	assert.EqualError(t, ValidateAccessIdentityProvider(AccessIdentityProvider{
+		Type:   "okta",
+		Config: AccessIdentityProviderConfiguration{ClientID: "id", ClientSecret: "secret", OktaAccount: "example.okta.com", DirectoryID: "dir", SupportGroups: true},
+	}), "invalid okta identity provider: unsupported fields directory_id, support_groups")
+
+	okta := AccessIdentityProvider{
+		Type: "okta",
+		Config: AccessIdentityProviderConfiguration{
+			ClientID:     "id",
+			ClientSecret: "secret",
+			OktaAccount:  "example.okta.com",
+			APIToken:     "token",
+			RedirectURL:  "https://example.cloudflareaccess.com/cdn-cgi/access/callback",
+		},
+	}
+	assert.NoError(t, ValidateAccessIdentityProvider(okta))
+	config, err := okta.TypedConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, okta.Config, config.Configuration())
+	}
+
+	saml := AccessIdentityProvider{
+		Type: "saml",
+		Config: AccessIdentityProviderConfiguration{
+			IssuerURL:          "https://idp.example.com",
+			SsoTargetURL:       "https://idp.example.com/sso",
+			IdpPublicCert:      testAccessIdentityProviderCertificate(t, time.Now().Add(24*time.Hour)),
+			Attributes:         []string{"groups"},
+			EmailAttributeName: "email",
+			SignRequest:        true,
+			RedirectURL:        "https://example.cloudflareaccess.com/cdn-cgi/access/callback",
+		},
+	}
+	assert.NoError(t, ValidateAccessIdentityProvider(saml))
+	config, err = saml.TypedConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, saml.Config, config.Configuration())
+	}
+
+	assert.NoError(t, ValidateAccessIdentityProvider(AccessIdentityProvider{
+		Type:   "onetimepin",
+		Config: AccessIdentityProviderConfiguration{RedirectURL: "https://example.cloudflareaccess.com/cdn-cgi/access/callback"},
+	}))
+
+	assert.EqualError(t, ValidateAccessIdentityProvider(AccessIdentityProvider{Type: "centrify"}),
+		"invalid centrify identity provider: missing client_id, client_secret, centrify_account, centrify_app_id")
+
+	assert.EqualError(t, ValidateAccessIdentityProvider(AccessIdentityProvider{Type: "ldap"}), `unknown identity provider type "ldap"`)
+	assert.NoError(t, ValidateAccessIdentityProvider(AccessIdentityProvider{Type: "onetimepin"}))
+}
+
+func testAccessIdentityProviderCertificate(t *testing.T, notAfter time.Time) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestCheckAccessIdentityProvider(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration", "/certs":
+			w.Header().Set("content-type", "application/json")
+			fmt.Fprint(w, `{"issuer": "https://example.okta.com", "keys": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	assert.NoError(t, CheckAccessIdentityProvider(ctx, server.Client(), AccessIdentityProviderOktaConfig{
+		ClientID: "id", ClientSecret: "secret", OktaAccount: server.URL,
+	}))
+
+	assert.NoError(t, CheckAccessIdentityProvider(ctx, server.Client(), AccessIdentityProviderOIDCConfig{
+		ClientID: "id", ClientSecret: "secret",
+		AuthURL: server.URL + "/auth", TokenURL: server.URL + "/token", CertsURL: server.URL + "/certs",
+	}))
+
+	err := CheckAccessIdentityProvider(ctx, server.Client(), AccessIdentityProviderOneLoginConfig{
+		ClientID: "id", ClientSecret: "secret", OneloginAccount: server.URL,
+	})
+	assert.EqualError(t, err, fmt.Sprintf("onelogin identity provider returned HTTP status 404 from %s/oidc/2/.well-known/openid-configuration", server.URL))
+
+	assert.Equal(t, ErrAccessIdentityProviderCheckUnsupported, CheckAccessIdentityProvider(ctx, nil, AccessIdentityProviderOAuthConfig{
+		Type: "github", ClientID: "id", ClientSecret: "secret",
+	}))
+
+	saml := AccessIdentityProviderSAMLConfig{
+		IssuerURL:     "https://idp.example.com",
+		SsoTargetURL:  "https://idp.example.com/sso",
+		IdpPublicCert: testAccessIdentityProviderCertificate(t, time.Now().Add(24*time.Hour)),
+	}
+	assert.NoError(t, CheckAccessIdentityProvider(ctx, nil, saml))
+
+	expiry := time.Now().Add(-24 * time.Hour).UTC().Truncate(time.Second)
+	saml.IdpPublicCert = testAccessIdentityProviderCertificate(t, expiry)
+	assert.EqualError(t, CheckAccessIdentityProvider(ctx, nil, saml), "idp_public_cert expired on "+expiry.Format(time.RFC3339))
+}
@@ -0,0 +1,440 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// AccessJWTHeader is the request header Cloudflare Access uses to pass
+	// the application token to the origin.
+	AccessJWTHeader = "Cf-Access-Jwt-Assertion"
+	// AccessJWTCookie is the cookie holding the application token in
+	// browser based requests.
+	AccessJWTCookie = "CF_Authorization"
+
+	accessJWTCertsPath = "/cdn-cgi/access/certs"
+
+	// accessJWTMinKeyCache is the lower bound of the key cache TTL and of
+	// the minimum time between refreshes, so tokens with unknown keys
+	// cannot make the verifier hammer the certs endpoint.
+	accessJWTMinKeyCache = time.Second
+)
+
+// AccessIdentityClaims are the claims of a token issued by Cloudflare Access.
+// Email is empty for tokens issued to service tokens, which set CommonName to
+// the service token client ID instead.
+type AccessIdentityClaims struct {
+	Audience      AccessJWTAudience `json:"aud"`
+	Email         string            `json:"email,omitempty"`
+	ExpiresAt     int64             `json:"exp"`
+	IssuedAt      int64             `json:"iat,omitempty"`
+	NotBefore     int64             `json:"nbf,omitempty"`
+	Issuer        string            `json:"iss"`
+	Subject       string            `json:"sub"`
+	Type          string            `json:"type,omitempty"`
+	IdentityNonce string            `json:"identity_nonce,omitempty"`
+	Country       string            `json:"country,omitempty"`
+	CommonName    string            `json:"common_name,omitempty"`
+	Custom        json.RawMessage   `json:"custom,omitempty"`
+}
+
+// AccessJWTAudience is the audience of a token, which may be encoded as a
+// single string or a list of strings.
+type AccessJWTAudience []string
+
+// UnmarshalJSON accepts both a string and a list of strings.
+func (a *AccessJWTAudience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = AccessJWTAudience{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	*a = l
+	return nil
+}
+
+// AccessJWTVerifier verifies tokens issued by Cloudflare Access for a team.
+// Signing keys are fetched from the team's certs endpoint and cached; a
+// token signed by an unknown key triggers a refresh so rotated keys are
+// picked up without a restart.
+type AccessJWTVerifier struct {
+	issuer     string
+	audiences  []string
+	certsURL   string
+	httpClient *http.Client
+	cacheTTL   time.Duration
+	minRefresh time.Duration
+	leeway     time.Duration
+	now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+	fetching    chan struct{}
+}
+
+// AccessJWTVerifierOption is a functional option for configuring an
+// AccessJWTVerifier.
+type AccessJWTVerifierOption func(*AccessJWTVerifier)
+
+// AccessJWTCertsURL overrides the URL signing keys are fetched from, which
+// defaults to the certs endpoint of the team domain.
+func AccessJWTCertsURL(url string) AccessJWTVerifierOption {
+	return func(v *AccessJWTVerifier) {
+		v.certsURL = url
+	}
+}
+
+// AccessJWTHTTPClient sets the HTTP client used to fetch signing keys.
+func AccessJWTHTTPClient(client *http.Client) AccessJWTVerifierOption {
+	return func(v *AccessJWTVerifier) {
+		v.httpClient = client
+	}
+}
+
+// AccessJWTKeyCache sets how long fetched keys are cached for and the
+// minimum time between refreshes caused by tokens with unknown keys. Both
+// are raised to at least one second.
+func AccessJWTKeyCache(ttl, minRefresh time.Duration) AccessJWTVerifierOption {
+	return func(v *AccessJWTVerifier) {
+		v.cacheTTL = ttl
+		if v.cacheTTL < accessJWTMinKeyCache {
+			v.cacheTTL = accessJWTMinKeyCache
+		}
+		v.minRefresh = minRefresh
+		if v.minRefresh < accessJWTMinKeyCache {
+			v.minRefresh = accessJWTMinKeyCache
+		}
+	}
+}
+
+// AccessJWTLeeway sets the allowed clock skew when checking token expiry.
+func AccessJWTLeeway(leeway time.Duration) AccessJWTVerifierOption {
+	return func(v *AccessJWTVerifier) {
+		v.leeway = leeway
+	}
+}
+
+// NewAccessJWTVerifier creates a verifier for tokens issued by the team
+// domain, such as example.cloudflareaccess.com, accepting tokens for any of
+// the given application audience tags.
+func NewAccessJWTVerifier(teamDomain string, audiences []string, opts ...AccessJWTVerifierOption) (*AccessJWTVerifier, error) {
+	teamDomain = strings.TrimSuffix(teamDomain, "/")
+	if teamDomain == "" {
+		return nil, errors.New("team domain must be provided")
+	}
+	if !strings.HasPrefix(teamDomain, "https://") && !strings.HasPrefix(teamDomain, "http://") {
+		teamDomain = "https://" + teamDomain
+	}
+
+	if len(audiences) == 0 {
+		return nil, errors.New("at least one audience must be provided")
+	}
+
+	v := &AccessJWTVerifier{
+		issuer:     teamDomain,
+		audiences:  audiences,
+		certsURL:   teamDomain + accessJWTCertsPath,
+		httpClient: http.DefaultClient,
+		cacheTTL:   time.Hour,
+		minRefresh: 10 * time.Second,
+		leeway:     time.Minute,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v, nil
+}
+
+// AccessJWTVerifier creates a verifier for tokens of an Access application,
+// using the auth domain of the account's Access organization and the
+// application's audience tag.
+//
+// API reference: https://developers.cloudflare.com/cloudflare-one/identity/authorization-cookie/validating-json
+func (api *API) AccessJWTVerifier(ctx context.Context, accountID, applicationID string, opts ...AccessJWTVerifierOption) (*AccessJWTVerifier, error) {
+	org, _, err := api.AccessOrganization(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := api.AccessApplication(ctx, accountID, applicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAccessJWTVerifier(org.AuthDomain, []string{app.AUD}, opts...)
+}
+
+type accessJWTHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type accessJWK struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+type accessJWKSResponse struct {
+	Keys []accessJWK `json:"keys"`
+}
+
+// Verify checks the signature, issuer, audience and validity period of a
+// token and returns its claims.
+func (v *AccessJWTVerifier) Verify(ctx context.Context, token string) (AccessIdentityClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return AccessIdentityClaims{}, errors.New("malformed token")
+	}
+
+	var header accessJWTHeader
+	if err := decodeAccessJWTSegment(parts[0], &header); err != nil {
+		return AccessIdentityClaims{}, errors.Wrap(err, "malformed token header")
+	}
+	if header.Algorithm != "RS256" {
+		return AccessIdentityClaims{}, errors.Errorf("unsupported signing algorithm %q", header.Algorithm)
+	}
+
+	key, err := v.key(ctx, header.KeyID)
+	if err != nil {
+		return AccessIdentityClaims{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return AccessIdentityClaims{}, errors.Wrap(err, "malformed token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return AccessIdentityClaims{}, errors.New("invalid token signature")
+	}
+
+	var claims AccessIdentityClaims
+	if err := decodeAccessJWTSegment(parts[1], &claims); err != nil {
+		return AccessIdentityClaims{}, errors.Wrap(err, "malformed token claims")
+	}
+
+	if claims.Issuer != v.issuer {
+		return AccessIdentityClaims{}, errors.Errorf("unexpected token issuer %q", claims.Issuer)
+	}
+	if !v.audienceMatches(claims.Audience) {
+		return AccessIdentityClaims{}, errors.Errorf("unexpected token audience %q", strings.Join(claims.Audience, ", "))
+	}
+
+	now := v.now()
+	if claims.ExpiresAt == 0 || now.Add(-v.leeway).After(time.Unix(claims.ExpiresAt, 0)) {
+		return AccessIdentityClaims{}, errors.New("token has expired")
+	}
+	if claims.NotBefore != 0 && now.Add(v.leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return AccessIdentityClaims{}, errors.New("token is not valid yet")
+	}
+
+	return claims, nil
+}
+
+func (v *AccessJWTVerifier) audienceMatches(audience []string) bool {
+	for _, a := range audience {
+		for _, want := range v.audiences {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the signing key with the given ID, fetching the keys if the
+// cache has expired or the key is unknown. Fetches happen outside the lock,
+// one at a time and at most once every minRefresh whether or not they
+// succeed; concurrent callers wait for the fetch in progress. A call fetches
+// at most once, so a token with an unknown key costs a single request.
+func (v *AccessJWTVerifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	for {
+		v.mu.Lock()
+		now := v.now()
+		key, ok := v.keys[kid]
+		if ok && now.Sub(v.fetchedAt) < v.cacheTTL {
+			v.mu.Unlock()
+			return key, nil
+		}
+
+		if fetching := v.fetching; fetching != nil {
+			v.mu.Unlock()
+			select {
+			case <-fetching:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if !v.attemptedAt.IsZero() && now.Sub(v.attemptedAt) < v.minRefresh {
+			err := v.fetchErr
+			v.mu.Unlock()
+			return accessJWTCachedKey(kid, key, ok, err)
+		}
+
+		previous := v.attemptedAt
+		v.attemptedAt = now
+		fetching := make(chan struct{})
+		v.fetching = fetching
+		v.mu.Unlock()
+
+		keys, err := v.fetchKeys(ctx)
+
+		v.mu.Lock()
+		v.fetching = nil
+		close(fetching)
+		v.fetchErr = err
+		if err == nil {
+			v.keys = keys
+			v.fetchedAt = v.now()
+		} else if ctx.Err() != nil {
+			// The caller gave up; let the next one try again straight away.
+			v.attemptedAt = previous
+		}
+		key, ok = v.keys[kid]
+		v.mu.Unlock()
+		return accessJWTCachedKey(kid, key, ok, err)
+	}
+}
+
+// accessJWTCachedKey returns the outcome of a key lookup which does not
+// fetch. Cached keys are used while the certs endpoint is unavailable.
+func accessJWTCachedKey(kid string, key *rsa.PublicKey, ok bool, err error) (*rsa.PublicKey, error) {
+	if ok {
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.Errorf("unknown signing key %q", kid)
+}
+
+func (v *AccessJWTVerifier) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.certsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch Access signing keys")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch Access signing keys: HTTP status %d", resp.StatusCode)
+	}
+
+	var jwks accessJWKSResponse
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, errors.Wrap(err, errUnmarshalError)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.KeyType != "RSA" {
+			continue
+		}
+		key, err := parseAccessJWK(k)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid signing key %q", k.KeyID)
+		}
+		keys[k.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func parseAccessJWK(k accessJWK) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent is too large")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func decodeAccessJWTSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+type accessIdentityContextKey struct{}
+
+// AccessIdentityFromContext returns the claims stored in the request context
+// by AccessJWTVerifier.Middleware.
+func AccessIdentityFromContext(ctx context.Context) (AccessIdentityClaims, bool) {
+	claims, ok := ctx.Value(accessIdentityContextKey{}).(AccessIdentityClaims)
+	return claims, ok
+}
+
+// AccessJWTFromRequest returns the Access token of a request, read from the
+// Cf-Access-Jwt-Assertion header or the CF_Authorization cookie.
+func AccessJWTFromRequest(r *http.Request) string {
+	if token := r.Header.Get(AccessJWTHeader); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(AccessJWTCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Middleware rejects requests without a valid Access token with 403
+// Forbidden and passes the token's claims to next in the request context,
+// see AccessIdentityFromContext.
+func (v *AccessJWTVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := AccessJWTFromRequest(r)
+		if token == "" {
+			http.Error(w, "missing Access token", http.StatusForbidden)
+			return
+		}
+
+		claims, err := v.Verify(r.Context(), token)
+		if err != nil {
+			http.Error(w, "invalid Access token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessIdentityContextKey{}, claims)))
+	})
+}
@@ -0,0 +1,337 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAccessAUD = "4714734ad94f1ec6e2cf3f24aad3eb75ef9e9e8c9d8b2c1c1b3c4d5e6f7a8b9c"
+
+// testAccessJWKS serves signing keys like the Access certs endpoint.
+type testAccessJWKS struct {
+	sync.Mutex
+	keys        map[string]*rsa.PrivateKey
+	requests    int
+	unavailable bool
+}
+
+func (j *testAccessJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	j.Lock()
+	defer j.Unlock()
+	j.requests++
+	if j.unavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var keys []accessJWK
+	for kid, key := range j.keys {
+		keys = append(keys, accessJWK{
+			KeyID:     kid,
+			KeyType:   "RSA",
+			Algorithm: "RS256",
+			Modulus:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(accessJWKSResponse{Keys: keys}) //nolint
+}
+
+func (j *testAccessJWKS) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	j.Lock()
+	key := j.keys[kid]
+	j.Unlock()
+	if key == nil {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+	}
+
+	header, _ := json.Marshal(accessJWTHeader{Algorithm: "RS256", KeyID: kid})
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestAccessJWKS(t *testing.T, kids ...string) (*testAccessJWKS, *httptest.Server) {
+	j := &testAccessJWKS{keys: map[string]*rsa.PrivateKey{}}
+	for _, kid := range kids {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		j.keys[kid] = key
+	}
+	return j, httptest.NewServer(j)
+}
+
+func testAccessClaims(overrides map[string]interface{}) map[string]interface{} {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud":   []string{testAccessAUD},
+		"email": "user@example.com",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nbf":   now.Unix(),
+		"iss":   "https://example.cloudflareaccess.com",
+		"sub":   "7335d417-61da-459d-899c-0a01c76a2f94",
+		"type":  "app",
+	}
+	for k, v := range overrides {
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestAccessJWTVerifier_Verify(t *testing.T) {
+	jwks, server := newTestAccessJWKS(t, "key-1")
+	defer server.Close()
+
+	v, err := NewAccessJWTVerifier("example.cloudflareaccess.com", []string{testAccessAUD}, AccessJWTCertsURL(server.URL))
+	require.NoError(t, err)
+
+	claims, err := v.Verify(context.Background(), jwks.sign(t, "key-1", testAccessClaims(map[string]interface{}{
+		"aud":    testAccessAUD,
+		"custom": map[string]string{"department": "engineering"},
+	})))
+	if assert.NoError(t, err) {
+		assert.Equal(t, AccessJWTAudience{testAccessAUD}, claims.Audience)
+		assert.Equal(t, "user@example.com", claims.Email)
+		assert.Equal(t, "7335d417-61da-459d-899c-0a01c76a2f94", claims.Subject)
+		assert.JSONEq(t, `{"department": "engineering"}`, string(claims.Custom))
+	}
+
+	tests := map[string]struct {
+		kid    string
+		claims map[string]interface{}
+		err    string
+	}{
+		"expired": {
+			kid:    "key-1",
+			claims: testAccessClaims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}),
+			err:    "token has expired",
+		},
+		"not valid yet": {
+			kid:    "key-1",
+			claims: testAccessClaims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()}),
+			err:    "token is not valid yet",
+		},
+		"wrong audience": {
+			kid:    "key-1",
+			claims: testAccessClaims(map[string]interface{}{"aud": []string{"other", "another"}}),
+			err:    `unexpected token audience "other, another"`,
+		},
+		"wrong issuer": {
+			kid:    "key-1",
+			claims: testAccessClaims(map[string]interface{}{"iss": "https://evil.cloudflareaccess.com"}),
+			err:    `unexpected token issuer "https://evil.cloudflareaccess.com"`,
+		},
+		"unknown key": {
+			kid:    "key-9",
+			claims: testAccessClaims(nil),
+			err:    `unknown signing key "key-9"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), jwks.sign(t, tc.kid, tc.claims))
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+
+	// A token whose payload was tampered with fails the signature check.
+	token := jwks.sign(t, "key-1", testAccessClaims(nil))
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(testAccessClaims(map[string]interface{}{"email": "admin@example.com"}))
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	_, err = v.Verify(context.Background(), strings.Join(parts, "."))
+	assert.EqualError(t, err, "invalid token signature")
+
+	_, err = v.Verify(context.Background(), "not-a-token")
+	assert.EqualError(t, err, "malformed token")
+}
+
+func TestAccessJWTVerifier_KeyRotation(t *testing.T) {
+	jwks, server := newTestAccessJWKS(t, "key-1")
+	defer server.Close()
+
+	v, err := NewAccessJWTVerifier("https://example.cloudflareaccess.com/", []string{testAccessAUD},
+		AccessJWTCertsURL(server.URL), AccessJWTKeyCache(time.Hour, time.Second))
+	require.NoError(t, err)
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	_, err = v.Verify(context.Background(), jwks.sign(t, "key-1", testAccessClaims(nil)))
+	assert.NoError(t, err)
+	_, err = v.Verify(context.Background(), jwks.sign(t, "key-1", testAccessClaims(nil)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, jwks.requests, "keys should be cached")
+
+	// Rotate the signing key; the verifier picks up the new key on demand.
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks.Lock()
+	jwks.keys["key-2"] = key
+	jwks.Unlock()
+	now = now.Add(time.Second)
+
+	_, err = v.Verify(context.Background(), jwks.sign(t, "key-2", testAccessClaims(nil)))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, jwks.requests)
+}
+
+func TestAccessJWTVerifier_UnknownKey(t *testing.T) {
+	jwks, server := newTestAccessJWKS(t, "key-1")
+	defer server.Close()
+
+	// A zero refresh interval is raised, so tokens with unknown keys fetch
+	// the keys once per call and then at most once a second.
+	v, err := NewAccessJWTVerifier("https://example.cloudflareaccess.com/", []string{testAccessAUD},
+		AccessJWTCertsURL(server.URL), AccessJWTKeyCache(0, 0))
+	require.NoError(t, err)
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	token := jwks.sign(t, "forged", testAccessClaims(nil))
+	_, err = v.Verify(context.Background(), token)
+	assert.EqualError(t, err, `unknown signing key "forged"`)
+	assert.Equal(t, 1, jwks.requests)
+
+	_, err = v.Verify(context.Background(), token)
+	assert.EqualError(t, err, `unknown signing key "forged"`)
+	assert.Equal(t, 1, jwks.requests)
+
+	now = now.Add(time.Second)
+	_, err = v.Verify(context.Background(), token)
+	assert.EqualError(t, err, `unknown signing key "forged"`)
+	assert.Equal(t, 2, jwks.requests)
+}
+
+func TestAccessJWTVerifier_CertsUnavailable(t *testing.T) {
+	jwks, server := newTestAccessJWKS(t, "key-1")
+	defer server.Close()
+
+	v, err := NewAccessJWTVerifier("https://example.cloudflareaccess.com/", []string{testAccessAUD},
+		AccessJWTCertsURL(server.URL), AccessJWTKeyCache(time.Hour, 10*time.Second))
+	require.NoError(t, err)
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	_, err = v.Verify(context.Background(), jwks.sign(t, "key-1", testAccessClaims(nil)))
+	assert.NoError(t, err)
+
+	// Once the cache expires the cached key is used while the endpoint is
+	// down, and concurrent requests share a single fetch.
+	jwks.Lock()
+	jwks.unavailable = true
+	jwks.Unlock()
+	now = now.Add(time.Hour)
+
+	token := jwks.sign(t, "key-1", testAccessClaims(nil))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.Verify(context.Background(), token)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, jwks.requests)
+
+	// Failed fetches are not retried before the minimum refresh interval.
+	_, err = v.Verify(context.Background(), jwks.sign(t, "key-2", testAccessClaims(nil)))
+	assert.EqualError(t, err, "failed to fetch Access signing keys: HTTP status 503")
+	assert.Equal(t, 2, jwks.requests)
+
+	now = now.Add(10 * time.Second)
+	_, err = v.Verify(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, jwks.requests)
+}
+
+func TestAccessJWTVerifier_Middleware(t *testing.T) {
+	jwks, server := newTestAccessJWKS(t, "key-1")
+	defer server.Close()
+
+	v, err := NewAccessJWTVerifier("example.cloudflareaccess.com", []string{testAccessAUD}, AccessJWTCertsURL(server.URL))
+	require.NoError(t, err)
+
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := AccessIdentityFromContext(r.Context())
+		assert.True(t, ok)
+		fmt.Fprint(w, claims.Email)
+	}))
+
+	token := jwks.sign(t, "key-1", testAccessClaims(nil))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(AccessJWTHeader, token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user@example.com", w.Body.String())
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: AccessJWTCookie, Value: token})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(AccessJWTHeader, jwks.sign(t, "key-1", testAccessClaims(map[string]interface{}{"aud": "other"})))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAccessJWTVerifierFromApplication(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/organizations", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"auth_domain": "example.cloudflareaccess.com"}}`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/apps/480f4f69-1a28-4fdd-9240-1ed29f0ac1db", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "480f4f69-1a28-4fdd-9240-1ed29f0ac1db", "aud": %q}}`, testAccessAUD)
+	})
+
+	v, err := client.AccessJWTVerifier(context.Background(), testAccountID, "480f4f69-1a28-4fdd-9240-1ed29f0ac1db")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://example.cloudflareaccess.com", v.issuer)
+		assert.Equal(t, "https://example.cloudflareaccess.com/cdn-cgi/access/certs", v.certsURL)
+		assert.Equal(t, []string{testAccessAUD}, v.audiences)
+	}
+}
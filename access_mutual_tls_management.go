@@ -0,0 +1,284 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AccessMutualTLSUsage is an Access application with policies that require
+// a client certificate, and the mutual TLS certificates associated with any
+// of its hostnames. An empty Certificates means the certificate rules of the
+// policies can never match.
+type AccessMutualTLSUsage struct {
+	Application AccessApplication
+	// Hostnames are the hostnames of the application's domain and of its
+	// other self-hosted domains.
+	Hostnames    []string
+	Policies     []AccessPolicy
+	Certificates []AccessMutualTLSCertificate
+}
+
+// AccessMutualTLSRotation is the outcome of rotating a mutual TLS
+// certificate.
+type AccessMutualTLSRotation struct {
+	Old AccessMutualTLSCertificate
+	New AccessMutualTLSCertificate
+	// Deleted reports whether the old certificate was deleted.
+	Deleted bool
+}
+
+// CreateValidatedAccessMutualTLSCertificate checks a CA certificate locally
+// with ValidateAccessMutualTLSCertificate before creating it at account
+// level.
+func (api *API) CreateValidatedAccessMutualTLSCertificate(ctx context.Context, accountID string, certificate AccessMutualTLSCertificate, opts CertificateBundleOptions) (AccessMutualTLSCertificate, error) {
+	return api.createValidatedAccessMutualTLSCertificate(ctx, accountID, certificate, opts, AccountRouteRoot)
+}
+
+// CreateValidatedZoneAccessMutualTLSCertificate checks a CA certificate
+// locally with ValidateAccessMutualTLSCertificate before creating it at zone
+// level.
+func (api *API) CreateValidatedZoneAccessMutualTLSCertificate(ctx context.Context, zoneID string, certificate AccessMutualTLSCertificate, opts CertificateBundleOptions) (AccessMutualTLSCertificate, error) {
+	return api.createValidatedAccessMutualTLSCertificate(ctx, zoneID, certificate, opts, ZoneRouteRoot)
+}
+
+func (api *API) createValidatedAccessMutualTLSCertificate(ctx context.Context, id string, certificate AccessMutualTLSCertificate, opts CertificateBundleOptions, routeRoot RouteRoot) (AccessMutualTLSCertificate, error) {
+	if _, err := ValidateAccessMutualTLSCertificate(certificate, opts); err != nil {
+		return AccessMutualTLSCertificate{}, err
+	}
+	return api.createAccessMutualTLSCertificate(ctx, id, certificate, routeRoot)
+}
+
+// SetAccessMutualTLSCertificateHostnames replaces the hostnames an account
+// level mutual TLS certificate is associated with.
+func (api *API) SetAccessMutualTLSCertificateHostnames(ctx context.Context, accountID, certificateID string, hostnames []string) (AccessMutualTLSCertificate, error) {
+	return api.setAccessMutualTLSCertificateHostnames(ctx, accountID, certificateID, hostnames, AccountRouteRoot)
+}
+
+// SetZoneAccessMutualTLSCertificateHostnames replaces the hostnames a zone
+// level mutual TLS certificate is associated with.
+func (api *API) SetZoneAccessMutualTLSCertificateHostnames(ctx context.Context, zoneID, certificateID string, hostnames []string) (AccessMutualTLSCertificate, error) {
+	return api.setAccessMutualTLSCertificateHostnames(ctx, zoneID, certificateID, hostnames, ZoneRouteRoot)
+}
+
+func (api *API) setAccessMutualTLSCertificateHostnames(ctx context.Context, id, certificateID string, hostnames []string, routeRoot RouteRoot) (AccessMutualTLSCertificate, error) {
+	current, err := api.accessMutualTLSCertificate(ctx, id, certificateID, routeRoot)
+	if err != nil {
+		return AccessMutualTLSCertificate{}, err
+	}
+	if hostnames == nil {
+		hostnames = []string{}
+	}
+
+	// AccessMutualTLSCertificate omits empty hostnames, which would leave
+	// them unchanged rather than clear them.
+	update := struct {
+		Name                string   `json:"name"`
+		AssociatedHostnames []string `json:"associated_hostnames"`
+	}{current.Name, hostnames}
+
+	uri := fmt.Sprintf("/%s/%s/access/certificates/%s", routeRoot, id, certificateID)
+	res, err := api.makeRequestContext(ctx, http.MethodPut, uri, update)
+	if err != nil {
+		return AccessMutualTLSCertificate{}, err
+	}
+
+	var response AccessMutualTLSCertificateDetailResponse
+	if err := json.Unmarshal(res, &response); err != nil {
+		return AccessMutualTLSCertificate{}, errors.Wrap(err, errUnmarshalError)
+	}
+	return response.Result, nil
+}
+
+// AccessMutualTLSUsage lists the account level Access applications whose
+// policies use certificate or common name rules, directly or through Access
+// groups, with the certificates associated with their hostnames.
+func (api *API) AccessMutualTLSUsage(ctx context.Context, accountID string) ([]AccessMutualTLSUsage, error) {
+	return api.accessMutualTLSUsage(ctx, accountID, AccountRouteRoot)
+}
+
+// ZoneAccessMutualTLSUsage is AccessMutualTLSUsage for zone level
+// applications and certificates.
+func (api *API) ZoneAccessMutualTLSUsage(ctx context.Context, zoneID string) ([]AccessMutualTLSUsage, error) {
+	return api.accessMutualTLSUsage(ctx, zoneID, ZoneRouteRoot)
+}
+
+func (api *API) accessMutualTLSUsage(ctx context.Context, id string, routeRoot RouteRoot) ([]AccessMutualTLSUsage, error) {
+	certificates, err := api.accessMutualTLSCertificates(ctx, id, routeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []AccessGroup
+	for page := 1; ; page++ {
+		g, info, err := api.accessGroups(ctx, id, PaginationOptions{Page: page, PerPage: 50}, routeRoot)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g...)
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+	certificateGroups := accessGroupsWithCertificateRules(groups)
+
+	var applications []AccessApplication
+	for page := 1; ; page++ {
+		a, info, err := api.accessApplications(ctx, id, PaginationOptions{Page: page, PerPage: 50}, routeRoot)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, a...)
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+
+	var usage []AccessMutualTLSUsage
+	for _, app := range applications {
+		var policies []AccessPolicy
+		for page := 1; ; page++ {
+			p, info, err := api.accessPolicies(ctx, id, app.ID, PaginationOptions{Page: page, PerPage: 50}, routeRoot)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to list policies of application %s", app.Name)
+			}
+			for _, policy := range p {
+				if accessRulesUseCertificate(certificateGroups, policy.Include, policy.Exclude, policy.Require) {
+					policies = append(policies, policy)
+				}
+			}
+			if info.Page >= info.TotalPages {
+				break
+			}
+		}
+		if len(policies) == 0 {
+			continue
+		}
+
+		u := AccessMutualTLSUsage{Application: app, Hostnames: accessApplicationHostnames(app), Policies: policies}
+		for _, certificate := range certificates {
+			for _, hostname := range u.Hostnames {
+				if containsFold(certificate.AssociatedHostnames, hostname) {
+					u.Certificates = append(u.Certificates, certificate)
+					break
+				}
+			}
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, nil
+}
+
+// accessGroupsWithCertificateRules returns the IDs of the groups using
+// certificate rules, following groups nested in other groups.
+func accessGroupsWithCertificateRules(groups []AccessGroup) map[string]bool {
+	found := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, g := range groups {
+			if !found[g.ID] && accessRulesUseCertificate(found, g.Include, g.Exclude, g.Require) {
+				found[g.ID] = true
+				changed = true
+			}
+		}
+	}
+	return found
+}
+
+// accessRulesUseCertificate reports whether any rule is a certificate or
+// common name rule, or refers to one of certificateGroups.
+func accessRulesUseCertificate(certificateGroups map[string]bool, rules ...AccessPolicyRules) bool {
+	for _, list := range rules {
+		for _, rule := range list {
+			switch r := typedAccessPolicyRule(rule).(type) {
+			case AccessGroupCertificate, AccessGroupCertificateCommonName:
+				return true
+			case AccessGroupAccessGroup:
+				if certificateGroups[r.Group.ID] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// accessApplicationHostnames returns the hostnames of the domain and the
+// self-hosted domains of an application, which may include a path.
+func accessApplicationHostnames(app AccessApplication) []string {
+	var hostnames []string
+	for _, domain := range append([]string{app.Domain}, app.SelfHostedDomains...) {
+		host := domain
+		if i := strings.Index(host, "/"); i >= 0 {
+			host = host[:i]
+		}
+		host = strings.ToLower(host)
+		if host != "" && !contains(hostnames, host) {
+			hostnames = append(hostnames, host)
+		}
+	}
+	return hostnames
+}
+
+// RotateAccessMutualTLSCertificate replaces an account level mutual TLS
+// certificate. The new CA certificate is validated and uploaded with the
+// hostnames of the old certificate, the hostnames are then released from the
+// old certificate and, with deleteOld, the old certificate is deleted.
+// Policies match any certificate associated with a hostname, so clients
+// presenting certificates issued by either CA are accepted until the old
+// certificate lets go of the hostnames. If that fails both certificates are
+// left associated and the rotation is returned with the error.
+//
+// Clients with certificates issued by the old CA are rejected once the
+// hostnames are released; to phase them out gradually, upload a bundle with
+// both CAs as the new certificate.
+func (api *API) RotateAccessMutualTLSCertificate(ctx context.Context, accountID, certificateID string, certificate AccessMutualTLSCertificate, deleteOld bool, opts CertificateBundleOptions) (AccessMutualTLSRotation, error) {
+	return api.rotateAccessMutualTLSCertificate(ctx, accountID, certificateID, certificate, deleteOld, opts, AccountRouteRoot)
+}
+
+// RotateZoneAccessMutualTLSCertificate is RotateAccessMutualTLSCertificate
+// for zone level certificates.
+func (api *API) RotateZoneAccessMutualTLSCertificate(ctx context.Context, zoneID, certificateID string, certificate AccessMutualTLSCertificate, deleteOld bool, opts CertificateBundleOptions) (AccessMutualTLSRotation, error) {
+	return api.rotateAccessMutualTLSCertificate(ctx, zoneID, certificateID, certificate, deleteOld, opts, ZoneRouteRoot)
+}
+
+func (api *API) rotateAccessMutualTLSCertificate(ctx context.Context, id, certificateID string, certificate AccessMutualTLSCertificate, deleteOld bool, opts CertificateBundleOptions, routeRoot RouteRoot) (AccessMutualTLSRotation, error) {
+	if _, err := ValidateAccessMutualTLSCertificate(certificate, opts); err != nil {
+		return AccessMutualTLSRotation{}, err
+	}
+
+	old, err := api.accessMutualTLSCertificate(ctx, id, certificateID, routeRoot)
+	if err != nil {
+		return AccessMutualTLSRotation{}, err
+	}
+	hostnames := append([]string{}, old.AssociatedHostnames...)
+	sort.Strings(hostnames)
+
+	certificate.AssociatedHostnames = hostnames
+	created, err := api.createAccessMutualTLSCertificate(ctx, id, certificate, routeRoot)
+	if err != nil {
+		return AccessMutualTLSRotation{}, errors.Wrap(err, "failed to create certificate")
+	}
+	rotation := AccessMutualTLSRotation{Old: old, New: created}
+
+	if len(hostnames) > 0 {
+		if _, err := api.setAccessMutualTLSCertificateHostnames(ctx, id, old.ID, nil, routeRoot); err != nil {
+			return rotation, errors.Wrapf(err, "failed to release hostnames of certificate %s", old.ID)
+		}
+	}
+
+	if deleteOld {
+		if err := api.deleteAccessMutualTLSCertificate(ctx, id, old.ID, routeRoot); err != nil {
+			return rotation, errors.Wrapf(err, "failed to delete certificate %s", old.ID)
+		}
+		rotation.Deleted = true
+	}
+
+	return rotation, nil
+}
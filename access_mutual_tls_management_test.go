@@ -0,0 +1,229 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateValidatedAccessMutualTLSCertificate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ca := newTestCA(t, "Device CA", nil)
+	created := 0
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/certificates", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+		created++
+		var c AccessMutualTLSCertificate
+		if assert.NoError(t, json.NewDecoder(r.Body).Decode(&c)) {
+			assert.Equal(t, AccessMutualTLSCertificate{
+				Name:                "devices",
+				Certificate:         ca.pem,
+				AssociatedHostnames: []string{"app.example.com"},
+			}, c)
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "new-1", "name": "devices", "associated_hostnames": ["app.example.com"]}}`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/certificates/new-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "new-1", "name": "devices", "associated_hostnames": ["app.example.com"]}}`)
+		case http.MethodPut:
+			b, err := ioutil.ReadAll(r.Body)
+			if assert.NoError(t, err) {
+				assert.JSONEq(t, `{"name": "devices", "associated_hostnames": ["a.example.com", "b.example.com"]}`, string(b))
+			}
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "new-1", "name": "devices", "associated_hostnames": ["a.example.com", "b.example.com"]}}`)
+		default:
+			t.Errorf("Expected method 'GET' or 'PUT', got %s", r.Method)
+		}
+	})
+
+	certificate, err := client.CreateValidatedAccessMutualTLSCertificate(context.Background(), testAccountID, AccessMutualTLSCertificate{
+		Name:                "devices",
+		Certificate:         ca.pem,
+		AssociatedHostnames: []string{"app.example.com"},
+	}, CertificateBundleOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "new-1", certificate.ID)
+
+	leaf := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "device-1"}}, ca)
+	_, err = client.CreateValidatedAccessMutualTLSCertificate(context.Background(), testAccountID, AccessMutualTLSCertificate{Name: "device", Certificate: leaf.pem}, CertificateBundleOptions{})
+	assert.EqualError(t, err, "certificate device-1 is not a CA certificate")
+	assert.Equal(t, 1, created)
+
+	updated, err := client.SetAccessMutualTLSCertificateHostnames(context.Background(), testAccountID, "new-1", []string{"a.example.com", "b.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, updated.AssociatedHostnames)
+}
+
+func TestAccessMutualTLSUsage(t *testing.T) {
+	setup()
+	defer teardown()
+
+	writeJSON := func(w http.ResponseWriter, result string) {
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, result)
+	}
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/certificates", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		writeJSON(w, `[
+			{"id": "c1", "name": "devices", "associated_hostnames": ["App.example.com"]},
+			{"id": "c2", "name": "unused"},
+			{"id": "c3", "name": "portal devices", "associated_hostnames": ["portal.example.net"]}
+		]`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/groups", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, `[
+			{"id": "g1", "name": "managed devices", "include": [{"common_name": {"common_name": "device"}}], "exclude": [], "require": []},
+			{"id": "g2", "name": "employees on managed devices", "include": [{"group": {"id": "g1"}}], "exclude": [], "require": []},
+			{"id": "g3", "name": "staff", "include": [{"email_domain": {"domain": "example.com"}}], "exclude": [], "require": []}
+		]`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/apps", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, `[
+			{"id": "app1", "name": "admin", "domain": "app.example.com/admin"},
+			{"id": "app2", "name": "wiki", "domain": "wiki.example.com"},
+			{"id": "app3", "name": "blog", "domain": "blog.example.com"},
+			{"id": "app4", "name": "portal", "domain": "portal.example.com", "self_hosted_domains": ["portal.example.com", "Portal.example.net/login"]}
+		]`)
+	})
+	policies := map[string]string{
+		"app1": `[{"id": "p1", "name": "certificate", "decision": "allow", "include": [{"certificate": {}}], "exclude": [], "require": []}]`,
+		"app2": `[{"id": "p2", "name": "staff", "decision": "allow", "include": [{"group": {"id": "g3"}}], "exclude": [], "require": []},
+		          {"id": "p3", "name": "devices", "decision": "allow", "include": [{"group": {"id": "g3"}}], "exclude": [], "require": [{"group": {"id": "g2"}}]}]`,
+		"app3": `[{"id": "p4", "name": "everyone", "decision": "allow", "include": [{"everyone": {}}], "exclude": [], "require": []}]`,
+		"app4": `[{"id": "p5", "name": "certificate", "decision": "allow", "include": [{"certificate": {}}], "exclude": [], "require": []}]`,
+	}
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/apps/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/"+testAccountID+"/access/apps/"), "/policies")
+		writeJSON(w, policies[id])
+	})
+
+	usage, err := client.AccessMutualTLSUsage(context.Background(), testAccountID)
+	require.NoError(t, err)
+	require.Len(t, usage, 3)
+
+	assert.Equal(t, "app1", usage[0].Application.ID)
+	assert.Equal(t, []string{"app.example.com"}, usage[0].Hostnames)
+	assert.Len(t, usage[0].Policies, 1)
+	if assert.Len(t, usage[0].Certificates, 1) {
+		assert.Equal(t, "c1", usage[0].Certificates[0].ID)
+	}
+
+	assert.Equal(t, "app2", usage[1].Application.ID)
+	if assert.Len(t, usage[1].Policies, 1) {
+		assert.Equal(t, "p3", usage[1].Policies[0].ID)
+	}
+	assert.Empty(t, usage[1].Certificates)
+
+	// The certificate is tied to a hostname other than the main domain.
+	assert.Equal(t, "app4", usage[2].Application.ID)
+	assert.Equal(t, []string{"portal.example.com", "portal.example.net"}, usage[2].Hostnames)
+	if assert.Len(t, usage[2].Certificates, 1) {
+		assert.Equal(t, "c3", usage[2].Certificates[0].ID)
+	}
+}
+
+// handleAccessMutualTLSRotation serves the certificate being rotated and
+// the creation of its replacement, which must carry the old hostnames.
+func handleAccessMutualTLSRotation(t *testing.T, pem string) {
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/certificates", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+		b, err := ioutil.ReadAll(r.Body)
+		if assert.NoError(t, err) {
+			assert.JSONEq(t, fmt.Sprintf(`{
+              "name": "devices-2",
+              "certificate": %q,
+              "associated_hostnames": ["a.example.com", "b.example.com"],
+              "created_at": "0001-01-01T00:00:00Z",
+              "updated_at": "0001-01-01T00:00:00Z",
+              "expires_on": "0001-01-01T00:00:00Z"
+            }`, pem), string(b))
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "new-1", "name": "devices-2", "associated_hostnames": ["a.example.com", "b.example.com"]}}`)
+	})
+}
+
+func TestRotateAccessMutualTLSCertificate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// A bundle of the old and new CA, used to move clients over gradually,
+	// is accepted although neither CA signs the other.
+	bundle := newTestCA(t, "Device CA", nil).pem + newTestCA(t, "Device CA 2", nil).pem
+	handleAccessMutualTLSRotation(t, bundle)
+
+	released, deleted := false, false
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/certificates/old", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "old", "name": "devices", "associated_hostnames": ["b.example.com", "a.example.com"]}}`)
+		case http.MethodPut:
+			// The hostnames are released only once the new certificate holds
+			// them, so clients are never left without a CA.
+			b, err := ioutil.ReadAll(r.Body)
+			if assert.NoError(t, err) {
+				assert.JSONEq(t, `{"name": "devices", "associated_hostnames": []}`, string(b))
+			}
+			released = true
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "old", "name": "devices", "associated_hostnames": []}}`)
+		case http.MethodDelete:
+			assert.True(t, released, "certificate deleted before its hostnames were released")
+			deleted = true
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "old"}}`)
+		default:
+			t.Errorf("Expected method 'GET', 'PUT' or 'DELETE', got %s", r.Method)
+		}
+	})
+
+	rotation, err := client.RotateAccessMutualTLSCertificate(context.Background(), testAccountID, "old", AccessMutualTLSCertificate{Name: "devices-2", Certificate: bundle}, true, CertificateBundleOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "old", rotation.Old.ID)
+	assert.Equal(t, "new-1", rotation.New.ID)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, rotation.New.AssociatedHostnames)
+	assert.True(t, rotation.Deleted)
+	assert.True(t, deleted)
+}
+
+func TestRotateAccessMutualTLSCertificate_ReleaseFails(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ca := newTestCA(t, "Device CA 2", nil)
+	handleAccessMutualTLSRotation(t, ca.pem)
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/certificates/old", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "old", "name": "devices", "associated_hostnames": ["a.example.com", "b.example.com"]}}`)
+		case http.MethodPut:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success": false, "errors": [{"code": 12130, "message": "certificate is locked"}], "messages": [], "result": null}`)
+		default:
+			t.Errorf("Expected method 'GET' or 'PUT', got %s", r.Method)
+		}
+	})
+
+	// Both certificates keep the hostnames, and the new one is reported so
+	// the caller can finish the rotation.
+	rotation, err := client.RotateAccessMutualTLSCertificate(context.Background(), testAccountID, "old", AccessMutualTLSCertificate{Name: "devices-2", Certificate: ca.pem}, true, CertificateBundleOptions{})
+	assert.EqualError(t, err, "failed to release hostnames of certificate old: HTTP status 400: certificate is locked (12130)")
+	assert.Equal(t, "new-1", rotation.New.ID)
+	assert.False(t, rotation.Deleted)
+}
@@ -35,15 +35,15 @@ type AccessPolicy struct {
 
 	// The include policy works like an OR logical operator. The user must
 	// satisfy one of the rules.
-	Include []interface{} `json:"include"`
+	Include AccessPolicyRules `json:"include"`
 
 	// The exclude policy works like a NOT logical operator. The user must
 	// not satisfy all of the rules in exclude.
-	Exclude []interface{} `json:"exclude"`
+	Exclude AccessPolicyRules `json:"exclude"`
 
 	// The require policy works like a AND logical operator. The user must
 	// satisfy all of the rules in require.
-	Require []interface{} `json:"require"`
+	Require AccessPolicyRules `json:"require"`
 }
 
 // AccessPolicyListResponse represents the response from the list
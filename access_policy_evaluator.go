@@ -0,0 +1,503 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Access policy decisions.
+const (
+	AccessPolicyDecisionAllow       = "allow"
+	AccessPolicyDecisionDeny        = "deny"
+	AccessPolicyDecisionBypass      = "bypass"
+	AccessPolicyDecisionNonIdentity = "non_identity"
+)
+
+// AccessIdentity describes who is requesting an Access application for the
+// purposes of AccessPolicyEvaluator. Requests made with a service token set
+// ServiceTokenID and usually leave the user fields empty.
+type AccessIdentity struct {
+	Email string
+	IP    net.IP
+	// Country is the ISO 3166-1 alpha-2 country code of the request.
+	Country string
+
+	// IdentityProviderID is the ID of the identity provider the user logged
+	// in with.
+	IdentityProviderID string
+	// Groups are the identity provider groups of the user: GSuite group
+	// emails, Okta group names, Azure AD group IDs and GitHub organizations,
+	// with teams written as "organization/team".
+	Groups []string
+	// SAMLAttributes are the attributes of the SAML assertion, by name.
+	SAMLAttributes map[string][]string
+	// AuthMethods are the "amr" values of the login, such as "hwk".
+	AuthMethods []string
+
+	// DevicePosture maps device posture integration IDs to whether the
+	// device passed the check.
+	DevicePosture map[string]bool
+
+	// Certificate reports whether the client presented a valid mTLS
+	// certificate, and CommonName is its common name.
+	Certificate bool
+	CommonName  string
+
+	ServiceTokenID string
+}
+
+// AccessPolicyRuleMatch is the result of evaluating a single rule of a
+// policy or group.
+type AccessPolicyRuleMatch struct {
+	// List is the list the rule appears in: include, exclude or require.
+	List    string
+	Rule    AccessPolicyRule
+	Matched bool
+	// Indeterminate is set for rules that cannot be evaluated offline, and
+	// for group rules whose outcome depends on such rules.
+	Indeterminate bool
+	// Detail describes the rule and, for rules that cannot be evaluated
+	// offline, why.
+	Detail string
+}
+
+// String returns a description of the rule match.
+func (m AccessPolicyRuleMatch) String() string {
+	verb := "matched"
+	switch {
+	case m.Indeterminate:
+		verb = "is indeterminate"
+	case !m.Matched:
+		verb = "did not match"
+	}
+	return fmt.Sprintf("%s rule %s %s", m.List, m.Detail, verb)
+}
+
+// AccessPolicyMatch is the result of evaluating a single policy.
+type AccessPolicyMatch struct {
+	Policy  AccessPolicy
+	Matched bool
+	// Indeterminate is set when whether the policy matches depends on rules
+	// that cannot be evaluated offline. Matched is false in that case.
+	Indeterminate bool
+	// Reason explains why the policy did or did not match.
+	Reason string
+	Rules  []AccessPolicyRuleMatch
+}
+
+// AccessPolicyEvaluation is the effective decision for an identity requesting
+// an application.
+type AccessPolicyEvaluation struct {
+	// Decision is the decision of the matching policy, or deny if no policy
+	// matched.
+	Decision string
+	// Allowed reports whether the identity can reach the application.
+	Allowed bool
+	// Policy is the matching policy, nil if no policy matched.
+	Policy *AccessPolicy
+	// Policies are the policies in the order they were evaluated, up to and
+	// including the matching policy.
+	Policies []AccessPolicyMatch
+	// Indeterminate is set when the decision depends on rules that cannot
+	// be evaluated offline. Decision is then the most restrictive outcome:
+	// a deny policy that may match denies access, and allow policies that
+	// may match are skipped.
+	Indeterminate bool
+}
+
+// String explains the decision.
+func (e AccessPolicyEvaluation) String() string {
+	var b strings.Builder
+	switch {
+	case e.Policy == nil:
+		b.WriteString("deny: no policy matched")
+	case e.Indeterminate && e.Policies[len(e.Policies)-1].Indeterminate:
+		fmt.Fprintf(&b, "%s: policy %q (precedence %d) may match", e.Decision, e.Policy.Name, e.Policy.Precedence)
+	default:
+		fmt.Fprintf(&b, "%s: policy %q (precedence %d) matched", e.Decision, e.Policy.Name, e.Policy.Precedence)
+	}
+	if e.Indeterminate {
+		b.WriteString(", indeterminate as some rules cannot be evaluated offline")
+	}
+
+	for _, p := range e.Policies {
+		fmt.Fprintf(&b, "\n  %s policy %q: %s", p.Policy.Decision, p.Policy.Name, p.Reason)
+	}
+
+	return b.String()
+}
+
+// AccessPolicyEvaluator computes which policy of an Access application
+// applies to an identity, without making any requests.
+//
+// Policies are evaluated like Access does: bypass and non_identity (service
+// auth) policies first, then allow and deny policies, each in order of
+// precedence. The first matching policy decides; when none matches access is
+// denied. A policy matches when any include rule, all require rules and no
+// exclude rule match. Rules that cannot be evaluated offline, such as
+// external evaluation, are indeterminate; see
+// AccessPolicyEvaluation.Indeterminate for how they affect the decision.
+type AccessPolicyEvaluator struct {
+	Application AccessApplication
+	Policies    []AccessPolicy
+	// Groups are the Access groups referenced by the policies, by ID.
+	Groups map[string]AccessGroup
+	// Lists are the values of the Teams lists referenced by email_list and
+	// ip_list rules, by ID.
+	Lists map[string][]string
+}
+
+// NewAccessPolicyEvaluator creates an evaluator for the policies of an
+// application.
+func NewAccessPolicyEvaluator(application AccessApplication, policies []AccessPolicy, groups []AccessGroup) *AccessPolicyEvaluator {
+	e := &AccessPolicyEvaluator{
+		Application: application,
+		Policies:    policies,
+		Groups:      make(map[string]AccessGroup, len(groups)),
+		Lists:       map[string][]string{},
+	}
+	for _, g := range groups {
+		e.Groups[g.ID] = g
+	}
+	return e
+}
+
+// AccessPolicyEvaluator fetches an application with its policies, the
+// account's Access groups and the Teams lists the rules refer to, and
+// returns an evaluator for them.
+func (api *API) AccessPolicyEvaluator(ctx context.Context, accountID, applicationID string) (*AccessPolicyEvaluator, error) {
+	app, err := api.AccessApplication(ctx, accountID, applicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []AccessPolicy
+	for page := 1; ; page++ {
+		p, info, err := api.AccessPolicies(ctx, accountID, applicationID, PaginationOptions{Page: page, PerPage: 50})
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p...)
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+
+	var groups []AccessGroup
+	for page := 1; ; page++ {
+		g, info, err := api.AccessGroups(ctx, accountID, PaginationOptions{Page: page, PerPage: 50})
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g...)
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+
+	e := NewAccessPolicyEvaluator(app, policies, groups)
+	for _, id := range e.listIDs() {
+		for page := 1; ; page++ {
+			items, info, err := api.teamsListItems(ctx, accountID, id, PaginationOptions{Page: page, PerPage: 1000})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to fetch list %s", id)
+			}
+			for _, item := range items {
+				e.Lists[id] = append(e.Lists[id], item.Value)
+			}
+			if info.Page >= info.TotalPages {
+				break
+			}
+		}
+	}
+
+	return e, nil
+}
+
+// listIDs returns the IDs of the Teams lists referenced by the policies and
+// groups.
+func (e *AccessPolicyEvaluator) listIDs() []string {
+	ids := map[string]bool{}
+	collect := func(rules ...AccessPolicyRules) {
+		for _, list := range rules {
+			for _, rule := range list {
+				switch r := typedAccessPolicyRule(rule).(type) {
+				case AccessGroupEmailList:
+					ids[r.EmailList.ID] = true
+				case AccessGroupIPList:
+					ids[r.IPList.ID] = true
+				}
+			}
+		}
+	}
+
+	for _, p := range e.Policies {
+		collect(p.Include, p.Exclude, p.Require)
+	}
+	for _, g := range e.Groups {
+		collect(g.Include, g.Exclude, g.Require)
+	}
+
+	list := make([]string, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// Evaluate returns the effective decision for an identity.
+func (e *AccessPolicyEvaluator) Evaluate(identity AccessIdentity) AccessPolicyEvaluation {
+	policies := append([]AccessPolicy{}, e.Policies...)
+	sort.SliceStable(policies, func(i, j int) bool {
+		ni, nj := accessPolicyIsNonIdentity(policies[i]), accessPolicyIsNonIdentity(policies[j])
+		if ni != nj {
+			return ni
+		}
+		return policies[i].Precedence < policies[j].Precedence
+	})
+
+	result := AccessPolicyEvaluation{Decision: AccessPolicyDecisionDeny}
+	for i, p := range policies {
+		if p.Decision == AccessPolicyDecisionAllow && identity.ServiceTokenID != "" && identity.Email == "" {
+			result.Policies = append(result.Policies, AccessPolicyMatch{
+				Policy: p,
+				Reason: "skipped, allow policies require a user identity",
+			})
+			continue
+		}
+
+		match := AccessPolicyMatch{Policy: p}
+		match.Matched, match.Indeterminate, match.Reason, match.Rules = e.evaluateRules(identity, p.Include, p.Exclude, p.Require, map[string]bool{})
+		result.Policies = append(result.Policies, match)
+
+		if match.Indeterminate {
+			result.Indeterminate = true
+			if p.Decision == AccessPolicyDecisionDeny {
+				result.Decision = AccessPolicyDecisionDeny
+				result.Policy = &policies[i]
+				break
+			}
+			continue
+		}
+		if match.Matched {
+			result.Decision = p.Decision
+			result.Allowed = p.Decision != AccessPolicyDecisionDeny
+			result.Policy = &policies[i]
+			break
+		}
+	}
+
+	return result
+}
+
+func accessPolicyIsNonIdentity(p AccessPolicy) bool {
+	return p.Decision == AccessPolicyDecisionBypass || p.Decision == AccessPolicyDecisionNonIdentity
+}
+
+// evaluateRules evaluates the include, exclude and require lists of a policy
+// or group, returning whether they match or are indeterminate. visiting
+// holds the groups being evaluated to break cycles.
+func (e *AccessPolicyEvaluator) evaluateRules(identity AccessIdentity, include, exclude, require AccessPolicyRules, visiting map[string]bool) (bool, bool, string, []AccessPolicyRuleMatch) {
+	var matches []AccessPolicyRuleMatch
+	evaluate := func(list string, rules AccessPolicyRules) []AccessPolicyRuleMatch {
+		var results []AccessPolicyRuleMatch
+		for _, rule := range rules {
+			m := e.evaluateRule(identity, rule, visiting)
+			m.List = list
+			results = append(results, m)
+		}
+		matches = append(matches, results...)
+		return results
+	}
+
+	includes := evaluate("include", include)
+	excludes := evaluate("exclude", exclude)
+	requires := evaluate("require", require)
+
+	// Indeterminate rules make the outcome indeterminate unless determinate
+	// rules already decide it: a matching exclude rule, a failing require
+	// rule or no include rule that matches or may match.
+	undecided := ""
+	for _, m := range excludes {
+		if m.Matched {
+			return false, false, m.String(), matches
+		}
+		if m.Indeterminate && undecided == "" {
+			undecided = m.String()
+		}
+	}
+	for _, m := range requires {
+		if m.Indeterminate {
+			if undecided == "" {
+				undecided = m.String()
+			}
+			continue
+		}
+		if !m.Matched {
+			return false, false, m.String(), matches
+		}
+	}
+
+	matched, maybe := "", ""
+	for _, m := range includes {
+		if m.Matched && matched == "" {
+			matched = m.String()
+		}
+		if m.Indeterminate && maybe == "" {
+			maybe = m.String()
+		}
+	}
+	if matched != "" || maybe != "" {
+		if undecided == "" {
+			if matched != "" {
+				return true, false, matched, matches
+			}
+			undecided = maybe
+		}
+		return false, true, undecided, matches
+	}
+
+	if len(includes) == 0 {
+		return false, false, "no include rules", matches
+	}
+	return false, false, "no include rule matched", matches
+}
+
+func (e *AccessPolicyEvaluator) evaluateRule(identity AccessIdentity, rule AccessPolicyRule, visiting map[string]bool) AccessPolicyRuleMatch {
+	m := AccessPolicyRuleMatch{Rule: rule}
+
+	switch r := typedAccessPolicyRule(rule).(type) {
+	case AccessGroupEmail:
+		m.Detail = fmt.Sprintf("email %s", r.Email.Email)
+		m.Matched = identity.Email != "" && strings.EqualFold(identity.Email, r.Email.Email)
+	case AccessGroupEmailList:
+		m.Detail = fmt.Sprintf("email_list %s", r.EmailList.ID)
+		for _, email := range e.Lists[r.EmailList.ID] {
+			if identity.Email != "" && strings.EqualFold(identity.Email, email) {
+				m.Matched = true
+			}
+		}
+	case AccessGroupEmailDomain:
+		m.Detail = fmt.Sprintf("email_domain %s", r.EmailDomain.Domain)
+		if i := strings.LastIndex(identity.Email, "@"); i >= 0 {
+			m.Matched = strings.EqualFold(identity.Email[i+1:], strings.TrimPrefix(r.EmailDomain.Domain, "@"))
+		}
+	case AccessGroupIP:
+		m.Detail = fmt.Sprintf("ip %s", r.IP.IP)
+		m.Matched = accessIPMatches(identity.IP, r.IP.IP)
+	case AccessGroupIPList:
+		m.Detail = fmt.Sprintf("ip_list %s", r.IPList.ID)
+		for _, ip := range e.Lists[r.IPList.ID] {
+			if accessIPMatches(identity.IP, ip) {
+				m.Matched = true
+			}
+		}
+	case AccessGroupGeo:
+		m.Detail = fmt.Sprintf("geo %s", r.Geo.CountryCode)
+		m.Matched = identity.Country != "" && strings.EqualFold(identity.Country, r.Geo.CountryCode)
+	case AccessGroupEveryone:
+		m.Detail = "everyone"
+		m.Matched = true
+	case AccessGroupServiceToken:
+		m.Detail = fmt.Sprintf("service_token %s", r.ServiceToken.ID)
+		m.Matched = identity.ServiceTokenID != "" && identity.ServiceTokenID == r.ServiceToken.ID
+	case AccessGroupAnyValidServiceToken:
+		m.Detail = "any_valid_service_token"
+		m.Matched = identity.ServiceTokenID != ""
+	case AccessGroupAccessGroup:
+		m.Matched, m.Indeterminate, m.Detail = e.evaluateGroup(identity, r.Group.ID, visiting)
+	case AccessGroupCertificate:
+		m.Detail = "certificate"
+		m.Matched = identity.Certificate
+	case AccessGroupCertificateCommonName:
+		m.Detail = fmt.Sprintf("common_name %s", r.CommonName.CommonName)
+		m.Matched = identity.Certificate && identity.CommonName == r.CommonName.CommonName
+	case AccessGroupGSuite:
+		m.Detail = fmt.Sprintf("gsuite %s", r.Gsuite.Email)
+		m.Matched = accessIdentityProviderMatches(identity, r.Gsuite.IdentityProviderID) && containsFold(identity.Groups, r.Gsuite.Email)
+	case AccessGroupGitHub:
+		org := r.GitHubOrganization.Name
+		if r.GitHubOrganization.Team != "" {
+			org += "/" + r.GitHubOrganization.Team
+		}
+		m.Detail = fmt.Sprintf("github-organization %s", org)
+		m.Matched = accessIdentityProviderMatches(identity, r.GitHubOrganization.IdentityProviderID) && containsFold(identity.Groups, org)
+	case AccessGroupAzure:
+		m.Detail = fmt.Sprintf("azureAD %s", r.AzureAD.ID)
+		m.Matched = accessIdentityProviderMatches(identity, r.AzureAD.IdentityProviderID) && containsFold(identity.Groups, r.AzureAD.ID)
+	case AccessGroupOkta:
+		m.Detail = fmt.Sprintf("okta %s", r.Okta.Name)
+		m.Matched = accessIdentityProviderMatches(identity, r.Okta.IdentityProviderID) && containsFold(identity.Groups, r.Okta.Name)
+	case AccessGroupSAML:
+		m.Detail = fmt.Sprintf("saml %s=%s", r.Saml.AttributeName, r.Saml.AttributeValue)
+		m.Matched = accessIdentityProviderMatches(identity, r.Saml.IdentityProviderID) && containsFold(identity.SAMLAttributes[r.Saml.AttributeName], r.Saml.AttributeValue)
+	case AccessGroupAuthMethod:
+		m.Detail = fmt.Sprintf("auth_method %s", r.AuthMethod.AuthMethod)
+		m.Matched = containsFold(identity.AuthMethods, r.AuthMethod.AuthMethod)
+	case AccessGroupLoginMethod:
+		m.Detail = fmt.Sprintf("login_method %s", r.LoginMethod.ID)
+		m.Matched = identity.IdentityProviderID != "" && identity.IdentityProviderID == r.LoginMethod.ID
+	case AccessGroupDevicePosture:
+		m.Detail = fmt.Sprintf("device_posture %s", r.DevicePosture.ID)
+		m.Matched = identity.DevicePosture[r.DevicePosture.ID]
+	case AccessGroupExternalEvaluation:
+		m.Detail = fmt.Sprintf("external_evaluation %s (cannot be evaluated offline)", r.ExternalEvaluation.EvaluateURL)
+		m.Indeterminate = true
+	default:
+		m.Detail = fmt.Sprintf("%s (cannot be evaluated offline)", rule.AccessPolicyRuleType())
+		m.Indeterminate = true
+	}
+
+	return m
+}
+
+// evaluateGroup evaluates the rules of an Access group. Groups missing from
+// the evaluator are indeterminate.
+func (e *AccessPolicyEvaluator) evaluateGroup(identity AccessIdentity, id string, visiting map[string]bool) (bool, bool, string) {
+	group, ok := e.Groups[id]
+	if !ok {
+		return false, true, fmt.Sprintf("group %s (unknown group)", id)
+	}
+	if visiting[id] {
+		return false, false, fmt.Sprintf("group %q (circular reference)", group.Name)
+	}
+
+	visiting[id] = true
+	defer delete(visiting, id)
+
+	matched, indeterminate, reason, _ := e.evaluateRules(identity, group.Include, group.Exclude, group.Require, visiting)
+	return matched, indeterminate, fmt.Sprintf("group %q (%s)", group.Name, reason)
+}
+
+// accessIdentityProviderMatches reports whether the identity logged in with
+// the identity provider a rule is restricted to.
+func accessIdentityProviderMatches(identity AccessIdentity, id string) bool {
+	return id == "" || identity.IdentityProviderID == "" || identity.IdentityProviderID == id
+}
+
+// accessIPMatches reports whether ip is the address or in the CIDR.
+func accessIPMatches(ip net.IP, address string) bool {
+	if ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(address); err == nil {
+		return network.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(address))
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeTestAccessPolicies(t *testing.T, data string) []AccessPolicy {
+	var policies []AccessPolicy
+	require.NoError(t, json.Unmarshal([]byte(data), &policies))
+	return policies
+}
+
+func newTestAccessPolicyEvaluator(t *testing.T) *AccessPolicyEvaluator {
+	policies := decodeTestAccessPolicies(t, `[
+		{
+			"name": "Block sanctioned countries",
+			"decision": "deny",
+			"precedence": 1,
+			"include": [{"geo": {"country_code": "KP"}}]
+		},
+		{
+			"name": "Engineers on managed devices",
+			"decision": "allow",
+			"precedence": 2,
+			"include": [{"group": {"id": "engineers"}}, {"email_list": {"id": "contractors"}}],
+			"exclude": [{"email": {"email": "former@example.com"}}],
+			"require": [{"device_posture": {"integration_uid": "disk-encryption"}}]
+		},
+		{
+			"name": "Health checks",
+			"decision": "bypass",
+			"precedence": 3,
+			"include": [{"ip": {"ip": "192.0.2.0/24"}}]
+		},
+		{
+			"name": "CI",
+			"decision": "non_identity",
+			"precedence": 4,
+			"include": [{"service_token": {"token_id": "ci-token"}}]
+		},
+		{
+			"name": "Webhook",
+			"decision": "allow",
+			"precedence": 5,
+			"include": [{"external_evaluation": {"evaluate_url": "https://example.com/evaluate", "keys_url": "https://example.com/keys"}}]
+		}
+	]`)
+
+	var engineers AccessGroup
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "engineers",
+		"name": "Engineers",
+		"include": [{"email_domain": {"domain": "example.com"}}],
+		"require": [{"okta": {"name": "engineering", "identity_provider_id": "okta"}}]
+	}`), &engineers))
+
+	e := NewAccessPolicyEvaluator(AccessApplication{Name: "Admin"}, policies, []AccessGroup{engineers})
+	e.Lists["contractors"] = []string{"contractor@partner.example"}
+	return e
+}
+
+func TestAccessPolicyEvaluator_Evaluate(t *testing.T) {
+	e := newTestAccessPolicyEvaluator(t)
+	managed := map[string]bool{"disk-encryption": true}
+
+	tests := map[string]struct {
+		identity AccessIdentity
+		decision string
+		allowed  bool
+		policy   string
+	}{
+		"engineer": {
+			identity: AccessIdentity{Email: "dev@example.com", Groups: []string{"Engineering"}, IdentityProviderID: "okta", DevicePosture: managed},
+			decision: "allow", allowed: true, policy: "Engineers on managed devices",
+		},
+		"engineer on unmanaged device": {
+			identity: AccessIdentity{Email: "dev@example.com", Groups: []string{"engineering"}},
+			decision: "deny",
+		},
+		"not in okta group": {
+			identity: AccessIdentity{Email: "sales@example.com", Groups: []string{"sales"}, DevicePosture: managed},
+			decision: "deny",
+		},
+		"contractor from list": {
+			identity: AccessIdentity{Email: "Contractor@partner.example", DevicePosture: managed},
+			decision: "allow", allowed: true, policy: "Engineers on managed devices",
+		},
+		"excluded": {
+			identity: AccessIdentity{Email: "former@example.com", Groups: []string{"engineering"}, DevicePosture: managed},
+			decision: "deny",
+		},
+		"denied country": {
+			identity: AccessIdentity{Email: "dev@example.com", Country: "kp", Groups: []string{"engineering"}, DevicePosture: managed},
+			decision: "deny", policy: "Block sanctioned countries",
+		},
+		"bypass comes before deny": {
+			identity: AccessIdentity{IP: net.ParseIP("192.0.2.10"), Country: "KP"},
+			decision: "bypass", allowed: true, policy: "Health checks",
+		},
+		"service token": {
+			identity: AccessIdentity{ServiceTokenID: "ci-token"},
+			decision: "non_identity", allowed: true, policy: "CI",
+		},
+		"unknown service token": {
+			identity: AccessIdentity{ServiceTokenID: "other"},
+			decision: "deny",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := e.Evaluate(tc.identity)
+			assert.Equal(t, tc.decision, result.Decision)
+			assert.Equal(t, tc.allowed, result.Allowed)
+			if tc.policy == "" {
+				assert.Nil(t, result.Policy)
+			} else if assert.NotNil(t, result.Policy) {
+				assert.Equal(t, tc.policy, result.Policy.Name)
+			}
+		})
+	}
+}
+
+func TestAccessPolicyEvaluator_Explain(t *testing.T) {
+	e := newTestAccessPolicyEvaluator(t)
+
+	result := e.Evaluate(AccessIdentity{Email: "dev@example.com", Groups: []string{"engineering"}, IdentityProviderID: "okta"})
+	assert.Equal(t, `deny: no policy matched, indeterminate as some rules cannot be evaluated offline
+  bypass policy "Health checks": no include rule matched
+  non_identity policy "CI": no include rule matched
+  deny policy "Block sanctioned countries": no include rule matched
+  allow policy "Engineers on managed devices": require rule device_posture disk-encryption did not match
+  allow policy "Webhook": include rule external_evaluation https://example.com/evaluate (cannot be evaluated offline) is indeterminate`, result.String())
+	assert.True(t, result.Indeterminate)
+
+	webhook := result.Policies[4]
+	if assert.Len(t, webhook.Rules, 1) {
+		assert.Equal(t, "include rule external_evaluation https://example.com/evaluate (cannot be evaluated offline) is indeterminate", webhook.Rules[0].String())
+	}
+
+	result = e.Evaluate(AccessIdentity{Email: "dev@example.com", Groups: []string{"engineering"}, IdentityProviderID: "okta", DevicePosture: map[string]bool{"disk-encryption": true}})
+	assert.Equal(t, `allow: policy "Engineers on managed devices" (precedence 2) matched
+  bypass policy "Health checks": no include rule matched
+  non_identity policy "CI": no include rule matched
+  deny policy "Block sanctioned countries": no include rule matched
+  allow policy "Engineers on managed devices": include rule group "Engineers" (include rule email_domain example.com matched) matched`, result.String())
+}
+
+func TestAccessPolicyEvaluator_Indeterminate(t *testing.T) {
+	policies := decodeTestAccessPolicies(t, `[
+		{
+			"name": "Risky users",
+			"decision": "deny",
+			"precedence": 1,
+			"include": [{"everyone": {}}],
+			"require": [{"future_rule": {"score": 80}}]
+		},
+		{
+			"name": "Staff",
+			"decision": "allow",
+			"precedence": 2,
+			"include": [{"email_domain": {"domain": "example.com"}}],
+			"exclude": [{"external_evaluation": {"evaluate_url": "https://example.com/evaluate", "keys_url": "https://example.com/keys"}}]
+		},
+		{
+			"name": "Admins",
+			"decision": "allow",
+			"precedence": 3,
+			"include": [{"email": {"email": "admin@example.com"}}]
+		}
+	]`)
+	e := NewAccessPolicyEvaluator(AccessApplication{}, policies, nil)
+
+	// A deny policy which may match denies access.
+	result := e.Evaluate(AccessIdentity{Email: "dev@example.com"})
+	assert.Equal(t, AccessPolicyDecisionDeny, result.Decision)
+	assert.False(t, result.Allowed)
+	assert.True(t, result.Indeterminate)
+	assert.Equal(t, `deny: policy "Risky users" (precedence 1) may match, indeterminate as some rules cannot be evaluated offline
+  deny policy "Risky users": require rule future_rule (cannot be evaluated offline) is indeterminate`, result.String())
+
+	// An allow policy which may be excluded is skipped.
+	e.Policies = e.Policies[1:]
+	result = e.Evaluate(AccessIdentity{Email: "dev@example.com"})
+	assert.False(t, result.Allowed)
+	assert.True(t, result.Indeterminate)
+	assert.True(t, result.Policies[0].Indeterminate)
+
+	result = e.Evaluate(AccessIdentity{Email: "admin@example.com"})
+	assert.True(t, result.Allowed)
+	assert.Equal(t, "Admins", result.Policy.Name)
+
+	// A determinate exclude rule still decides on its own.
+	result = e.Evaluate(AccessIdentity{Email: "dev@other.example"})
+	assert.False(t, result.Policies[0].Indeterminate)
+}
+
+func TestAccessPolicyEvaluator_CircularGroups(t *testing.T) {
+	var groups []AccessGroup
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"id": "a", "name": "A", "include": [{"group": {"id": "b"}}]},
+		{"id": "b", "name": "B", "include": [{"group": {"id": "a"}}]}
+	]`), &groups))
+
+	policies := decodeTestAccessPolicies(t, `[{"name": "Loop", "decision": "allow", "include": [{"group": {"id": "a"}}]}]`)
+	e := NewAccessPolicyEvaluator(AccessApplication{}, policies, groups)
+
+	result := e.Evaluate(AccessIdentity{Email: "dev@example.com"})
+	assert.False(t, result.Allowed)
+	assert.Equal(t, `include rule group "A" (no include rule matched) did not match`, result.Policies[0].Rules[0].String())
+}
+
+func TestAccessPolicyEvaluatorFromApplication(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/apps/480f4f69-1a28-4fdd-9240-1ed29f0ac1db", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "480f4f69-1a28-4fdd-9240-1ed29f0ac1db", "name": "Admin"}}`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/apps/480f4f69-1a28-4fdd-9240-1ed29f0ac1db/policies", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		if r.URL.Query().Get("page") == "1" {
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result_info": {"page": 1, "total_pages": 2}, "result": [
+				{"id": "p1", "name": "Contractors", "decision": "allow", "precedence": 1, "include": [{"email_list": {"id": "contractors"}}]}
+			]}`)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result_info": {"page": 2, "total_pages": 2}, "result": [
+			{"id": "p2", "name": "Engineers", "decision": "allow", "precedence": 2, "include": [{"group": {"id": "engineers"}}]}
+		]}`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/groups", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result_info": {"page": 1, "total_pages": 1}, "result": [
+			{"id": "engineers", "name": "Engineers", "include": [{"email_domain": {"domain": "example.com"}}]}
+		]}`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/gateway/lists/contractors/items", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		if r.URL.Query().Get("page") == "1" {
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result_info": {"page": 1, "total_pages": 2}, "result": [
+				{"value": "contractor@partner.example"}
+			]}`)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result_info": {"page": 2, "total_pages": 2}, "result": [
+			{"value": "intern@partner.example"}
+		]}`)
+	})
+
+	e, err := client.AccessPolicyEvaluator(context.Background(), testAccountID, "480f4f69-1a28-4fdd-9240-1ed29f0ac1db")
+	if assert.NoError(t, err) {
+		assert.Len(t, e.Policies, 2)
+		assert.Equal(t, map[string][]string{"contractors": {"contractor@partner.example", "intern@partner.example"}}, e.Lists)
+
+		assert.True(t, e.Evaluate(AccessIdentity{Email: "dev@example.com"}).Allowed)
+		assert.True(t, e.Evaluate(AccessIdentity{Email: "contractor@partner.example"}).Allowed)
+		assert.True(t, e.Evaluate(AccessIdentity{Email: "intern@partner.example"}).Allowed)
+		assert.False(t, e.Evaluate(AccessIdentity{Email: "someone@elsewhere.example"}).Allowed)
+	}
+}
@@ -0,0 +1,281 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// AccessPolicyRule is a single rule in the include, exclude or require list
+// of an Access policy or group. It is implemented by the AccessGroup* types,
+// so a decoded rule can be inspected with a type switch:
+//
+//	switch r := rule.(type) {
+//	case AccessGroupEmail:
+//		fmt.Println(r.Email.Email)
+//	case AccessGroupIP:
+//		fmt.Println(r.IP.IP)
+//	}
+type AccessPolicyRule interface {
+	// AccessPolicyRuleType returns the kind of the rule, which is the key
+	// it is encoded under, such as "email" or "ip".
+	AccessPolicyRuleType() string
+}
+
+// AccessPolicyRules is a list of Access policy rules which decodes every
+// rule into its typed representation. Rules of a kind this library does not
+// know about, or with fields their typed representation does not hold,
+// decode to AccessGroupUnknown so they survive being written back.
+type AccessPolicyRules []AccessPolicyRule
+
+// AccessGroupEmailList is used for managing access based on an Access list
+// of email addresses.
+type AccessGroupEmailList struct {
+	EmailList struct {
+		ID string `json:"id"`
+	} `json:"email_list"`
+}
+
+// AccessGroupIPList is used for managing access based on an Access list of
+// IPs or CIDRs.
+type AccessGroupIPList struct {
+	IPList struct {
+		ID string `json:"id"`
+	} `json:"ip_list"`
+}
+
+// AccessGroupExternalEvaluation is used for managing access based on the
+// response of an external endpoint.
+type AccessGroupExternalEvaluation struct {
+	ExternalEvaluation struct {
+		EvaluateURL string `json:"evaluate_url"`
+		KeysURL     string `json:"keys_url"`
+	} `json:"external_evaluation"`
+}
+
+// AccessGroupUnknown holds a rule of a kind not known to this library, or a
+// rule of a known kind carrying fields its typed representation would drop.
+// The rule is encoded back exactly as it was received.
+type AccessGroupUnknown struct {
+	Type string
+	Raw  json.RawMessage
+	// Rule is the typed representation of a rule of a known kind, without
+	// the extra fields. It is nil for unknown kinds.
+	Rule AccessPolicyRule
+}
+
+// MarshalJSON returns the rule as it was received.
+func (r AccessGroupUnknown) MarshalJSON() ([]byte, error) {
+	if len(r.Raw) == 0 {
+		return nil, errors.Errorf("access policy rule %q has no value", r.Type)
+	}
+	return r.Raw, nil
+}
+
+// accessRuleTypes maps the key each kind of rule is encoded under to its type.
+var accessRuleTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, rule := range []AccessPolicyRule{
+		AccessGroupEmail{},
+		AccessGroupEmailList{},
+		AccessGroupEmailDomain{},
+		AccessGroupIP{},
+		AccessGroupIPList{},
+		AccessGroupGeo{},
+		AccessGroupEveryone{},
+		AccessGroupServiceToken{},
+		AccessGroupAnyValidServiceToken{},
+		AccessGroupAccessGroup{},
+		AccessGroupCertificate{},
+		AccessGroupCertificateCommonName{},
+		AccessGroupGSuite{},
+		AccessGroupGitHub{},
+		AccessGroupAzure{},
+		AccessGroupOkta{},
+		AccessGroupSAML{},
+		AccessGroupAuthMethod{},
+		AccessGroupLoginMethod{},
+		AccessGroupDevicePosture{},
+		AccessGroupExternalEvaluation{},
+	} {
+		accessRuleTypes[rule.AccessPolicyRuleType()] = reflect.TypeOf(rule)
+	}
+}
+
+// UnmarshalAccessPolicyRule decodes a single rule into its typed
+// representation.
+func UnmarshalAccessPolicyRule(data []byte) (AccessPolicyRule, error) {
+	var kinds map[string]json.RawMessage
+	if err := json.Unmarshal(data, &kinds); err != nil {
+		return nil, err
+	}
+	if len(kinds) != 1 {
+		return nil, errors.Errorf("access policy rule must have exactly one kind, got %d", len(kinds))
+	}
+
+	var kind string
+	for k := range kinds {
+		kind = k
+	}
+
+	t, ok := accessRuleTypes[kind]
+	if !ok {
+		return AccessGroupUnknown{Type: kind, Raw: append(json.RawMessage{}, data...)}, nil
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s access policy rule", kind)
+	}
+	rule := v.Elem().Interface().(AccessPolicyRule)
+
+	encoded, err := json.Marshal(rule)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %s access policy rule", kind)
+	}
+	var original, typed interface{}
+	if err := json.Unmarshal(data, &original); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &typed); err != nil {
+		return nil, err
+	}
+	if jsonDropsFields(original, typed) {
+		return AccessGroupUnknown{Type: kind, Raw: append(json.RawMessage{}, data...), Rule: rule}, nil
+	}
+
+	return rule, nil
+}
+
+// jsonDropsFields reports whether any object key of original, at any depth,
+// is missing from encoded.
+func jsonDropsFields(original, encoded interface{}) bool {
+	switch o := original.(type) {
+	case map[string]interface{}:
+		e, ok := encoded.(map[string]interface{})
+		if !ok {
+			return len(o) > 0
+		}
+		for k, v := range o {
+			ev, ok := e[k]
+			if !ok || jsonDropsFields(v, ev) {
+				return true
+			}
+		}
+	case []interface{}:
+		e, ok := encoded.([]interface{})
+		if !ok || len(e) != len(o) {
+			return len(o) > 0
+		}
+		for i := range o {
+			if jsonDropsFields(o[i], e[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typedAccessPolicyRule returns the typed representation of a rule kept raw
+// for its extra fields, or the rule itself.
+func typedAccessPolicyRule(rule AccessPolicyRule) AccessPolicyRule {
+	if u, ok := rule.(AccessGroupUnknown); ok && u.Rule != nil {
+		return u.Rule
+	}
+	return rule
+}
+
+// UnmarshalJSON decodes every rule in the list into its typed
+// representation.
+func (r *AccessPolicyRules) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*r = nil
+		return nil
+	}
+
+	rules := make(AccessPolicyRules, 0, len(raw))
+	for _, b := range raw {
+		rule, err := UnmarshalAccessPolicyRule(b)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	*r = rules
+
+	return nil
+}
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupEmail) AccessPolicyRuleType() string { return "email" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupEmailList) AccessPolicyRuleType() string { return "email_list" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupEmailDomain) AccessPolicyRuleType() string { return "email_domain" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupIP) AccessPolicyRuleType() string { return "ip" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupIPList) AccessPolicyRuleType() string { return "ip_list" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupGeo) AccessPolicyRuleType() string { return "geo" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupEveryone) AccessPolicyRuleType() string { return "everyone" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupServiceToken) AccessPolicyRuleType() string { return "service_token" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupAnyValidServiceToken) AccessPolicyRuleType() string {
+	return "any_valid_service_token"
+}
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupAccessGroup) AccessPolicyRuleType() string { return "group" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupCertificate) AccessPolicyRuleType() string { return "certificate" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupCertificateCommonName) AccessPolicyRuleType() string { return "common_name" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupGSuite) AccessPolicyRuleType() string { return "gsuite" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupGitHub) AccessPolicyRuleType() string { return "github-organization" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupAzure) AccessPolicyRuleType() string { return "azureAD" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupOkta) AccessPolicyRuleType() string { return "okta" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupSAML) AccessPolicyRuleType() string { return "saml" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupAuthMethod) AccessPolicyRuleType() string { return "auth_method" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupLoginMethod) AccessPolicyRuleType() string { return "login_method" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupDevicePosture) AccessPolicyRuleType() string { return "device_posture" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (AccessGroupExternalEvaluation) AccessPolicyRuleType() string { return "external_evaluation" }
+
+// AccessPolicyRuleType implements AccessPolicyRule.
+func (r AccessGroupUnknown) AccessPolicyRuleType() string { return r.Type }
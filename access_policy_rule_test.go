@@ -0,0 +1,121 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessPolicyRules_RoundTrip(t *testing.T) {
+	rules := `[
+		{"email": {"email": "test@example.com"}},
+		{"email_list": {"id": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f"}},
+		{"email_domain": {"domain": "example.com"}},
+		{"ip": {"ip": "192.0.2.0/24"}},
+		{"ip_list": {"id": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f"}},
+		{"geo": {"country_code": "US"}},
+		{"everyone": {}},
+		{"service_token": {"token_id": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f"}},
+		{"any_valid_service_token": {}},
+		{"group": {"id": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f"}},
+		{"certificate": {}},
+		{"common_name": {"common_name": "service.example.com"}},
+		{"gsuite": {"email": "devs@example.com", "identity_provider_id": "ea85612a-29c8-46c2-bacb-669d65136971"}},
+		{"github-organization": {"name": "example", "team": "devs", "identity_provider_id": "ea85612a-29c8-46c2-bacb-669d65136971"}},
+		{"azureAD": {"id": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f", "identity_provider_id": "ea85612a-29c8-46c2-bacb-669d65136971"}},
+		{"okta": {"name": "devs", "identity_provider_id": "ea85612a-29c8-46c2-bacb-669d65136971"}},
+		{"saml": {"attribute_name": "group", "attribute_value": "devs", "identity_provider_id": "ea85612a-29c8-46c2-bacb-669d65136971"}},
+		{"auth_method": {"auth_method": "hwk"}},
+		{"login_method": {"id": "ea85612a-29c8-46c2-bacb-669d65136971"}},
+		{"device_posture": {"integration_uid": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f"}},
+		{"external_evaluation": {"evaluate_url": "https://example.com/evaluate", "keys_url": "https://example.com/keys"}},
+		{"future_rule": {"value": 1}}
+	]`
+
+	var decoded AccessPolicyRules
+	if assert.NoError(t, json.Unmarshal([]byte(rules), &decoded)) {
+		var kinds []string
+		for _, r := range decoded {
+			kinds = append(kinds, r.AccessPolicyRuleType())
+		}
+		assert.Equal(t, []string{
+			"email", "email_list", "email_domain", "ip", "ip_list", "geo",
+			"everyone", "service_token", "any_valid_service_token", "group",
+			"certificate", "common_name", "gsuite", "github-organization",
+			"azureAD", "okta", "saml", "auth_method", "login_method",
+			"device_posture", "external_evaluation", "future_rule",
+		}, kinds)
+
+		assert.IsType(t, AccessGroupEmail{}, decoded[0])
+		assert.Equal(t, "test@example.com", decoded[0].(AccessGroupEmail).Email.Email)
+		assert.Equal(t, "192.0.2.0/24", decoded[3].(AccessGroupIP).IP.IP)
+		assert.Equal(t, "devs", decoded[13].(AccessGroupGitHub).GitHubOrganization.Team)
+		assert.IsType(t, AccessGroupUnknown{}, decoded[21])
+	}
+
+	encoded, err := json.Marshal(decoded)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, rules, string(encoded))
+	}
+}
+
+func TestAccessPolicyRules_ExtraFields(t *testing.T) {
+	rules := `[
+		{"email": {"email": "test@example.com", "case_sensitive": true}},
+		{"service_token": {"token_id": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f", "name": "ci"}},
+		{"ip": {"ip": "192.0.2.0/24"}}
+	]`
+
+	var decoded AccessPolicyRules
+	if assert.NoError(t, json.Unmarshal([]byte(rules), &decoded)) {
+		if assert.IsType(t, AccessGroupUnknown{}, decoded[0]) {
+			assert.Equal(t, "email", decoded[0].AccessPolicyRuleType())
+			assert.Equal(t, "test@example.com", decoded[0].(AccessGroupUnknown).Rule.(AccessGroupEmail).Email.Email)
+		}
+		token, ok := typedAccessPolicyRule(decoded[1]).(AccessGroupServiceToken)
+		if assert.True(t, ok) {
+			assert.Equal(t, "aa0a4aab-672b-4bdb-bc33-a59f1130a11f", token.ServiceToken.ID)
+		}
+		assert.IsType(t, AccessGroupIP{}, decoded[2])
+	}
+
+	encoded, err := json.Marshal(decoded)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, rules, string(encoded))
+	}
+}
+
+func TestAccessPolicyRules_Invalid(t *testing.T) {
+	var decoded AccessPolicyRules
+	assert.EqualError(t, json.Unmarshal([]byte(`[{"email": {"email": "a@example.com"}, "ip": {"ip": "192.0.2.1"}}]`), &decoded),
+		"access policy rule must have exactly one kind, got 2")
+	assert.Error(t, json.Unmarshal([]byte(`[{"ip": "192.0.2.1"}]`), &decoded))
+
+	assert.NoError(t, json.Unmarshal([]byte(`null`), &decoded))
+	assert.Nil(t, decoded)
+}
+
+func TestAccessPolicy_TypedRules(t *testing.T) {
+	var policy AccessPolicy
+	err := json.Unmarshal([]byte(`{
+		"name": "Allow devs",
+		"decision": "allow",
+		"include": [{"email_domain": {"domain": "example.com"}}],
+		"exclude": [{"geo": {"country_code": "KP"}}],
+		"require": [{"device_posture": {"integration_uid": "aa0a4aab-672b-4bdb-bc33-a59f1130a11f"}}]
+	}`), &policy)
+
+	if assert.NoError(t, err) {
+		include := AccessGroupEmailDomain{}
+		include.EmailDomain.Domain = "example.com"
+		exclude := AccessGroupGeo{}
+		exclude.Geo.CountryCode = "KP"
+		require := AccessGroupDevicePosture{}
+		require.DevicePosture.ID = "aa0a4aab-672b-4bdb-bc33-a59f1130a11f"
+
+		assert.Equal(t, AccessPolicyRules{include}, policy.Include)
+		assert.Equal(t, AccessPolicyRules{exclude}, policy.Exclude)
+		assert.Equal(t, AccessPolicyRules{require}, policy.Require)
+	}
+}
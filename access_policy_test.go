@@ -30,14 +30,20 @@ var (
 		CreatedAt:  &createdAt,
 		UpdatedAt:  &updatedAt,
 		Name:       "Allow devs",
-		Include: []interface{}{
-			map[string]interface{}{"email": map[string]interface{}{"email": "test@example.com"}},
+		Include: []AccessPolicyRule{
+			AccessGroupEmail{struct {
+				Email string `json:"email"`
+			}{Email: "test@example.com"}},
 		},
-		Exclude: []interface{}{
-			map[string]interface{}{"email": map[string]interface{}{"email": "test@example.com"}},
+		Exclude: []AccessPolicyRule{
+			AccessGroupEmail{struct {
+				Email string `json:"email"`
+			}{Email: "test@example.com"}},
 		},
-		Require: []interface{}{
-			map[string]interface{}{"email": map[string]interface{}{"email": "test@example.com"}},
+		Require: []AccessPolicyRule{
+			AccessGroupEmail{struct {
+				Email string `json:"email"`
+			}{Email: "test@example.com"}},
 		},
 		PurposeJustificationRequired: &purposeJustificationRequired,
 		ApprovalRequired:             &approvalRequired,
@@ -270,17 +276,17 @@ func TestCreateAccessPolicy(t *testing.T) {
 
 	accessPolicy := AccessPolicy{
 		Name: "Allow devs",
-		Include: []interface{}{
+		Include: []AccessPolicyRule{
 			AccessGroupEmail{struct {
 				Email string `json:"email"`
 			}{Email: "test@example.com"}},
 		},
-		Exclude: []interface{}{
+		Exclude: []AccessPolicyRule{
 			AccessGroupEmail{struct {
 				Email string `json:"email"`
 			}{Email: "test@example.com"}},
 		},
-		Require: []interface{}{
+		Require: []AccessPolicyRule{
 			AccessGroupEmail{struct {
 				Email string `json:"email"`
 			}{Email: "test@example.com"}},
@@ -215,3 +215,71 @@ func (api *API) deleteAccessServiceToken(ctx context.Context, id, uuid string, r
 
 	return accessServiceTokenUpdate.Result, nil
 }
+
+// RefreshAccessServiceToken extends the expiry of an Access Service Token for
+// an account, keeping its client ID and secret.
+//
+// API reference: https://api.cloudflare.com/#access-service-tokens-refresh-a-service-token
+func (api *API) RefreshAccessServiceToken(ctx context.Context, accountID, id string) (AccessServiceTokenUpdateResponse, error) {
+	return api.refreshAccessServiceToken(ctx, accountID, id, AccountRouteRoot)
+}
+
+// RefreshZoneLevelAccessServiceToken extends the expiry of an Access Service
+// Token for a zone, keeping its client ID and secret.
+//
+// API reference: https://api.cloudflare.com/#zone-level-access-service-tokens-refresh-a-service-token
+func (api *API) RefreshZoneLevelAccessServiceToken(ctx context.Context, zoneID, id string) (AccessServiceTokenUpdateResponse, error) {
+	return api.refreshAccessServiceToken(ctx, zoneID, id, ZoneRouteRoot)
+}
+
+func (api *API) refreshAccessServiceToken(ctx context.Context, id, uuid string, routeRoot RouteRoot) (AccessServiceTokenUpdateResponse, error) {
+	uri := fmt.Sprintf("/%s/%s/access/service_tokens/%s/refresh", routeRoot, id, uuid)
+
+	res, err := api.makeRequestContext(ctx, http.MethodPost, uri, nil)
+	if err != nil {
+		return AccessServiceTokenUpdateResponse{}, err
+	}
+
+	var accessServiceTokenRefresh AccessServiceTokensUpdateDetailResponse
+	err = json.Unmarshal(res, &accessServiceTokenRefresh)
+	if err != nil {
+		return AccessServiceTokenUpdateResponse{}, errors.Wrap(err, errUnmarshalError)
+	}
+
+	return accessServiceTokenRefresh.Result, nil
+}
+
+// RotateAccessServiceToken generates a new client secret for an Access
+// Service Token for an account. The previous secret stops working
+// immediately.
+//
+// API reference: https://api.cloudflare.com/#access-service-tokens-rotate-a-service-token
+func (api *API) RotateAccessServiceToken(ctx context.Context, accountID, id string) (AccessServiceTokenCreateResponse, error) {
+	return api.rotateAccessServiceToken(ctx, accountID, id, AccountRouteRoot)
+}
+
+// RotateZoneLevelAccessServiceToken generates a new client secret for an
+// Access Service Token for a zone. The previous secret stops working
+// immediately.
+//
+// API reference: https://api.cloudflare.com/#zone-level-access-service-tokens-rotate-a-service-token
+func (api *API) RotateZoneLevelAccessServiceToken(ctx context.Context, zoneID, id string) (AccessServiceTokenCreateResponse, error) {
+	return api.rotateAccessServiceToken(ctx, zoneID, id, ZoneRouteRoot)
+}
+
+func (api *API) rotateAccessServiceToken(ctx context.Context, id, uuid string, routeRoot RouteRoot) (AccessServiceTokenCreateResponse, error) {
+	uri := fmt.Sprintf("/%s/%s/access/service_tokens/%s/rotate", routeRoot, id, uuid)
+
+	res, err := api.makeRequestContext(ctx, http.MethodPost, uri, nil)
+	if err != nil {
+		return AccessServiceTokenCreateResponse{}, err
+	}
+
+	var accessServiceTokenRotation AccessServiceTokensCreationDetailResponse
+	err = json.Unmarshal(res, &accessServiceTokenRotation)
+	if err != nil {
+		return AccessServiceTokenCreateResponse{}, errors.Wrap(err, errUnmarshalError)
+	}
+
+	return accessServiceTokenRotation.Result, nil
+}
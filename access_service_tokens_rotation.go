@@ -0,0 +1,361 @@
+package cloudflare
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AccessServiceTokenScope is the account or zone an Access Service Token
+// belongs to.
+type AccessServiceTokenScope struct {
+	RouteRoot RouteRoot
+	ID        string
+}
+
+// ExpiringAccessServiceToken is a service token along with its scope.
+type ExpiringAccessServiceToken struct {
+	AccessServiceToken
+	Scope AccessServiceTokenScope
+}
+
+// ExpiringAccessServiceTokens returns the service tokens of the given
+// accounts and zones which expire within the window, soonest first. Tokens
+// which have already expired are included.
+func (api *API) ExpiringAccessServiceTokens(ctx context.Context, window time.Duration, scopes ...AccessServiceTokenScope) ([]ExpiringAccessServiceToken, error) {
+	deadline := time.Now().Add(window)
+
+	var expiring []ExpiringAccessServiceToken
+	for _, scope := range scopes {
+		tokens, _, err := api.accessServiceTokens(ctx, scope.ID, scope.RouteRoot)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list service tokens of %s %s", scope.RouteRoot, scope.ID)
+		}
+
+		for _, t := range tokens {
+			if t.ExpiresAt != nil && t.ExpiresAt.Before(deadline) {
+				expiring = append(expiring, ExpiringAccessServiceToken{AccessServiceToken: t, Scope: scope})
+			}
+		}
+	}
+
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].ExpiresAt.Before(*expiring[j].ExpiresAt)
+	})
+
+	return expiring, nil
+}
+
+// AccessServiceTokenSink receives the credentials of a replacement service
+// token, for example to store them in a secrets manager.
+type AccessServiceTokenSink func(ctx context.Context, token AccessServiceTokenCreateResponse) error
+
+// AccessServiceTokenReplacement configures ReplaceAccessServiceToken.
+type AccessServiceTokenReplacement struct {
+	Scope AccessServiceTokenScope
+	// TokenID is the ID of the token being replaced.
+	TokenID string
+	// Name of the replacement token. Defaults to the name of the old token.
+	Name string
+	// Sink receives the credentials of the replacement token.
+	Sink AccessServiceTokenSink
+	// GracePeriod is how long both tokens are accepted for before the old
+	// token is removed, giving clients time to pick up the new credentials.
+	GracePeriod time.Duration
+}
+
+// AccessServiceTokenReplacementResult describes the outcome of
+// ReplaceAccessServiceToken.
+type AccessServiceTokenReplacementResult struct {
+	Token AccessServiceTokenCreateResponse
+	// Policies and Groups are the policies and groups which referenced the
+	// old token and now reference the replacement.
+	Policies []AccessPolicy
+	Groups   []AccessGroup
+	// Deleted reports whether the old token was deleted.
+	Deleted bool
+}
+
+// ReplaceAccessServiceToken replaces a service token with a new one:
+//
+//  1. a replacement token is created and handed to the sink,
+//  2. every Access policy and group referencing the old token is updated to
+//     also accept the replacement,
+//  3. after the grace period the old token is removed from those policies
+//     and groups and deleted.
+//
+// Require rules must all match, so a require rule for the old token is
+// replaced during the grace period by a rule for a temporary Access group
+// including both tokens. The group is swapped for the replacement token and
+// deleted in the last step.
+//
+// If the sink returns an error the replacement is deleted and nothing else
+// is changed. Cancelling the context during the grace period leaves both
+// tokens, and the temporary group, in place.
+func (api *API) ReplaceAccessServiceToken(ctx context.Context, r AccessServiceTokenReplacement) (AccessServiceTokenReplacementResult, error) {
+	if r.Sink == nil {
+		return AccessServiceTokenReplacementResult{}, errors.New("a sink for the replacement token must be provided")
+	}
+
+	tokens, _, err := api.accessServiceTokens(ctx, r.Scope.ID, r.Scope.RouteRoot)
+	if err != nil {
+		return AccessServiceTokenReplacementResult{}, err
+	}
+
+	var old *AccessServiceToken
+	for i := range tokens {
+		if tokens[i].ID == r.TokenID {
+			old = &tokens[i]
+		}
+	}
+	if old == nil {
+		return AccessServiceTokenReplacementResult{}, errors.Errorf("service token %s not found", r.TokenID)
+	}
+
+	name := r.Name
+	if name == "" {
+		name = old.Name
+	}
+
+	token, err := api.createAccessServiceToken(ctx, r.Scope.ID, name, r.Scope.RouteRoot)
+	if err != nil {
+		return AccessServiceTokenReplacementResult{}, errors.Wrap(err, "failed to create replacement service token")
+	}
+	result := AccessServiceTokenReplacementResult{Token: token}
+
+	if err := r.Sink(ctx, token); err != nil {
+		if _, deleteErr := api.deleteAccessServiceToken(ctx, r.Scope.ID, token.ID, r.Scope.RouteRoot); deleteErr != nil {
+			return result, errors.Wrapf(err, "sink failed and replacement service token %s could not be deleted: %s", token.ID, deleteErr)
+		}
+		return AccessServiceTokenReplacementResult{}, errors.Wrap(err, "sink failed")
+	}
+
+	swap := &accessServiceTokenSwap{oldID: old.ID, oldName: old.Name, newID: token.ID, keepOld: true}
+	if err := api.replaceAccessServiceTokenReferences(ctx, r.Scope, swap, &result); err != nil {
+		return result, err
+	}
+
+	if r.GracePeriod > 0 {
+		timer := time.NewTimer(r.GracePeriod)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return result, errors.Wrap(ctx.Err(), "grace period interrupted, both service tokens remain valid")
+		}
+	}
+
+	swap.keepOld = false
+	if err := api.replaceAccessServiceTokenReferences(ctx, r.Scope, swap, nil); err != nil {
+		return result, err
+	}
+	if swap.groupID != "" {
+		if err := api.deleteAccessGroup(ctx, r.Scope.ID, swap.groupID, r.Scope.RouteRoot); err != nil {
+			return result, errors.Wrapf(err, "failed to delete group %s", swap.groupID)
+		}
+	}
+
+	if _, err := api.deleteAccessServiceToken(ctx, r.Scope.ID, old.ID, r.Scope.RouteRoot); err != nil {
+		return result, errors.Wrapf(err, "failed to delete service token %s", old.ID)
+	}
+	result.Deleted = true
+
+	return result, nil
+}
+
+// accessServiceTokenSwap is the state of a service token replacement.
+type accessServiceTokenSwap struct {
+	oldID, oldName, newID string
+	// keepOld is set during the grace period, while both tokens are
+	// accepted.
+	keepOld bool
+	// groupID is the temporary group including both tokens which stands in
+	// for the old token in require lists during the grace period.
+	groupID string
+}
+
+// replaceAccessServiceTokenReferences updates the policies and groups of a
+// scope which reference the old token. Updated policies and groups are
+// recorded in result, if given.
+func (api *API) replaceAccessServiceTokenReferences(ctx context.Context, scope AccessServiceTokenScope, swap *accessServiceTokenSwap, result *AccessServiceTokenReplacementResult) error {
+	for page := 1; ; page++ {
+		groups, info, err := api.accessGroups(ctx, scope.ID, PaginationOptions{Page: page, PerPage: 50}, scope.RouteRoot)
+		if err != nil {
+			return err
+		}
+
+		for _, g := range groups {
+			if g.ID == swap.groupID {
+				continue
+			}
+			if err := api.prepareAccessServiceTokenGroup(ctx, scope, swap, g.Require); err != nil {
+				return err
+			}
+
+			var changed [3]bool
+			g.Include, changed[0] = swap.replace(g.Include, false)
+			g.Exclude, changed[1] = swap.replace(g.Exclude, false)
+			g.Require, changed[2] = swap.replace(g.Require, true)
+			if changed == [3]bool{} {
+				continue
+			}
+
+			updated, err := api.updateAccessGroup(ctx, scope.ID, g, scope.RouteRoot)
+			if err != nil {
+				return errors.Wrapf(err, "failed to update group %s", g.ID)
+			}
+			if result != nil {
+				result.Groups = append(result.Groups, updated)
+			}
+		}
+
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+
+	for page := 1; ; page++ {
+		apps, info, err := api.accessApplications(ctx, scope.ID, PaginationOptions{Page: page, PerPage: 50}, scope.RouteRoot)
+		if err != nil {
+			return err
+		}
+
+		for _, app := range apps {
+			if err := api.replaceAccessServiceTokenPolicyReferences(ctx, scope, app.ID, swap, result); err != nil {
+				return err
+			}
+		}
+
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (api *API) replaceAccessServiceTokenPolicyReferences(ctx context.Context, scope AccessServiceTokenScope, applicationID string, swap *accessServiceTokenSwap, result *AccessServiceTokenReplacementResult) error {
+	for page := 1; ; page++ {
+		policies, info, err := api.accessPolicies(ctx, scope.ID, applicationID, PaginationOptions{Page: page, PerPage: 50}, scope.RouteRoot)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range policies {
+			if err := api.prepareAccessServiceTokenGroup(ctx, scope, swap, p.Require); err != nil {
+				return err
+			}
+
+			var changed [3]bool
+			p.Include, changed[0] = swap.replace(p.Include, false)
+			p.Exclude, changed[1] = swap.replace(p.Exclude, false)
+			p.Require, changed[2] = swap.replace(p.Require, true)
+			if changed == [3]bool{} {
+				continue
+			}
+
+			updated, err := api.updateAccessPolicy(ctx, scope.ID, applicationID, p, scope.RouteRoot)
+			if err != nil {
+				return errors.Wrapf(err, "failed to update policy %s of application %s", p.ID, applicationID)
+			}
+			if result != nil {
+				result.Policies = append(result.Policies, updated)
+			}
+		}
+
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+
+	return nil
+}
+
+// prepareAccessServiceTokenGroup creates the temporary group including both
+// tokens the first time a require list referencing the old token is found
+// during the grace period.
+func (api *API) prepareAccessServiceTokenGroup(ctx context.Context, scope AccessServiceTokenScope, swap *accessServiceTokenSwap, require AccessPolicyRules) error {
+	if !swap.keepOld || swap.groupID != "" || !accessRulesReferenceServiceToken(require, swap.oldID) {
+		return nil
+	}
+
+	group, err := api.createAccessGroup(ctx, scope.ID, AccessGroup{
+		Name:    "Service token rotation: " + swap.oldName,
+		Include: AccessPolicyRules{accessServiceTokenRule(swap.oldID), accessServiceTokenRule(swap.newID)},
+	}, scope.RouteRoot)
+	if err != nil {
+		return errors.Wrap(err, "failed to create group accepting both service tokens")
+	}
+	swap.groupID = group.ID
+
+	return nil
+}
+
+// replace updates a list of rules, reporting whether it changed. In include
+// and exclude lists a rule for the new token is added after each rule for
+// the old token during the grace period, and the rules for the old token are
+// removed afterwards. In require lists the old token is replaced by the
+// temporary group during the grace period, and the group and any remaining
+// old token by the new token afterwards.
+func (s *accessServiceTokenSwap) replace(rules AccessPolicyRules, require bool) (AccessPolicyRules, bool) {
+	var replaced AccessPolicyRules
+	changed := false
+	for _, rule := range rules {
+		switch r := typedAccessPolicyRule(rule).(type) {
+		case AccessGroupServiceToken:
+			if r.ServiceToken.ID != s.oldID {
+				break
+			}
+			changed = true
+			switch {
+			case require && s.keepOld:
+				replaced = append(replaced, accessGroupRule(s.groupID))
+			case require:
+				replaced = append(replaced, accessServiceTokenRule(s.newID))
+			case s.keepOld:
+				replaced = append(replaced, rule, accessServiceTokenRule(s.newID))
+			}
+			continue
+		case AccessGroupAccessGroup:
+			if !require || s.keepOld || s.groupID == "" || r.Group.ID != s.groupID {
+				break
+			}
+			changed = true
+			replaced = append(replaced, accessServiceTokenRule(s.newID))
+			continue
+		}
+		replaced = append(replaced, rule)
+	}
+
+	if !changed {
+		return rules, false
+	}
+	if replaced == nil {
+		replaced = AccessPolicyRules{}
+	}
+	return replaced, true
+}
+
+func accessRulesReferenceServiceToken(rules AccessPolicyRules, id string) bool {
+	for _, rule := range rules {
+		if t, ok := typedAccessPolicyRule(rule).(AccessGroupServiceToken); ok && t.ServiceToken.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func accessServiceTokenRule(id string) AccessGroupServiceToken {
+	var rule AccessGroupServiceToken
+	rule.ServiceToken.ID = id
+	return rule
+}
+
+func accessGroupRule(id string) AccessGroupAccessGroup {
+	var rule AccessGroupAccessGroup
+	rule.Group.ID = id
+	return rule
+}
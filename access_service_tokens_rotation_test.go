@@ -0,0 +1,392 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiringAccessServiceTokens(t *testing.T) {
+	setup()
+	defer teardown()
+
+	soon := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	expired := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	later := time.Now().Add(90 * 24 * time.Hour).UTC().Truncate(time.Second)
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/access/service_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{
+          "success": true,
+          "errors": [],
+          "messages": [],
+          "result": [
+            {"id": "account-soon", "name": "CI", "expires_at": "%s"},
+            {"id": "account-later", "name": "Backups", "expires_at": "%s"}
+          ]
+        }`, soon.Format(time.RFC3339), later.Format(time.RFC3339))
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/access/service_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{
+          "success": true,
+          "errors": [],
+          "messages": [],
+          "result": [
+            {"id": "zone-expired", "name": "Monitoring", "expires_at": "%s"},
+            {"id": "zone-no-expiry", "name": "Legacy"}
+          ]
+        }`, expired.Format(time.RFC3339))
+	})
+
+	tokens, err := client.ExpiringAccessServiceTokens(context.Background(), 30*24*time.Hour,
+		AccessServiceTokenScope{RouteRoot: AccountRouteRoot, ID: testAccountID},
+		AccessServiceTokenScope{RouteRoot: ZoneRouteRoot, ID: testZoneID},
+	)
+	if assert.NoError(t, err) && assert.Len(t, tokens, 2) {
+		assert.Equal(t, "zone-expired", tokens[0].ID)
+		assert.Equal(t, AccessServiceTokenScope{RouteRoot: ZoneRouteRoot, ID: testZoneID}, tokens[0].Scope)
+		assert.Equal(t, "account-soon", tokens[1].ID)
+		assert.Equal(t, AccessServiceTokenScope{RouteRoot: AccountRouteRoot, ID: testAccountID}, tokens[1].Scope)
+	}
+}
+
+// handleAccessServiceTokenCreation serves the token list and the creation of
+// the replacement token.
+func handleAccessServiceTokenCreation(t *testing.T, base, name string) {
+	mux.HandleFunc(base+"/service_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{
+              "success": true,
+              "errors": [],
+              "messages": [],
+              "result": [
+                {"id": "old-token", "name": "CI/CD token", "client_id": "old.access.example.com"},
+                {"id": "other-token", "name": "Backups", "client_id": "other.access.example.com"}
+              ]
+            }`)
+		case http.MethodPost:
+			b, err := ioutil.ReadAll(r.Body)
+			defer r.Body.Close()
+			if assert.NoError(t, err) {
+				assert.JSONEq(t, fmt.Sprintf(`{"name": %q}`, name), string(b))
+			}
+			fmt.Fprintf(w, `{
+              "success": true,
+              "errors": [],
+              "messages": [],
+              "result": {"id": "new-token-1", "name": %q, "client_id": "new.access.example.com", "client_secret": "secret"}
+            }`, name)
+		default:
+			t.Errorf("Expected method 'GET' or 'POST', got %s", r.Method)
+		}
+	})
+}
+
+// assertJSONBody checks the body of a request against the next of the
+// expected bodies.
+func assertJSONBody(t *testing.T, r *http.Request, expected []string, i *int) {
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if assert.NoError(t, err) && assert.Less(t, *i, len(expected), "unexpected request %s %s", r.Method, r.URL.Path) {
+		assert.JSONEq(t, expected[*i], string(b))
+	}
+	*i++
+}
+
+func TestReplaceAccessServiceToken(t *testing.T) {
+	setup()
+	defer teardown()
+
+	base := "/zones/" + testZoneID + "/access"
+	handleAccessServiceTokenCreation(t, base, "CI/CD token")
+
+	// The second listing of groups and policies, after the grace period,
+	// returns them as updated by the first pass.
+	groupLists, policyLists := 0, 0
+	mux.HandleFunc(base+"/groups", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			groupLists++
+			groups := `[{"id": "ci", "name": "CI", "include": [{"service_token": {"token_id": "old-token"}}]}]`
+			if groupLists > 1 {
+				groups = `[
+                  {"id": "ci", "name": "CI", "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "new-token-1"}}]},
+                  {"id": "rotation", "name": "Service token rotation: CI/CD token", "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "new-token-1"}}]}
+                ]`
+			}
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, groups)
+		case http.MethodPost:
+			created := 0
+			assertJSONBody(t, r, []string{`{
+              "created_at": null,
+              "updated_at": null,
+              "name": "Service token rotation: CI/CD token",
+              "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "new-token-1"}}],
+              "exclude": null,
+              "require": null
+            }`}, &created)
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "rotation", "name": "Service token rotation: CI/CD token"}}`)
+		default:
+			t.Errorf("Expected method 'GET' or 'POST', got %s", r.Method)
+		}
+	})
+
+	groupUpdates := 0
+	mux.HandleFunc(base+"/groups/ci", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		assertJSONBody(t, r, []string{`{
+          "id": "ci",
+          "created_at": null,
+          "updated_at": null,
+          "name": "CI",
+          "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "new-token-1"}}],
+          "exclude": null,
+          "require": null
+        }`, `{
+          "id": "ci",
+          "created_at": null,
+          "updated_at": null,
+          "name": "CI",
+          "include": [{"service_token": {"token_id": "new-token-1"}}],
+          "exclude": null,
+          "require": null
+        }`}, &groupUpdates)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "ci", "name": "CI"}}`)
+	})
+
+	groupDeleted := false
+	mux.HandleFunc(base+"/groups/rotation", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method, "Expected method 'DELETE', got %s", r.Method)
+		assert.Equal(t, 2, policyLists, "group deleted before the policies stopped using it")
+		groupDeleted = true
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "rotation"}}`)
+	})
+
+	mux.HandleFunc(base+"/apps", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": "app", "name": "Deployments"}]}`)
+	})
+	mux.HandleFunc(base+"/apps/app/policies", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		policyLists++
+		policies := `[
+          {"id": "deploy", "name": "Deploy", "decision": "non_identity", "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "other-token"}}]},
+          {"id": "admin", "name": "Admin", "decision": "non_identity", "include": [{"everyone": {}}], "require": [{"service_token": {"token_id": "old-token"}}]},
+          {"id": "users", "name": "Users", "decision": "allow", "include": [{"email_domain": {"domain": "example.com"}}]}
+        ]`
+		if policyLists > 1 {
+			policies = `[
+              {"id": "deploy", "name": "Deploy", "decision": "non_identity", "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "new-token-1"}}, {"service_token": {"token_id": "other-token"}}]},
+              {"id": "admin", "name": "Admin", "decision": "non_identity", "include": [{"everyone": {}}], "require": [{"group": {"id": "rotation"}}]},
+              {"id": "users", "name": "Users", "decision": "allow", "include": [{"email_domain": {"domain": "example.com"}}]}
+            ]`
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, policies)
+	})
+
+	deployUpdates := 0
+	mux.HandleFunc(base+"/apps/app/policies/deploy", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		assertJSONBody(t, r, []string{`{
+          "id": "deploy",
+          "precedence": 0,
+          "decision": "non_identity",
+          "created_at": null,
+          "updated_at": null,
+          "name": "Deploy",
+          "approval_groups": null,
+          "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "new-token-1"}}, {"service_token": {"token_id": "other-token"}}],
+          "exclude": null,
+          "require": null
+        }`, `{
+          "id": "deploy",
+          "precedence": 0,
+          "decision": "non_identity",
+          "created_at": null,
+          "updated_at": null,
+          "name": "Deploy",
+          "approval_groups": null,
+          "include": [{"service_token": {"token_id": "new-token-1"}}, {"service_token": {"token_id": "other-token"}}],
+          "exclude": null,
+          "require": null
+        }`}, &deployUpdates)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "deploy", "name": "Deploy"}}`)
+	})
+
+	// Require rules are ANDed, so during the grace period the old token is
+	// replaced by a group accepting either token.
+	adminUpdates := 0
+	mux.HandleFunc(base+"/apps/app/policies/admin", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		assertJSONBody(t, r, []string{`{
+          "id": "admin",
+          "precedence": 0,
+          "decision": "non_identity",
+          "created_at": null,
+          "updated_at": null,
+          "name": "Admin",
+          "approval_groups": null,
+          "include": [{"everyone": {}}],
+          "exclude": null,
+          "require": [{"group": {"id": "rotation"}}]
+        }`, `{
+          "id": "admin",
+          "precedence": 0,
+          "decision": "non_identity",
+          "created_at": null,
+          "updated_at": null,
+          "name": "Admin",
+          "approval_groups": null,
+          "include": [{"everyone": {}}],
+          "exclude": null,
+          "require": [{"service_token": {"token_id": "new-token-1"}}]
+        }`}, &adminUpdates)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "admin", "name": "Admin"}}`)
+	})
+
+	tokenDeleted := false
+	mux.HandleFunc(base+"/service_tokens/old-token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method, "Expected method 'DELETE', got %s", r.Method)
+		tokenDeleted = true
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "old-token", "name": "CI/CD token"}}`)
+	})
+
+	sink := func(ctx context.Context, token AccessServiceTokenCreateResponse) error {
+		assert.Equal(t, "secret", token.ClientSecret)
+		return nil
+	}
+	result, err := client.ReplaceAccessServiceToken(context.Background(), AccessServiceTokenReplacement{
+		Scope:       AccessServiceTokenScope{RouteRoot: ZoneRouteRoot, ID: testZoneID},
+		TokenID:     "old-token",
+		Sink:        sink,
+		GracePeriod: time.Millisecond,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "new-token-1", result.Token.ID)
+		assert.Equal(t, "CI/CD token", result.Token.Name)
+		assert.True(t, result.Deleted)
+		assert.Len(t, result.Policies, 2)
+		if assert.Len(t, result.Groups, 1) {
+			assert.Equal(t, "ci", result.Groups[0].ID)
+		}
+	}
+	assert.Equal(t, 2, groupUpdates)
+	assert.Equal(t, 2, deployUpdates)
+	assert.Equal(t, 2, adminUpdates)
+	assert.True(t, groupDeleted)
+	assert.True(t, tokenDeleted)
+}
+
+func TestReplaceAccessServiceToken_SinkFails(t *testing.T) {
+	setup()
+	defer teardown()
+
+	base := "/accounts/" + testAccountID + "/access"
+	handleAccessServiceTokenCreation(t, base, "CI/CD token v2")
+
+	deleted := false
+	mux.HandleFunc(base+"/service_tokens/new-token-1", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method, "Expected method 'DELETE', got %s", r.Method)
+		deleted = true
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "new-token-1"}}`)
+	})
+
+	_, err := client.ReplaceAccessServiceToken(context.Background(), AccessServiceTokenReplacement{
+		Scope:   AccessServiceTokenScope{RouteRoot: AccountRouteRoot, ID: testAccountID},
+		TokenID: "old-token",
+		Name:    "CI/CD token v2",
+		Sink: func(ctx context.Context, token AccessServiceTokenCreateResponse) error {
+			return errors.New("vault is sealed")
+		},
+	})
+	assert.EqualError(t, err, "sink failed: vault is sealed")
+	assert.True(t, deleted)
+
+	_, err = client.ReplaceAccessServiceToken(context.Background(), AccessServiceTokenReplacement{
+		Scope:   AccessServiceTokenScope{RouteRoot: AccountRouteRoot, ID: testAccountID},
+		TokenID: "missing",
+		Sink:    func(ctx context.Context, token AccessServiceTokenCreateResponse) error { return nil },
+	})
+	assert.EqualError(t, err, "service token missing not found")
+}
+
+func TestReplaceAccessServiceToken_Cancelled(t *testing.T) {
+	setup()
+	defer teardown()
+
+	base := "/accounts/" + testAccountID + "/access"
+	handleAccessServiceTokenCreation(t, base, "CI/CD token")
+
+	mux.HandleFunc(base+"/groups", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": []}`)
+	})
+	mux.HandleFunc(base+"/apps", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": "app", "name": "Deployments"}]}`)
+	})
+	mux.HandleFunc(base+"/apps/app/policies", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+          "success": true,
+          "errors": [],
+          "messages": [],
+          "result": [{"id": "deploy", "name": "Deploy", "decision": "non_identity", "include": [{"service_token": {"token_id": "old-token"}}]}]
+        }`)
+	})
+
+	updates := 0
+	mux.HandleFunc(base+"/apps/app/policies/deploy", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		assertJSONBody(t, r, []string{`{
+          "id": "deploy",
+          "precedence": 0,
+          "decision": "non_identity",
+          "created_at": null,
+          "updated_at": null,
+          "name": "Deploy",
+          "approval_groups": null,
+          "include": [{"service_token": {"token_id": "old-token"}}, {"service_token": {"token_id": "new-token-1"}}],
+          "exclude": null,
+          "require": null
+        }`}, &updates)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "deploy", "name": "Deploy"}}`)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	result, err := client.ReplaceAccessServiceToken(ctx, AccessServiceTokenReplacement{
+		Scope:       AccessServiceTokenScope{RouteRoot: AccountRouteRoot, ID: testAccountID},
+		TokenID:     "old-token",
+		Sink:        func(ctx context.Context, token AccessServiceTokenCreateResponse) error { return nil },
+		GracePeriod: time.Hour,
+	})
+	assert.EqualError(t, err, "grace period interrupted, both service tokens remain valid: context deadline exceeded")
+	assert.False(t, result.Deleted)
+	assert.Equal(t, 1, updates)
+}
@@ -0,0 +1,271 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// authenticatedOriginPullsFailedStatuses are the certificate and hostname
+// statuses from which a deployment does not recover.
+var authenticatedOriginPullsFailedStatuses = map[string]bool{
+	"deleted":              true,
+	"deployment_timed_out": true,
+	"deletion_timed_out":   true,
+	"pending_deletion":     true,
+}
+
+// AuthenticatedOriginPullsRolloutOptions configures
+// EnableAuthenticatedOriginPulls and
+// RotateAuthenticatedOriginPullsCertificate.
+type AuthenticatedOriginPullsRolloutOptions struct {
+	ZoneID string
+	// Certificate and PrivateKey are the PEM client certificate presented
+	// to the origin and its key.
+	Certificate string
+	PrivateKey  string
+	// Hostnames enables per-hostname Authenticated Origin Pulls for these
+	// hostnames. When empty the certificate is uploaded for the zone and
+	// zone-level Authenticated Origin Pulls is enabled.
+	Hostnames []string
+	// PollInterval is the delay between status checks. Defaults to 5
+	// seconds.
+	PollInterval time.Duration
+	// Overlap is how long RotateAuthenticatedOriginPullsCertificate keeps
+	// the previous certificates after the new one is active.
+	Overlap time.Duration
+	// CertificateBundle is passed on to
+	// ValidateAuthenticatedOriginPullsCertificate.
+	CertificateBundle CertificateBundleOptions
+}
+
+// AuthenticatedOriginPullsHostnameState is the outcome of a rollout for one
+// hostname.
+type AuthenticatedOriginPullsHostnameState struct {
+	Hostname       string
+	CertID         string
+	PreviousCertID string
+	Enabled        bool
+	Status         string
+	Err            error
+}
+
+// AuthenticatedOriginPullsRollout is the outcome of a rollout.
+type AuthenticatedOriginPullsRollout struct {
+	// CertID is the uploaded certificate.
+	CertID string
+	// Hostnames is the state of each hostname for per-hostname rollouts.
+	Hostnames []AuthenticatedOriginPullsHostnameState
+	// ZoneEnabled is set for zone-level rollouts.
+	ZoneEnabled bool
+	// Removed are the previous certificates deleted by a rotation.
+	Removed []string
+}
+
+// Failed returns the hostnames which could not be switched to the new
+// certificate.
+func (r AuthenticatedOriginPullsRollout) Failed() []AuthenticatedOriginPullsHostnameState {
+	var failed []AuthenticatedOriginPullsHostnameState
+	for _, h := range r.Hostnames {
+		if h.Err != nil {
+			failed = append(failed, h)
+		}
+	}
+	return failed
+}
+
+// EnableAuthenticatedOriginPulls validates and uploads a client
+// certificate, waits for it to become active and enables Authenticated
+// Origin Pulls with it for opts.Hostnames, or for the zone. Problems with
+// individual hostnames are reported in their state rather than as an error.
+func (api *API) EnableAuthenticatedOriginPulls(ctx context.Context, opts AuthenticatedOriginPullsRolloutOptions) (AuthenticatedOriginPullsRollout, error) {
+	if opts.ZoneID == "" {
+		return AuthenticatedOriginPullsRollout{}, errors.New("a zone ID is required")
+	}
+	if _, err := ValidateAuthenticatedOriginPullsCertificate(opts.Certificate, opts.PrivateKey, opts.CertificateBundle); err != nil {
+		return AuthenticatedOriginPullsRollout{}, err
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	if len(opts.Hostnames) == 0 {
+		return api.rolloutZoneAuthenticatedOriginPulls(ctx, opts, interval)
+	}
+	return api.rolloutHostnameAuthenticatedOriginPulls(ctx, opts, interval)
+}
+
+// RotateAuthenticatedOriginPullsCertificate replaces the client certificate
+// used for opts.Hostnames, or for the zone. The new certificate is rolled
+// out as with EnableAuthenticatedOriginPulls and the previous certificates
+// are deleted opts.Overlap later, except for those still used by a hostname
+// which failed to switch. Certificates shared with hostnames outside the
+// rollout should be rotated for all of them at once.
+func (api *API) RotateAuthenticatedOriginPullsCertificate(ctx context.Context, opts AuthenticatedOriginPullsRolloutOptions) (AuthenticatedOriginPullsRollout, error) {
+	var previous []string
+	if len(opts.Hostnames) == 0 {
+		certs, err := api.ListPerZoneAuthenticatedOriginPullsCertificates(ctx, opts.ZoneID)
+		if err != nil {
+			return AuthenticatedOriginPullsRollout{}, errors.Wrap(err, "failed to list zone certificates")
+		}
+		for _, cert := range certs {
+			previous = append(previous, cert.ID)
+		}
+	}
+
+	rollout, err := api.EnableAuthenticatedOriginPulls(ctx, opts)
+	if err != nil {
+		return rollout, err
+	}
+
+	inUse := map[string]bool{rollout.CertID: true}
+	for _, h := range rollout.Hostnames {
+		if h.PreviousCertID == "" {
+			continue
+		}
+		if h.Err != nil {
+			inUse[h.PreviousCertID] = true
+		} else if !contains(previous, h.PreviousCertID) {
+			previous = append(previous, h.PreviousCertID)
+		}
+	}
+
+	select {
+	case <-time.After(opts.Overlap):
+	case <-ctx.Done():
+		return rollout, errors.Wrap(ctx.Err(), "rotation aborted before removing previous certificates")
+	}
+
+	for _, certID := range previous {
+		if inUse[certID] {
+			continue
+		}
+		if len(opts.Hostnames) == 0 {
+			_, err = api.DeletePerZoneAuthenticatedOriginPullsCertificate(ctx, opts.ZoneID, certID)
+		} else {
+			_, err = api.DeletePerHostnameAuthenticatedOriginPullsCertificate(ctx, opts.ZoneID, certID)
+		}
+		if err != nil {
+			return rollout, errors.Wrapf(err, "failed to delete previous certificate %s", certID)
+		}
+		rollout.Removed = append(rollout.Removed, certID)
+	}
+
+	return rollout, nil
+}
+
+func (api *API) rolloutZoneAuthenticatedOriginPulls(ctx context.Context, opts AuthenticatedOriginPullsRolloutOptions, interval time.Duration) (AuthenticatedOriginPullsRollout, error) {
+	cert, err := api.UploadPerZoneAuthenticatedOriginPullsCertificate(ctx, opts.ZoneID, PerZoneAuthenticatedOriginPullsCertificateParams{
+		Certificate: opts.Certificate,
+		PrivateKey:  opts.PrivateKey,
+	})
+	if err != nil {
+		return AuthenticatedOriginPullsRollout{}, errors.Wrap(err, "failed to upload certificate")
+	}
+	rollout := AuthenticatedOriginPullsRollout{CertID: cert.ID}
+
+	err = waitForAuthenticatedOriginPullsStatus(ctx, interval, cert.Status, func() (string, error) {
+		details, err := api.GetPerZoneAuthenticatedOriginPullsCertificateDetails(ctx, opts.ZoneID, cert.ID)
+		return details.Status, err
+	})
+	if err != nil {
+		return rollout, errors.Wrapf(err, "certificate %s", cert.ID)
+	}
+
+	settings, err := api.SetPerZoneAuthenticatedOriginPullsStatus(ctx, opts.ZoneID, true)
+	if err != nil {
+		return rollout, errors.Wrap(err, "failed to enable authenticated origin pulls")
+	}
+	rollout.ZoneEnabled = settings.Enabled
+
+	return rollout, nil
+}
+
+func (api *API) rolloutHostnameAuthenticatedOriginPulls(ctx context.Context, opts AuthenticatedOriginPullsRolloutOptions, interval time.Duration) (AuthenticatedOriginPullsRollout, error) {
+	states := make([]AuthenticatedOriginPullsHostnameState, len(opts.Hostnames))
+	for i, hostname := range opts.Hostnames {
+		states[i].Hostname = hostname
+		current, err := api.GetPerHostnameAuthenticatedOriginPullsConfig(ctx, opts.ZoneID, hostname)
+		if err != nil && !isNotFound(err) {
+			return AuthenticatedOriginPullsRollout{}, errors.Wrapf(err, "failed to get configuration of %s", hostname)
+		}
+		states[i].PreviousCertID = current.CertID
+	}
+
+	cert, err := api.UploadPerHostnameAuthenticatedOriginPullsCertificate(ctx, opts.ZoneID, PerHostnameAuthenticatedOriginPullsCertificateParams{
+		Certificate: opts.Certificate,
+		PrivateKey:  opts.PrivateKey,
+	})
+	if err != nil {
+		return AuthenticatedOriginPullsRollout{}, errors.Wrap(err, "failed to upload certificate")
+	}
+	rollout := AuthenticatedOriginPullsRollout{CertID: cert.ID, Hostnames: states}
+
+	err = waitForAuthenticatedOriginPullsStatus(ctx, interval, cert.Status, func() (string, error) {
+		details, err := api.GetPerHostnameAuthenticatedOriginPullsCertificate(ctx, opts.ZoneID, cert.ID)
+		return details.Status, err
+	})
+	if err != nil {
+		return rollout, errors.Wrapf(err, "certificate %s", cert.ID)
+	}
+
+	config := make([]PerHostnameAuthenticatedOriginPullsConfig, len(opts.Hostnames))
+	for i, hostname := range opts.Hostnames {
+		config[i] = PerHostnameAuthenticatedOriginPullsConfig{Hostname: hostname, CertID: cert.ID, Enabled: true}
+	}
+	if _, err := api.EditPerHostnameAuthenticatedOriginPullsConfig(ctx, opts.ZoneID, config); err != nil {
+		return rollout, errors.Wrap(err, "failed to enable authenticated origin pulls")
+	}
+
+	for i := range states {
+		state := &states[i]
+		var details PerHostnameAuthenticatedOriginPullsDetails
+		state.Err = waitForAuthenticatedOriginPullsStatus(ctx, interval, "", func() (string, error) {
+			var err error
+			details, err = api.GetPerHostnameAuthenticatedOriginPullsConfig(ctx, opts.ZoneID, state.Hostname)
+			return details.Status, err
+		})
+		state.CertID, state.Enabled, state.Status = details.CertID, details.Enabled, details.Status
+		if state.Err == nil && (state.CertID != cert.ID || !state.Enabled) {
+			state.Err = errors.Errorf("hostname %s is not using certificate %s", state.Hostname, cert.ID)
+		}
+	}
+
+	return rollout, nil
+}
+
+// waitForAuthenticatedOriginPullsStatus polls until status returns active,
+// starting from the already known status if it is set.
+func waitForAuthenticatedOriginPullsStatus(ctx context.Context, interval time.Duration, known string, status func() (string, error)) error {
+	current := known
+	for {
+		if current == "" {
+			var err error
+			if current, err = status(); err != nil {
+				return err
+			}
+		}
+		if current == "active" {
+			return nil
+		}
+		if authenticatedOriginPullsFailedStatuses[current] {
+			return errors.Errorf("status is %s", current)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "status is still %s", current)
+		}
+		current = ""
+	}
+}
+
+// isNotFound reports whether err is an API error with status 404.
+func isNotFound(err error) bool {
+	var apiErr *APIRequestError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
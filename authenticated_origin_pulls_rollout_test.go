@@ -0,0 +1,257 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAuthenticatedOriginPullsPrefix = "/zones/" + testZoneID + "/origin_tls_client_auth"
+
+func newTestClientCertificate(t *testing.T) *testCertificate {
+	ca := newTestCA(t, "Origin Pull CA", nil)
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "origin-pull.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+}
+
+// assertAuthenticatedOriginPullsUpload checks that a certificate upload
+// carries the certificate and its key.
+func assertAuthenticatedOriginPullsUpload(t *testing.T, r *http.Request, cert *testCertificate) {
+	assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"certificate": %q, "private_key": %q}`, cert.pem, cert.keyPEM), string(body))
+}
+
+// handleAuthenticatedOriginPullsCertificate serves a certificate which is
+// active, recording its deletion in deleted.
+func handleAuthenticatedOriginPullsCertificate(t *testing.T, path, id string, deleted *[]string) {
+	mux.HandleFunc(path+"/"+id, func(w http.ResponseWriter, r *http.Request) {
+		status := "active"
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodDelete:
+			*deleted = append(*deleted, id)
+			status = "pending_deletion"
+		default:
+			t.Errorf("Expected method 'GET' or 'DELETE', got %s", r.Method)
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": %q, "status": %q}}`, id, status)
+	})
+}
+
+// handleAuthenticatedOriginPullsHostname serves the configuration of a
+// hostname. The first request returns the configuration before the
+// rollout, using previous or a 404 if it is empty. Later requests return
+// new-1, pending deployment on the first poll and then with status.
+func handleAuthenticatedOriginPullsHostname(t *testing.T, hostname, previous, status string) {
+	requests := 0
+	mux.HandleFunc(testAuthenticatedOriginPullsPrefix+"/hostnames/"+hostname, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		requests++
+		w.Header().Set("content-type", "application/json")
+
+		certID, current := "new-1", status
+		switch requests {
+		case 1:
+			if previous == "" {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"success": false, "errors": [{"code": 1400, "message": "hostname not found"}], "messages": [], "result": null}`)
+				return
+			}
+			certID, current = previous, "active"
+		case 2:
+			current = "pending_deployment"
+		}
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"hostname": %q, "cert_id": %q, "enabled": true, "status": %q}}`, hostname, certID, current)
+	})
+}
+
+// handleAuthenticatedOriginPullsHostnameRollout serves the upload of new-1
+// for hostnames and the configuration switching a.example.com and
+// b.example.com to it.
+func handleAuthenticatedOriginPullsHostnameRollout(t *testing.T, cert *testCertificate) {
+	mux.HandleFunc(testAuthenticatedOriginPullsPrefix+"/hostnames/certificates", func(w http.ResponseWriter, r *http.Request) {
+		assertAuthenticatedOriginPullsUpload(t, r, cert)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "new-1", "status": "pending_deployment"}}`)
+	})
+
+	mux.HandleFunc(testAuthenticatedOriginPullsPrefix+"/hostnames", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+      "config": [
+        {"hostname": "a.example.com", "cert_id": "new-1", "enabled": true},
+        {"hostname": "b.example.com", "cert_id": "new-1", "enabled": true}
+      ]
+    }`, string(body))
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+      "success": true,
+      "errors": [],
+      "messages": [],
+      "result": [
+        {"hostname": "a.example.com", "cert_id": "new-1", "enabled": true, "status": "pending_deployment"},
+        {"hostname": "b.example.com", "cert_id": "new-1", "enabled": true, "status": "pending_deployment"}
+      ]
+    }`)
+	})
+}
+
+// handleAuthenticatedOriginPullsZoneRollout serves the zone certificates,
+// made up of old-zone, the upload of new-1 and the zone settings. It
+// returns the number of uploads and whether the zone was enabled.
+func handleAuthenticatedOriginPullsZoneRollout(t *testing.T, cert *testCertificate) (*int, *bool) {
+	uploads, enabled := 0, false
+	mux.HandleFunc(testAuthenticatedOriginPullsPrefix, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": "old-zone", "status": "active"}]}`)
+			return
+		}
+		assertAuthenticatedOriginPullsUpload(t, r, cert)
+		uploads++
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "new-1", "status": "pending_deployment"}}`)
+	})
+
+	mux.HandleFunc(testAuthenticatedOriginPullsPrefix+"/settings", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"enabled": true}`, string(body))
+		enabled = true
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"enabled": true}}`)
+	})
+
+	return &uploads, &enabled
+}
+
+func TestEnableAuthenticatedOriginPulls_Zone(t *testing.T) {
+	setup()
+	defer teardown()
+
+	cert := newTestClientCertificate(t)
+	uploads, enabled := handleAuthenticatedOriginPullsZoneRollout(t, cert)
+	var deleted []string
+	handleAuthenticatedOriginPullsCertificate(t, testAuthenticatedOriginPullsPrefix, "new-1", &deleted)
+
+	rollout, err := client.EnableAuthenticatedOriginPulls(context.Background(), AuthenticatedOriginPullsRolloutOptions{
+		ZoneID:       testZoneID,
+		Certificate:  cert.pem,
+		PrivateKey:   cert.keyPEM,
+		PollInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, AuthenticatedOriginPullsRollout{CertID: "new-1", ZoneEnabled: true}, rollout)
+	assert.True(t, *enabled)
+	assert.Empty(t, deleted)
+
+	_, err = client.EnableAuthenticatedOriginPulls(context.Background(), AuthenticatedOriginPullsRolloutOptions{ZoneID: testZoneID, Certificate: cert.pem})
+	assert.EqualError(t, err, "a private key is required")
+	assert.Equal(t, 1, *uploads)
+}
+
+func TestEnableAuthenticatedOriginPulls_Hostnames(t *testing.T) {
+	setup()
+	defer teardown()
+
+	cert := newTestClientCertificate(t)
+	handleAuthenticatedOriginPullsHostnameRollout(t, cert)
+	var deleted []string
+	handleAuthenticatedOriginPullsCertificate(t, testAuthenticatedOriginPullsPrefix+"/hostnames/certificates", "new-1", &deleted)
+	handleAuthenticatedOriginPullsHostname(t, "a.example.com", "", "active")
+	handleAuthenticatedOriginPullsHostname(t, "b.example.com", "", "deployment_timed_out")
+	mux.HandleFunc(testAuthenticatedOriginPullsPrefix+"/settings", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	})
+
+	rollout, err := client.EnableAuthenticatedOriginPulls(context.Background(), AuthenticatedOriginPullsRolloutOptions{
+		ZoneID:       testZoneID,
+		Certificate:  cert.pem,
+		PrivateKey:   cert.keyPEM,
+		Hostnames:    []string{"a.example.com", "b.example.com"},
+		PollInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new-1", rollout.CertID)
+	assert.False(t, rollout.ZoneEnabled)
+	require.Len(t, rollout.Hostnames, 2)
+
+	a := rollout.Hostnames[0]
+	assert.NoError(t, a.Err)
+	assert.Equal(t, AuthenticatedOriginPullsHostnameState{Hostname: "a.example.com", CertID: "new-1", Enabled: true, Status: "active"}, a)
+
+	failed := rollout.Failed()
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "b.example.com", failed[0].Hostname)
+		assert.EqualError(t, failed[0].Err, "status is deployment_timed_out")
+	}
+}
+
+func TestRotateAuthenticatedOriginPullsCertificate_Hostnames(t *testing.T) {
+	setup()
+	defer teardown()
+
+	cert := newTestClientCertificate(t)
+	handleAuthenticatedOriginPullsHostnameRollout(t, cert)
+	var deleted []string
+	for _, id := range []string{"new-1", "old-1", "old-2"} {
+		handleAuthenticatedOriginPullsCertificate(t, testAuthenticatedOriginPullsPrefix+"/hostnames/certificates", id, &deleted)
+	}
+	handleAuthenticatedOriginPullsHostname(t, "a.example.com", "old-1", "active")
+	handleAuthenticatedOriginPullsHostname(t, "b.example.com", "old-2", "deployment_timed_out")
+
+	rollout, err := client.RotateAuthenticatedOriginPullsCertificate(context.Background(), AuthenticatedOriginPullsRolloutOptions{
+		ZoneID:       testZoneID,
+		Certificate:  cert.pem,
+		PrivateKey:   cert.keyPEM,
+		Hostnames:    []string{"a.example.com", "b.example.com"},
+		PollInterval: time.Millisecond,
+		Overlap:      time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "old-1", rollout.Hostnames[0].PreviousCertID)
+	assert.Equal(t, "old-2", rollout.Hostnames[1].PreviousCertID)
+
+	// b.example.com failed to switch, so its certificate is kept.
+	assert.Equal(t, []string{"old-1"}, rollout.Removed)
+	assert.Equal(t, []string{"old-1"}, deleted)
+}
+
+func TestRotateAuthenticatedOriginPullsCertificate_Zone(t *testing.T) {
+	setup()
+	defer teardown()
+
+	cert := newTestClientCertificate(t)
+	handleAuthenticatedOriginPullsZoneRollout(t, cert)
+	var deleted []string
+	for _, id := range []string{"new-1", "old-zone"} {
+		handleAuthenticatedOriginPullsCertificate(t, testAuthenticatedOriginPullsPrefix, id, &deleted)
+	}
+
+	rollout, err := client.RotateAuthenticatedOriginPullsCertificate(context.Background(), AuthenticatedOriginPullsRolloutOptions{
+		ZoneID:       testZoneID,
+		Certificate:  cert.pem,
+		PrivateKey:   cert.keyPEM,
+		PollInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new-1", rollout.CertID)
+	assert.True(t, rollout.ZoneEnabled)
+	assert.Equal(t, []string{"old-zone"}, rollout.Removed)
+	assert.Equal(t, []string{"old-zone"}, deleted)
+}
@@ -0,0 +1,317 @@
+package cloudflare
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Bundle methods for custom certificates.
+const (
+	BundleMethodUbiquitous = "ubiquitous"
+	BundleMethodOptimal    = "optimal"
+	BundleMethodForce      = "force"
+)
+
+// CertificateBundleOptions configures ParseCertificateBundle.
+type CertificateBundleOptions struct {
+	// Roots are the trusted roots used to check the chain. Defaults to the
+	// system roots.
+	Roots *x509.CertPool
+	// Now is the time used to check validity. Defaults to time.Now().
+	Now time.Time
+}
+
+// CertificateBundle is a parsed and checked certificate chain and its
+// private key.
+type CertificateBundle struct {
+	Leaf          *x509.Certificate
+	Intermediates []*x509.Certificate
+	PrivateKey    crypto.Signer
+	// Hosts are the names the certificate is valid for.
+	Hosts     []string
+	ExpiresOn time.Time
+	// Trusted reports whether the chain verifies to a trusted root.
+	Trusted bool
+	// BundleMethod is the bundle method suited to the chain: ubiquitous
+	// for publicly trusted certificates, force for certificates from
+	// private CAs which Cloudflare cannot build a chain for.
+	BundleMethod string
+	// Warnings are problems which do not prevent the upload.
+	Warnings []string
+}
+
+// ParseCertificateBundle parses a PEM certificate chain, leaf first, and
+// optionally its PEM private key. It checks that the key matches the leaf,
+// that each certificate is signed by the next one and that the leaf has not
+// expired.
+func ParseCertificateBundle(certPEM, keyPEM string, opts CertificateBundleOptions) (*CertificateBundle, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	chain, err := parseCertificateChain(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &CertificateBundle{
+		Leaf:          chain[0],
+		Intermediates: chain[1:],
+		Hosts:         certificateHosts(chain[0]),
+		ExpiresOn:     chain[0].NotAfter,
+	}
+
+	if keyPEM != "" {
+		if b.PrivateKey, err = parsePrivateKey(keyPEM); err != nil {
+			return nil, err
+		}
+		pub, ok := b.PrivateKey.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(b.Leaf.PublicKey) {
+			return nil, errors.New("private key does not match the certificate")
+		}
+	}
+
+	for i := 0; i+1 < len(chain); i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, errors.Errorf("certificate %d (%s) is not signed by the next certificate in the chain (%s); certificates must be ordered leaf first",
+				i+1, chain[i].Subject.CommonName, chain[i+1].Subject.CommonName)
+		}
+	}
+
+	if now.After(b.Leaf.NotAfter) {
+		return nil, errors.Errorf("certificate expired on %s", b.Leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Before(b.Leaf.NotBefore) {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("certificate is not valid before %s", b.Leaf.NotBefore.UTC().Format(time.RFC3339)))
+	}
+	if b.Leaf.NotAfter.Sub(now) < 30*24*time.Hour {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("certificate expires on %s", b.Leaf.NotAfter.UTC().Format(time.RFC3339)))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range b.Intermediates {
+		intermediates.AddCert(cert)
+	}
+	_, err = b.Leaf.Verify(x509.VerifyOptions{
+		Roots:         opts.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	b.Trusted = err == nil
+	b.BundleMethod = BundleMethodForce
+	if b.Trusted {
+		b.BundleMethod = BundleMethodUbiquitous
+	}
+
+	return b, nil
+}
+
+// CheckHostsInZone returns a warning for each host of the certificate which
+// does not belong to the zone.
+func (b *CertificateBundle) CheckHostsInZone(zoneName string) []string {
+	zoneName = strings.ToLower(strings.TrimSuffix(zoneName, "."))
+
+	var warnings []string
+	for _, host := range b.Hosts {
+		name := strings.TrimPrefix(strings.ToLower(host), "*.")
+		if name != zoneName && !strings.HasSuffix(name, "."+zoneName) {
+			warnings = append(warnings, fmt.Sprintf("host %s is not part of zone %s", host, zoneName))
+		}
+	}
+	return warnings
+}
+
+// parseCertificateChain parses every certificate in a PEM document.
+func parseCertificateChain(certPEM string) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.Errorf("unexpected %s in certificate chain", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse certificate %d", len(chain)+1)
+		}
+		chain = append(chain, cert)
+	}
+
+	if len(chain) == 0 {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return chain, nil
+}
+
+// parsePrivateKey parses a PEM private key in PKCS #1, PKCS #8 or SEC 1
+// form.
+func parsePrivateKey(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
+		return nil, errors.New("encrypted private keys are not supported")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse private key")
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, errors.Errorf("unsupported private key type %T", key)
+}
+
+// certificateHosts returns the DNS names and IP addresses of a certificate,
+// falling back to the common name for certificates without SANs.
+func certificateHosts(cert *x509.Certificate) []string {
+	hosts := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	if len(hosts) == 0 && cert.Subject.CommonName != "" {
+		hosts = append(hosts, cert.Subject.CommonName)
+	}
+	return hosts
+}
+
+// ValidateZoneCustomSSLOptions checks a custom certificate before it is
+// uploaded with CreateSSL or UpdateSSL. When zoneName is set, hosts outside
+// the zone are reported as warnings. An empty BundleMethod is set to the
+// method suited to the chain.
+func ValidateZoneCustomSSLOptions(options *ZoneCustomSSLOptions, zoneName string, opts CertificateBundleOptions) (*CertificateBundle, error) {
+	if options.PrivateKey == "" {
+		return nil, errors.New("a private key is required")
+	}
+
+	b, err := ParseCertificateBundle(options.Certificate, options.PrivateKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch options.BundleMethod {
+	case "":
+		options.BundleMethod = b.BundleMethod
+		if !b.Trusted {
+			b.Warnings = append(b.Warnings, "certificate does not chain to a trusted root, the uploaded chain will be used as is")
+		}
+	case BundleMethodUbiquitous, BundleMethodOptimal:
+		if !b.Trusted {
+			b.Warnings = append(b.Warnings, fmt.Sprintf("bundle method %s needs a publicly trusted certificate, consider %s", options.BundleMethod, BundleMethodForce))
+		}
+	case BundleMethodForce:
+	default:
+		return nil, errors.Errorf("unknown bundle method %q", options.BundleMethod)
+	}
+
+	if zoneName != "" {
+		b.Warnings = append(b.Warnings, b.CheckHostsInZone(zoneName)...)
+	}
+
+	return b, nil
+}
+
+// ValidateAuthenticatedOriginPullsCertificate checks a client certificate
+// and key before they are uploaded with
+// UploadPerZoneAuthenticatedOriginPullsCertificate or
+// UploadPerHostnameAuthenticatedOriginPullsCertificate. Origin pull
+// certificates are usually issued by a private CA, so the chain does not
+// need to be trusted.
+func ValidateAuthenticatedOriginPullsCertificate(certificate, privateKey string, opts CertificateBundleOptions) (*CertificateBundle, error) {
+	if privateKey == "" {
+		return nil, errors.New("a private key is required")
+	}
+
+	b, err := ParseCertificateBundle(certificate, privateKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.Leaf.ExtKeyUsage) > 0 && !hasExtKeyUsage(b.Leaf, x509.ExtKeyUsageClientAuth) {
+		return nil, errors.New("certificate cannot be used for client authentication")
+	}
+
+	return b, nil
+}
+
+// ValidateAccessMutualTLSCertificate checks that an Access mutual TLS
+// certificate is made up of CA certificates which can sign client
+// certificates before it is uploaded with CreateAccessMutualTLSCertificate.
+// Access trusts each CA in the bundle on its own, so unlike
+// ParseCertificateBundle the certificates need not form a chain: a bundle
+// of an old and a new CA is accepted. The first certificate is returned as
+// the leaf and the others as intermediates.
+func ValidateAccessMutualTLSCertificate(certificate AccessMutualTLSCertificate, opts CertificateBundleOptions) (*CertificateBundle, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	certs, err := parseCertificateChain(certificate.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &CertificateBundle{
+		Leaf:          certs[0],
+		Intermediates: certs[1:],
+		ExpiresOn:     certs[0].NotAfter,
+	}
+	for _, cert := range certs {
+		name := cert.Subject.CommonName
+		if !cert.IsCA {
+			return nil, errors.Errorf("certificate %s is not a CA certificate", name)
+		}
+		if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+			return nil, errors.Errorf("certificate %s cannot sign certificates", name)
+		}
+		if now.After(cert.NotAfter) {
+			return nil, errors.Errorf("certificate %s expired on %s", name, cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+		if cert.NotAfter.Sub(now) < 30*24*time.Hour {
+			b.Warnings = append(b.Warnings, fmt.Sprintf("certificate %s expires on %s", name, cert.NotAfter.UTC().Format(time.RFC3339)))
+		}
+		if cert.NotAfter.Before(b.ExpiresOn) {
+			b.ExpiresOn = cert.NotAfter
+		}
+	}
+
+	return b, nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package cloudflare
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	pem    string
+	keyPEM string
+}
+
+// newTestCertificate issues a certificate from template, signed by parent or
+// self-signed when parent is nil.
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(365 * 24 * time.Hour)
+	}
+
+	signer, signerCert := crypto.Signer(key), template
+	if parent != nil {
+		signer, signerCert = parent.key, parent.cert
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		cert:   cert,
+		key:    key,
+		pem:    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func newTestCA(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, parent)
+}
+
+func TestParseCertificateBundle(t *testing.T) {
+	root := newTestCA(t, "Root", nil)
+	intermediate := newTestCA(t, "Intermediate", root)
+	leaf := newTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com", "*.example.com", "example.net"},
+	}, intermediate)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	options := ZoneCustomSSLOptions{Certificate: leaf.pem + intermediate.pem, PrivateKey: leaf.keyPEM}
+	b, err := ValidateZoneCustomSSLOptions(&options, "example.com", CertificateBundleOptions{Roots: roots})
+	require.NoError(t, err)
+	assert.True(t, b.Trusted)
+	assert.Equal(t, BundleMethodUbiquitous, options.BundleMethod)
+	assert.Equal(t, []string{"example.com", "*.example.com", "example.net"}, b.Hosts)
+	assert.Equal(t, leaf.cert.NotAfter, b.ExpiresOn)
+	assert.Equal(t, []string{"host example.net is not part of zone example.com"}, b.Warnings)
+
+	// Without the root the chain is untrusted and has to be forced.
+	options = ZoneCustomSSLOptions{Certificate: leaf.pem + intermediate.pem, PrivateKey: leaf.keyPEM}
+	b, err = ValidateZoneCustomSSLOptions(&options, "", CertificateBundleOptions{Roots: x509.NewCertPool()})
+	require.NoError(t, err)
+	assert.False(t, b.Trusted)
+	assert.Equal(t, BundleMethodForce, options.BundleMethod)
+	assert.Equal(t, []string{"certificate does not chain to a trusted root, the uploaded chain will be used as is"}, b.Warnings)
+
+	options.BundleMethod = BundleMethodOptimal
+	b, err = ValidateZoneCustomSSLOptions(&options, "", CertificateBundleOptions{Roots: x509.NewCertPool()})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bundle method optimal needs a publicly trusted certificate, consider force"}, b.Warnings)
+
+	options.BundleMethod = "shortest"
+	_, err = ValidateZoneCustomSSLOptions(&options, "", CertificateBundleOptions{Roots: roots})
+	assert.EqualError(t, err, `unknown bundle method "shortest"`)
+
+	_, err = ValidateZoneCustomSSLOptions(&ZoneCustomSSLOptions{Certificate: leaf.pem, PrivateKey: intermediate.keyPEM}, "", CertificateBundleOptions{})
+	assert.EqualError(t, err, "private key does not match the certificate")
+
+	_, err = ValidateZoneCustomSSLOptions(&ZoneCustomSSLOptions{Certificate: intermediate.pem + leaf.pem, PrivateKey: intermediate.keyPEM}, "", CertificateBundleOptions{})
+	assert.EqualError(t, err, "certificate 1 (Intermediate) is not signed by the next certificate in the chain (example.com); certificates must be ordered leaf first")
+
+	_, err = ValidateZoneCustomSSLOptions(&ZoneCustomSSLOptions{Certificate: "not a certificate", PrivateKey: leaf.keyPEM}, "", CertificateBundleOptions{})
+	assert.EqualError(t, err, "no PEM certificate found")
+
+	_, err = ValidateZoneCustomSSLOptions(&ZoneCustomSSLOptions{Certificate: leaf.pem}, "", CertificateBundleOptions{})
+	assert.EqualError(t, err, "a private key is required")
+
+	_, err = ParseCertificateBundle(leaf.pem, leaf.keyPEM, CertificateBundleOptions{Now: leaf.cert.NotAfter.Add(time.Hour)})
+	assert.EqualError(t, err, "certificate expired on "+leaf.cert.NotAfter.UTC().Format(time.RFC3339))
+
+	b, err = ParseCertificateBundle(leaf.pem, leaf.keyPEM, CertificateBundleOptions{Roots: roots, Now: leaf.cert.NotAfter.Add(-24 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"certificate expires on " + leaf.cert.NotAfter.UTC().Format(time.RFC3339)}, b.Warnings)
+}
+
+func TestValidateAuthenticatedOriginPullsCertificate(t *testing.T) {
+	ca := newTestCA(t, "Origin Pull CA", nil)
+	client := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "origin-pull.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	server := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "www.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+
+	b, err := ValidateAuthenticatedOriginPullsCertificate(client.pem, client.keyPEM, CertificateBundleOptions{})
+	if assert.NoError(t, err) {
+		assert.Empty(t, b.Warnings)
+		assert.Equal(t, []string{"origin-pull.example.com"}, b.Hosts)
+	}
+
+	_, err = ValidateAuthenticatedOriginPullsCertificate(server.pem, server.keyPEM, CertificateBundleOptions{})
+	assert.EqualError(t, err, "certificate cannot be used for client authentication")
+
+	_, err = ValidateAuthenticatedOriginPullsCertificate(client.pem, "", CertificateBundleOptions{})
+	assert.EqualError(t, err, "a private key is required")
+}
+
+func TestValidateAccessMutualTLSCertificate(t *testing.T) {
+	root := newTestCA(t, "Device Root", nil)
+	intermediate := newTestCA(t, "Device Issuing", root)
+	leaf := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "device-1"}}, intermediate)
+
+	b, err := ValidateAccessMutualTLSCertificate(AccessMutualTLSCertificate{Certificate: intermediate.pem + root.pem}, CertificateBundleOptions{})
+	if assert.NoError(t, err) {
+		assert.Len(t, b.Intermediates, 1)
+	}
+
+	// Unrelated CAs, as uploaded while moving clients to a new CA, are
+	// checked individually rather than as a chain.
+	replacement := newTestCA(t, "Device Root 2022", nil)
+	b, err = ValidateAccessMutualTLSCertificate(AccessMutualTLSCertificate{Certificate: root.pem + replacement.pem}, CertificateBundleOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Device Root", b.Leaf.Subject.CommonName)
+		assert.Len(t, b.Intermediates, 1)
+	}
+
+	_, err = ValidateAccessMutualTLSCertificate(AccessMutualTLSCertificate{Certificate: root.pem + leaf.pem}, CertificateBundleOptions{})
+	assert.EqualError(t, err, "certificate device-1 is not a CA certificate")
+
+	_, err = ValidateAccessMutualTLSCertificate(AccessMutualTLSCertificate{Certificate: root.pem}, CertificateBundleOptions{Now: time.Now().Add(2 * 365 * 24 * time.Hour)})
+	assert.Error(t, err)
+
+	_, err = ValidateAccessMutualTLSCertificate(AccessMutualTLSCertificate{Certificate: strings.Replace(root.pem, "CERTIFICATE", "PRIVATE KEY", -1)}, CertificateBundleOptions{})
+	assert.EqualError(t, err, "unexpected PRIVATE KEY in certificate chain")
+}
@@ -0,0 +1,228 @@
+package cloudflare
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Certificate sources used in CertificateRecord.
+const (
+	CertificateSourceCustomSSL       = "custom_ssl"
+	CertificateSourceCertificatePack = "certificate_pack"
+	CertificateSourceCustomHostname  = "custom_hostname"
+	CertificateSourceOriginCA        = "origin_ca"
+)
+
+// certificateValidationStatuses are the statuses of certificates which have
+// not been issued yet.
+var certificateValidationStatuses = map[string]bool{
+	"initializing":         true,
+	"pending_validation":   true,
+	"pending_issuance":     true,
+	"pending_deployment":   true,
+	"validation_timed_out": true,
+}
+
+// CertificateRecord is a certificate from any of the places certificates
+// are managed, normalised to a single shape.
+type CertificateRecord struct {
+	Source           string    `json:"source"`
+	ID               string    `json:"id"`
+	ZoneID           string    `json:"zone_id"`
+	ZoneName         string    `json:"zone_name"`
+	Hosts            []string  `json:"hosts"`
+	Issuer           string    `json:"issuer,omitempty"`
+	Status           string    `json:"status,omitempty"`
+	ExpiresOn        time.Time `json:"expires_on"`
+	ValidationErrors []string  `json:"validation_errors,omitempty"`
+}
+
+// ExpiresWithin reports whether the certificate has an expiry date before
+// now plus d.
+func (r CertificateRecord) ExpiresWithin(d time.Duration, now time.Time) bool {
+	return !r.ExpiresOn.IsZero() && r.ExpiresOn.Before(now.Add(d))
+}
+
+// InValidation reports whether the certificate is still waiting to be
+// validated or issued, or its validation failed.
+func (r CertificateRecord) InValidation() bool {
+	return certificateValidationStatuses[r.Status] || len(r.ValidationErrors) > 0
+}
+
+// CertificateInventory is the list of certificates in an account, sorted by
+// expiry with certificates that have no expiry date last.
+type CertificateInventory []CertificateRecord
+
+// Expiring returns the certificates expiring within d of now.
+func (inv CertificateInventory) Expiring(d time.Duration, now time.Time) CertificateInventory {
+	var records CertificateInventory
+	for _, r := range inv {
+		if r.ExpiresWithin(d, now) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// InValidation returns the certificates waiting for or failing validation.
+func (inv CertificateInventory) InValidation() CertificateInventory {
+	var records CertificateInventory
+	for _, r := range inv {
+		if r.InValidation() {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// CertificateInventoryOptions configures CertificateInventory.
+type CertificateInventoryOptions struct {
+	// AccountID limits the inventory to the zones of an account. Defaults
+	// to api.AccountID; when both are empty every zone the credentials can
+	// access is walked.
+	AccountID string
+	// Sources selects where certificates are collected from. Defaults to
+	// all sources, except that Origin CA certificates are only listed when
+	// api.APIUserServiceKey is set.
+	Sources []string
+}
+
+// CertificateInventory lists the custom SSL certificates, certificate packs,
+// custom hostname certificates and Origin CA certificates of every zone.
+func (api *API) CertificateInventory(ctx context.Context, opts CertificateInventoryOptions) (CertificateInventory, error) {
+	sources := opts.Sources
+	if len(sources) == 0 {
+		sources = []string{CertificateSourceCustomSSL, CertificateSourceCertificatePack, CertificateSourceCustomHostname}
+		if api.APIUserServiceKey != "" {
+			sources = append(sources, CertificateSourceOriginCA)
+		}
+	}
+
+	accountID := opts.AccountID
+	if accountID == "" {
+		accountID = api.AccountID
+	}
+
+	zones, err := api.ListZonesContext(ctx, WithZoneFilters("", accountID, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory CertificateInventory
+	for _, zone := range zones.Result {
+		for _, source := range sources {
+			records, err := api.zoneCertificates(ctx, zone, source)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to list %s certificates of zone %s", source, zone.Name)
+			}
+			inventory = append(inventory, records...)
+		}
+	}
+
+	sort.SliceStable(inventory, func(i, j int) bool {
+		a, b := inventory[i].ExpiresOn, inventory[j].ExpiresOn
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+
+	return inventory, nil
+}
+
+// zoneCertificates lists the certificates of a zone from one source.
+func (api *API) zoneCertificates(ctx context.Context, zone Zone, source string) ([]CertificateRecord, error) {
+	var records []CertificateRecord
+	record := func(id string, hosts []string, issuer, status string, expiresOn time.Time) CertificateRecord {
+		return CertificateRecord{
+			Source:    source,
+			ID:        id,
+			ZoneID:    zone.ID,
+			ZoneName:  zone.Name,
+			Hosts:     hosts,
+			Issuer:    issuer,
+			Status:    status,
+			ExpiresOn: expiresOn,
+		}
+	}
+
+	switch source {
+	case CertificateSourceCustomSSL:
+		certs, err := api.ListSSL(ctx, zone.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range certs {
+			records = append(records, record(c.ID, c.Hosts, c.Issuer, c.Status, c.ExpiresOn))
+		}
+
+	case CertificateSourceCertificatePack:
+		packs, err := api.ListCertificatePacks(ctx, zone.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, pack := range packs {
+			var validationErrors []string
+			for _, e := range pack.ValidationErrors {
+				validationErrors = append(validationErrors, e.Message)
+			}
+
+			// Packs are reported by their primary certificate, or by the
+			// pack itself while no certificate has been issued.
+			r := record(pack.ID, pack.Hosts, "", "", time.Time{})
+			for _, c := range pack.Certificates {
+				if c.ID == pack.PrimaryCertificate || pack.PrimaryCertificate == "" {
+					r = record(pack.ID, pack.Hosts, c.Issuer, c.Status, c.ExpiresOn)
+					break
+				}
+			}
+			if r.Status == "" && len(pack.Certificates) == 0 {
+				r.Status = "pending_validation"
+			}
+			r.ValidationErrors = validationErrors
+			records = append(records, r)
+		}
+
+	case CertificateSourceCustomHostname:
+		err := api.ForEachCustomHostname(ctx, zone.ID, CustomHostnameListOptions{}, func(h CustomHostname) error {
+			if h.SSL == nil {
+				return nil
+			}
+			r := record(h.SSL.ID, []string{h.Hostname}, h.SSL.Issuer, h.SSL.Status, time.Time{})
+			for _, c := range h.SSL.Certificates {
+				if c.ExpiresOn != nil && (r.ExpiresOn.IsZero() || c.ExpiresOn.Before(r.ExpiresOn)) {
+					r.ExpiresOn = *c.ExpiresOn
+					r.Issuer = c.Issuer
+				}
+			}
+			for _, e := range h.SSL.ValidationErrors {
+				r.ValidationErrors = append(r.ValidationErrors, e.Message)
+			}
+			records = append(records, r)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case CertificateSourceOriginCA:
+		certs, err := api.OriginCertificates(ctx, OriginCACertificateListOptions{ZoneID: zone.ID})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range certs {
+			if !c.RevokedAt.IsZero() {
+				continue
+			}
+			records = append(records, record(c.ID, c.Hostnames, "Cloudflare Origin CA", "active", c.ExpiresOn))
+		}
+
+	default:
+		return nil, errors.Errorf("unknown certificate source %q", source)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,97 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertificateInventory(t *testing.T) {
+	setup(UsingAccount(testAccountID))
+	defer teardown()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	soon := now.Add(5 * 24 * time.Hour)
+	later := now.Add(200 * 24 * time.Hour)
+
+	mux.HandleFunc("/zones", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		assert.Equal(t, testAccountID, r.URL.Query().Get("account.id"))
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": %q, "name": "example.com"}],
+			"result_info": {"page": 1, "per_page": 50, "count": 1, "total_count": 1, "total_pages": 1}}`, testZoneID)
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/custom_certificates", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": [
+			{"id": "custom-1", "hosts": ["example.com"], "issuer": "DigiCert", "status": "active", "expires_on": %q}
+		]}`, later.Format(time.RFC3339))
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/ssl/certificate_packs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": [
+			{"id": "pack-1", "type": "universal", "hosts": ["example.com", "*.example.com"], "primary_certificate": "c2", "certificates": [
+				{"id": "c1", "issuer": "Other", "status": "active", "expires_on": %q},
+				{"id": "c2", "issuer": "Let's Encrypt", "status": "active", "expires_on": %q}
+			]},
+			{"id": "pack-2", "type": "advanced", "hosts": ["new.example.com"], "certificates": [], "validation_errors": [{"message": "CAA record prevents issuance"}]}
+		]}`, later.Format(time.RFC3339), soon.Format(time.RFC3339))
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/custom_hostnames", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		if r.URL.Query().Get("page") == "1" {
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": [
+				{"id": "ch-1", "hostname": "app.customer.com", "ssl": {"id": "ssl-1", "status": "active", "certificates": [{"issuer": "DigiCert", "expires_on": %q}]}}
+			], "result_info": {"page": 1, "total_pages": 2}}`, now.Add(10*24*time.Hour).Format(time.RFC3339))
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": [
+			{"id": "ch-2", "hostname": "shop.customer.com", "ssl": {"id": "ssl-2", "status": "pending_validation"}},
+			{"id": "ch-3", "hostname": "nossl.customer.com"}
+		], "result_info": {"page": 2, "total_pages": 2}}`)
+	})
+
+	inventory, err := client.CertificateInventory(context.Background(), CertificateInventoryOptions{AccountID: testAccountID})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var ids []string
+	for _, r := range inventory {
+		ids = append(ids, r.Source+"/"+r.ID)
+	}
+	assert.Equal(t, []string{
+		"certificate_pack/pack-1",
+		"custom_hostname/ssl-1",
+		"custom_ssl/custom-1",
+		"certificate_pack/pack-2",
+		"custom_hostname/ssl-2",
+	}, ids)
+
+	assert.Equal(t, CertificateRecord{
+		Source:    CertificateSourceCertificatePack,
+		ID:        "pack-1",
+		ZoneID:    testZoneID,
+		ZoneName:  "example.com",
+		Hosts:     []string{"example.com", "*.example.com"},
+		Issuer:    "Let's Encrypt",
+		Status:    "active",
+		ExpiresOn: soon,
+	}, inventory[0])
+
+	expiring := inventory.Expiring(30*24*time.Hour, now)
+	assert.Len(t, expiring, 2)
+
+	validating := inventory.InValidation()
+	if assert.Len(t, validating, 2) {
+		assert.Equal(t, []string{"CAA record prevents issuance"}, validating[0].ValidationErrors)
+		assert.Equal(t, []string{"shop.customer.com"}, validating[1].Hosts)
+	}
+
+	_, err = client.CertificateInventory(context.Background(), CertificateInventoryOptions{Sources: []string{"keyless"}})
+	assert.EqualError(t, err, `failed to list keyless certificates of zone example.com: unknown certificate source "keyless"`)
+}
@@ -0,0 +1,220 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Actions taken by WatchCertificateValidation.
+const (
+	CertificateValidationActionRetry        = "retry_validation"
+	CertificateValidationActionSwitchMethod = "switch_validation_method"
+)
+
+// certificateValidationFailedStatuses are the certificate pack statuses
+// from which validation can be restarted.
+var certificateValidationFailedStatuses = map[string]bool{
+	"validation_timed_out": true,
+	"issuance_timed_out":   true,
+	"deployment_timed_out": true,
+}
+
+// CertificateValidationEvent is a change in the validation of a
+// certificate pack, or an action taken to move it along.
+type CertificateValidationEvent struct {
+	Time         time.Time
+	CertPackUUID string
+
+	// PreviousStatus is empty the first time a pack is seen.
+	PreviousStatus   string
+	Status           string
+	ValidationMethod string
+	VerificationInfo []SSLValidationRecord
+
+	// Action is CertificateValidationActionRetry or
+	// CertificateValidationActionSwitchMethod when the event reports an
+	// action rather than a status change.
+	Action string
+
+	// Err is set when the status could not be fetched or an action
+	// failed. Polling continues after errors.
+	Err error
+}
+
+func (e CertificateValidationEvent) String() string {
+	switch {
+	case e.Err != nil && e.CertPackUUID == "":
+		return e.Err.Error()
+	case e.Err != nil:
+		return fmt.Sprintf("certificate pack %s: %s", e.CertPackUUID, e.Err)
+	case e.Action == CertificateValidationActionRetry:
+		return fmt.Sprintf("certificate pack %s: restarted validation after %s", e.CertPackUUID, e.Status)
+	case e.Action == CertificateValidationActionSwitchMethod:
+		return fmt.Sprintf("certificate pack %s: switched validation method to %s", e.CertPackUUID, e.ValidationMethod)
+	case e.PreviousStatus == "":
+		return fmt.Sprintf("certificate pack %s is %s (%s validation)", e.CertPackUUID, e.Status, e.ValidationMethod)
+	}
+	return fmt.Sprintf("certificate pack %s went from %s to %s", e.CertPackUUID, e.PreviousStatus, e.Status)
+}
+
+// CertificateValidationWatchOptions configures WatchCertificateValidation.
+type CertificateValidationWatchOptions struct {
+	// Interval between polls. Defaults to 30 seconds.
+	Interval time.Duration
+	// RetryFailed restarts validation of packs whose validation or
+	// issuance timed out, at most MaxRetries times per pack.
+	RetryFailed bool
+	// MaxRetries defaults to 3.
+	MaxRetries int
+	// StallTimeout switches the validation method of a pack that has been
+	// pending validation for this long. Packs which passed validation and
+	// are being issued or deployed are left alone. Zero disables switching.
+	StallTimeout time.Duration
+	// ValidationMethods is the order methods are tried in when switching,
+	// for instance "txt", "http", "email". The method after the pack's
+	// current one is used, wrapping around.
+	ValidationMethods []string
+}
+
+// certificateValidationState is what WatchCertificateValidation remembers
+// about a certificate pack.
+type certificateValidationState struct {
+	status  string
+	since   time.Time
+	retries int
+}
+
+// WatchCertificateValidation polls the Universal SSL verification details of
+// a zone and emits an event whenever a certificate pack changes status. It
+// can restart failed validations and switch the validation method of packs
+// which stall. The channel is closed once ctx is done.
+func (api *API) WatchCertificateValidation(ctx context.Context, zoneID string, opts CertificateValidationWatchOptions) <-chan CertificateValidationEvent {
+	events := make(chan CertificateValidationEvent)
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 3
+	}
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		states := make(map[string]*certificateValidationState)
+		for {
+			details, err := api.UniversalSSLVerificationDetails(ctx, zoneID)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !sendCertificateValidationEvent(ctx, events, CertificateValidationEvent{Time: time.Now(), Err: err}) {
+					return
+				}
+			}
+
+			for _, d := range details {
+				for _, e := range api.checkCertificateValidation(ctx, zoneID, d, states, opts) {
+					if !sendCertificateValidationEvent(ctx, events, e) {
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// checkCertificateValidation compares a pack with its previous state and
+// takes any retry or method switch action due.
+func (api *API) checkCertificateValidation(ctx context.Context, zoneID string, d UniversalSSLVerificationDetails, states map[string]*certificateValidationState, opts CertificateValidationWatchOptions) []CertificateValidationEvent {
+	now := time.Now()
+	event := func() CertificateValidationEvent {
+		return CertificateValidationEvent{
+			Time:             now,
+			CertPackUUID:     d.CertPackUUID,
+			Status:           d.CertificateStatus,
+			ValidationMethod: d.ValidationMethod,
+			VerificationInfo: d.VerificationInfo,
+		}
+	}
+
+	var events []CertificateValidationEvent
+	state, ok := states[d.CertPackUUID]
+	if !ok || state.status != d.CertificateStatus {
+		e := event()
+		if ok {
+			e.PreviousStatus = state.status
+			state.status, state.since = d.CertificateStatus, now
+		} else {
+			state = &certificateValidationState{status: d.CertificateStatus, since: now}
+			states[d.CertPackUUID] = state
+		}
+		events = append(events, e)
+	}
+
+	switch {
+	case d.CertificateStatus == "active":
+
+	case certificateValidationFailedStatuses[d.CertificateStatus]:
+		if !opts.RetryFailed || state.retries >= opts.MaxRetries {
+			break
+		}
+		state.retries++
+		e := event()
+		e.Action = CertificateValidationActionRetry
+		if _, err := api.RestartAdvancedCertificateValidation(ctx, zoneID, d.CertPackUUID); err != nil {
+			e.Err = err
+		}
+		events = append(events, e)
+
+	case d.CertificateStatus == "pending_validation" && opts.StallTimeout > 0 && len(opts.ValidationMethods) > 0 && now.Sub(state.since) >= opts.StallTimeout:
+		method := nextValidationMethod(opts.ValidationMethods, d.ValidationMethod)
+		if method == d.ValidationMethod {
+			break
+		}
+		state.since = now
+		e := event()
+		e.Action = CertificateValidationActionSwitchMethod
+		e.ValidationMethod = method
+		setting := UniversalSSLCertificatePackValidationMethodSetting{ValidationMethod: method}
+		if _, err := api.UpdateUniversalSSLCertificatePackValidationMethod(ctx, zoneID, d.CertPackUUID, setting); err != nil {
+			e.Err = err
+		}
+		events = append(events, e)
+	}
+
+	return events
+}
+
+// nextValidationMethod returns the method following current in methods,
+// or the first method if current is not listed.
+func nextValidationMethod(methods []string, current string) string {
+	for i, method := range methods {
+		if method == current {
+			return methods[(i+1)%len(methods)]
+		}
+	}
+	return methods[0]
+}
+
+func sendCertificateValidationEvent(ctx context.Context, events chan<- CertificateValidationEvent, e CertificateValidationEvent) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificateValidation writes the verification details of the test
+// certificate pack.
+func writeCertificateValidation(w http.ResponseWriter, status, method string) {
+	w.Header().Set("content-type", "application/json")
+	fmt.Fprintf(w, `{
+      "success": true,
+      "errors": [],
+      "messages": [],
+      "result": [{"cert_pack_uuid": %q, "certificate_status": %q, "validation_method": %q}]
+    }`, testCertPackUUID, status, method)
+}
+
+// collectCertificateValidationEvents reads events until the pack is active.
+func collectCertificateValidationEvents(t *testing.T, opts CertificateValidationWatchOptions) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got []string
+	for e := range client.WatchCertificateValidation(ctx, testZoneID, opts) {
+		got = append(got, e.String())
+		if e.Status == "active" && e.Action == "" {
+			cancel()
+		}
+	}
+	require.NotEqual(t, context.DeadlineExceeded, ctx.Err(), "certificate pack never became active: %v", got)
+	return got
+}
+
+func TestWatchCertificateValidation_Retry(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Validation times out on the second poll, and succeeds on the second
+	// poll after it is restarted.
+	polls, restartedAt := 0, 0
+	status := "pending_validation"
+	mux.HandleFunc("/zones/"+testZoneID+"/ssl/verification", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		polls++
+		switch {
+		case polls == 2:
+			status = "validation_timed_out"
+		case restartedAt > 0 && polls > restartedAt:
+			status = "active"
+		}
+		writeCertificateValidation(w, status, "txt")
+	})
+
+	restarts := 0
+	mux.HandleFunc("/zones/"+testZoneID+"/ssl/certificate_packs/"+testCertPackUUID, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method, "Expected method 'PATCH', got %s", r.Method)
+		restarts++
+		restartedAt = polls + 1
+		status = "pending_validation"
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": %q, "status": "pending_validation"}}`, testCertPackUUID)
+	})
+
+	got := collectCertificateValidationEvents(t, CertificateValidationWatchOptions{Interval: time.Millisecond, RetryFailed: true})
+	assert.Equal(t, []string{
+		"certificate pack " + testCertPackUUID + " is pending_validation (txt validation)",
+		"certificate pack " + testCertPackUUID + " went from pending_validation to validation_timed_out",
+		"certificate pack " + testCertPackUUID + ": restarted validation after validation_timed_out",
+		"certificate pack " + testCertPackUUID + " went from validation_timed_out to pending_validation",
+		"certificate pack " + testCertPackUUID + " went from pending_validation to active",
+	}, got)
+	assert.Equal(t, 1, restarts)
+}
+
+func TestWatchCertificateValidation_SwitchMethod(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Only HTTP validation succeeds.
+	method := "txt"
+	mux.HandleFunc("/zones/"+testZoneID+"/ssl/verification", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		status := "pending_validation"
+		if method == "http" {
+			status = "active"
+		}
+		writeCertificateValidation(w, status, method)
+	})
+
+	var switches []string
+	mux.HandleFunc("/zones/"+testZoneID+"/ssl/verification/"+testCertPackUUID, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method, "Expected method 'PATCH', got %s", r.Method)
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"validation_method": "http"}`, string(b))
+		var setting UniversalSSLCertificatePackValidationMethodSetting
+		require.NoError(t, json.Unmarshal(b, &setting))
+		switches = append(switches, setting.ValidationMethod)
+		method = setting.ValidationMethod
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, b)
+	})
+
+	got := collectCertificateValidationEvents(t, CertificateValidationWatchOptions{
+		Interval:          time.Millisecond,
+		StallTimeout:      time.Nanosecond,
+		ValidationMethods: []string{"txt", "http", "email"},
+	})
+	assert.Equal(t, []string{
+		"certificate pack " + testCertPackUUID + " is pending_validation (txt validation)",
+		"certificate pack " + testCertPackUUID + ": switched validation method to http",
+		"certificate pack " + testCertPackUUID + " went from pending_validation to active",
+	}, got)
+	assert.Equal(t, []string{"http"}, switches)
+}
+
+func TestWatchCertificateValidation_StalledDeployment(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The pack passed validation and takes a while to deploy, which must
+	// not restart validation with another method.
+	polls := 0
+	mux.HandleFunc("/zones/"+testZoneID+"/ssl/verification", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		polls++
+		status := "pending_deployment"
+		if polls > 5 {
+			status = "active"
+		}
+		writeCertificateValidation(w, status, "txt")
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/ssl/verification/"+testCertPackUUID, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	})
+
+	got := collectCertificateValidationEvents(t, CertificateValidationWatchOptions{
+		Interval:          time.Millisecond,
+		StallTimeout:      time.Nanosecond,
+		ValidationMethods: []string{"txt", "http", "email"},
+	})
+	assert.Equal(t, []string{
+		"certificate pack " + testCertPackUUID + " is pending_deployment (txt validation)",
+		"certificate pack " + testCertPackUUID + " went from pending_deployment to active",
+	}, got)
+}
+
+func TestNextValidationMethod(t *testing.T) {
+	methods := []string{"txt", "http", "email"}
+	assert.Equal(t, "http", nextValidationMethod(methods, "txt"))
+	assert.Equal(t, "txt", nextValidationMethod(methods, "email"))
+	assert.Equal(t, "txt", nextValidationMethod(methods, "cname"))
+}
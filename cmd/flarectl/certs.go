@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cloudflare "github.com/cloudflare/cloudflare-go"
+	"github.com/urfave/cli/v2"
+)
+
+func certs(c *cli.Context) error {
+	var sources []string
+	if c.String("source") != "" {
+		sources = strings.Split(c.String("source"), ",")
+	}
+
+	inventory, err := api.CertificateInventory(context.Background(), cloudflare.CertificateInventoryOptions{
+		Sources: sources,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error listing certificates: ", err)
+		return err
+	}
+
+	now := time.Now()
+	if c.IsSet("expiring") || c.Bool("validating") {
+		var filtered cloudflare.CertificateInventory
+		for _, r := range inventory {
+			if (c.IsSet("expiring") && r.ExpiresWithin(c.Duration("expiring"), now)) || (c.Bool("validating") && r.InValidation()) {
+				filtered = append(filtered, r)
+			}
+		}
+		inventory = filtered
+	}
+
+	output := make([][]string, 0, len(inventory))
+	for _, r := range inventory {
+		expires := ""
+		if !r.ExpiresOn.IsZero() {
+			expires = r.ExpiresOn.Format("2006-01-02")
+		}
+		output = append(output, []string{
+			r.ZoneName,
+			r.Source,
+			r.ID,
+			strings.Join(r.Hosts, ", "),
+			r.Issuer,
+			r.Status,
+			expires,
+			strings.Join(r.ValidationErrors, "; "),
+		})
+	}
+	writeTable(c, output, "Zone", "Source", "ID", "Hosts", "Issuer", "Status", "Expires", "Validation Errors")
+
+	return nil
+}
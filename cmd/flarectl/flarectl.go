@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	cloudflare "github.com/cloudflare/cloudflare-go"
 	"github.com/urfave/cli/v2"
@@ -686,6 +687,125 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:    "load-balancer",
+			Aliases: []string{"lb"},
+			Usage:   "Load Balancing",
+			Before:  initializeAPI,
+			Subcommands: []*cli.Command{
+				{
+					Name:    "origin",
+					Aliases: []string{"o"},
+					Usage:   "Origins across all pools",
+					Subcommands: []*cli.Command{
+						{
+							Name:   "drain",
+							Action: loadBalancerOriginDrain,
+							Usage:  "Disable an origin in every pool and wait for health checks to reflect it",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "name",
+									Usage: "origin name",
+								},
+								&cli.DurationFlag{
+									Name:  "interval",
+									Usage: "how often to poll pool health",
+									Value: 10 * time.Second,
+								},
+								&cli.DurationFlag{
+									Name:  "timeout",
+									Usage: "how long to wait for pool health to reflect the change",
+									Value: 5 * time.Minute,
+								},
+								&cli.StringFlag{
+									Name:  "state-file",
+									Usage: "file to save the previous origin state to, for use with restore",
+								},
+							},
+						},
+						{
+							Name:   "enable",
+							Action: loadBalancerOriginEnable,
+							Usage:  "Enable an origin in every pool",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "name",
+									Usage: "origin name",
+								},
+								&cli.BoolFlag{
+									Name:  "wait",
+									Usage: "wait for health checks to report the origin healthy",
+								},
+								&cli.DurationFlag{
+									Name:  "interval",
+									Usage: "how often to poll pool health",
+									Value: 10 * time.Second,
+								},
+								&cli.DurationFlag{
+									Name:  "timeout",
+									Usage: "how long to wait for pool health to reflect the change",
+									Value: 5 * time.Minute,
+								},
+								&cli.StringFlag{
+									Name:  "state-file",
+									Usage: "file to save the previous origin state to, for use with restore",
+								},
+							},
+						},
+						{
+							Name:   "weight",
+							Action: loadBalancerOriginWeight,
+							Usage:  "Set the weight of an origin in every pool",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "name",
+									Usage: "origin name",
+								},
+								&cli.Float64Flag{
+									Name:  "weight",
+									Usage: "origin weight between 0 and 1",
+								},
+								&cli.StringFlag{
+									Name:  "state-file",
+									Usage: "file to save the previous origin state to, for use with restore",
+								},
+							},
+						},
+						{
+							Name:   "restore",
+							Action: loadBalancerOriginRestore,
+							Usage:  "Restore origins to the state saved by drain, enable or weight",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "state-file",
+									Usage: "file the previous origin state was saved to",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "certs",
+			Action: certs,
+			Usage:  "Certificates across all zones, soonest expiring first",
+			Before: initializeAPI,
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "expiring",
+					Usage: "only show certificates expiring within this duration, e.g. 720h",
+				},
+				&cli.BoolFlag{
+					Name:  "validating",
+					Usage: "only show certificates waiting for or failing validation",
+				},
+				&cli.StringFlag{
+					Name:  "source",
+					Usage: "comma separated sources ( custom_ssl | certificate_pack | custom_hostname | origin_ca )",
+				},
+			},
+		},
 		{
 			Name:    "origin-ca-root-cert",
 			Aliases: []string{"ocrc"},
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	cloudflare "github.com/cloudflare/cloudflare-go"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+func formatLoadBalancerOriginState(state cloudflare.LoadBalancerOriginState) []string {
+	return []string{
+		state.PoolID,
+		state.Name,
+		state.Address,
+		strconv.FormatBool(state.Enabled),
+		strconv.FormatFloat(state.Weight, 'f', -1, 64),
+	}
+}
+
+// writeLoadBalancerOriginStates prints the previous state of updated origins
+// and saves it to the state file, if one was given, for a later restore.
+func writeLoadBalancerOriginStates(c *cli.Context, states []cloudflare.LoadBalancerOriginState) error {
+	if c.String("state-file") != "" {
+		b, err := json.MarshalIndent(states, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(c.String("state-file"), b, 0600); err != nil {
+			fmt.Fprintln(os.Stderr, "Error saving origin state: ", err)
+			return err
+		}
+	}
+
+	output := make([][]string, 0, len(states))
+	for _, state := range states {
+		output = append(output, formatLoadBalancerOriginState(state))
+	}
+	writeTable(c, output, "Pool ID", "Origin", "Address", "Previously Enabled", "Previous Weight")
+
+	return nil
+}
+
+func loadBalancerOriginDrain(c *cli.Context) error {
+	if err := checkFlags(c, "name"); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Duration("timeout"))
+	defer cancel()
+
+	// The previous states are saved before waiting for pool health, so the
+	// origins can be restored if the wait is interrupted or times out.
+	states, err := api.UpdateLoadBalancerOrigin(ctx, cloudflare.LoadBalancerOriginUpdate{
+		Name:    c.String("name"),
+		Enabled: cloudflare.BoolPtr(false),
+	})
+	if writeErr := writeLoadBalancerOriginStates(c, states); writeErr != nil {
+		return writeErr
+	}
+	if err == nil {
+		err = api.WaitForLoadBalancerOriginHealth(ctx, states, false, c.Duration("interval"))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error draining origin: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func loadBalancerOriginEnable(c *cli.Context) error {
+	if err := checkFlags(c, "name"); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Duration("timeout"))
+	defer cancel()
+
+	states, err := api.UpdateLoadBalancerOrigin(ctx, cloudflare.LoadBalancerOriginUpdate{
+		Name:    c.String("name"),
+		Enabled: cloudflare.BoolPtr(true),
+	})
+	if writeErr := writeLoadBalancerOriginStates(c, states); writeErr != nil {
+		return writeErr
+	}
+	if err == nil && c.Bool("wait") {
+		err = api.WaitForLoadBalancerOriginHealth(ctx, states, true, c.Duration("interval"))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error enabling origin: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func loadBalancerOriginWeight(c *cli.Context) error {
+	if err := checkFlags(c, "name"); err != nil {
+		return err
+	}
+
+	if !c.IsSet("weight") {
+		cli.ShowSubcommandHelp(c) //nolint
+		err := errors.New(`error: the required flag "weight" was not provided`)
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	states, err := api.UpdateLoadBalancerOrigin(context.Background(), cloudflare.LoadBalancerOriginUpdate{
+		Name:   c.String("name"),
+		Weight: cloudflare.Float64Ptr(c.Float64("weight")),
+	})
+	if writeErr := writeLoadBalancerOriginStates(c, states); writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error updating origin weight: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func loadBalancerOriginRestore(c *cli.Context) error {
+	if err := checkFlags(c, "state-file"); err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(c.String("state-file"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading origin state: ", err)
+		return err
+	}
+
+	var states []cloudflare.LoadBalancerOriginState
+	if err := json.Unmarshal(b, &states); err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading origin state: ", err)
+		return err
+	}
+
+	if err := api.RestoreLoadBalancerOrigins(context.Background(), states); err != nil {
+		fmt.Fprintln(os.Stderr, "Error restoring origins: ", err)
+		return err
+	}
+
+	output := make([][]string, 0, len(states))
+	for _, state := range states {
+		output = append(output, formatLoadBalancerOriginState(state))
+	}
+	writeTable(c, output, "Pool ID", "Origin", "Address", "Enabled", "Weight")
+
+	return nil
+}
@@ -213,7 +213,8 @@ func (api *API) CreateCustomHostname(ctx context.Context, zoneID string, ch Cust
 // CustomHostnames fetches custom hostnames for the given zone,
 // by applying filter.Hostname if not empty and scoping the result to page'th 50 items.
 //
-// The returned ResultInfo can be used to implement pagination.
+// The returned ResultInfo can be used to implement pagination. ListCustomHostnames
+// and ForEachCustomHostname paginate automatically.
 //
 // API reference: https://api.cloudflare.com/#custom-hostname-for-a-zone-list-custom-hostnames
 func (api *API) CustomHostnames(ctx context.Context, zoneID string, page int, filter CustomHostname) ([]CustomHostname, ResultInfo, error) {
@@ -224,18 +225,7 @@ func (api *API) CustomHostnames(ctx context.Context, zoneID string, page int, fi
 		v.Set("hostname", filter.Hostname)
 	}
 
-	uri := fmt.Sprintf("/zones/%s/custom_hostnames?%s", zoneID, v.Encode())
-	res, err := api.makeRequestContext(ctx, http.MethodGet, uri, nil)
-	if err != nil {
-		return []CustomHostname{}, ResultInfo{}, err
-	}
-	var customHostnameListResponse CustomHostnameListResponse
-	err = json.Unmarshal(res, &customHostnameListResponse)
-	if err != nil {
-		return []CustomHostname{}, ResultInfo{}, err
-	}
-
-	return customHostnameListResponse.Result, customHostnameListResponse.ResultInfo, nil
+	return api.customHostnamesPage(ctx, zoneID, v)
 }
 
 // CustomHostname inspects the given custom hostname in the given zone.
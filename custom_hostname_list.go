@@ -0,0 +1,189 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Export formats supported by ExportCustomHostnames.
+const (
+	CustomHostnameExportCSV  = "csv"
+	CustomHostnameExportJSON = "json"
+)
+
+// CustomHostnameListOptions filters and orders custom hostnames. Hostname,
+// Order and Direction are applied by the API; SSLStatus, Status and
+// CustomMetadata are applied to each page as it is fetched.
+type CustomHostnameListOptions struct {
+	Hostname string
+	// Order is "ssl" or "ssl_status".
+	Order string
+	// Direction is "asc" or "desc".
+	Direction string
+	// PerPage defaults to 50.
+	PerPage int
+
+	SSLStatus string
+	Status    CustomHostnameStatus
+	// CustomMetadata only matches hostnames whose metadata has each of the
+	// keys set to the given value.
+	CustomMetadata map[string]string
+}
+
+// Match reports whether a custom hostname passes the filters applied
+// locally.
+func (opts CustomHostnameListOptions) Match(ch CustomHostname) bool {
+	if opts.Status != "" && ch.Status != opts.Status {
+		return false
+	}
+	if opts.SSLStatus != "" && (ch.SSL == nil || ch.SSL.Status != opts.SSLStatus) {
+		return false
+	}
+	for key, value := range opts.CustomMetadata {
+		v, ok := ch.CustomMetadata[key]
+		if !ok || fmt.Sprint(v) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEachCustomHostname calls fn for every custom hostname of a zone which
+// matches opts, fetching pages as they are needed. Iteration stops at the
+// first error returned by fn.
+func (api *API) ForEachCustomHostname(ctx context.Context, zoneID string, opts CustomHostnameListOptions, fn func(CustomHostname) error) error {
+	v := url.Values{}
+	perPage := opts.PerPage
+	if perPage <= 0 {
+		perPage = 50
+	}
+	v.Set("per_page", strconv.Itoa(perPage))
+	if opts.Hostname != "" {
+		v.Set("hostname", opts.Hostname)
+	}
+	if opts.Order != "" {
+		v.Set("order", opts.Order)
+	}
+	if opts.Direction != "" {
+		v.Set("direction", opts.Direction)
+	}
+
+	for page := 1; ; page++ {
+		v.Set("page", strconv.Itoa(page))
+		hostnames, info, err := api.customHostnamesPage(ctx, zoneID, v)
+		if err != nil {
+			return err
+		}
+		for _, ch := range hostnames {
+			if !opts.Match(ch) {
+				continue
+			}
+			if err := fn(ch); err != nil {
+				return err
+			}
+		}
+		if info.Page >= info.TotalPages {
+			return nil
+		}
+	}
+}
+
+// ListCustomHostnames returns every custom hostname of a zone which matches
+// opts.
+func (api *API) ListCustomHostnames(ctx context.Context, zoneID string, opts CustomHostnameListOptions) ([]CustomHostname, error) {
+	var hostnames []CustomHostname
+	err := api.ForEachCustomHostname(ctx, zoneID, opts, func(ch CustomHostname) error {
+		hostnames = append(hostnames, ch)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hostnames, nil
+}
+
+// ExportCustomHostnames writes the custom hostnames of a zone matching opts
+// to w as CSV or as a JSON array. Hostnames are written as they are fetched,
+// so large zones are not held in memory.
+func (api *API) ExportCustomHostnames(ctx context.Context, zoneID string, opts CustomHostnameListOptions, w io.Writer, format string) error {
+	switch format {
+	case CustomHostnameExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "hostname", "status", "ssl_status", "ssl_method", "ssl_type", "custom_origin_server", "created_at", "custom_metadata"}); err != nil {
+			return err
+		}
+		err := api.ForEachCustomHostname(ctx, zoneID, opts, func(ch CustomHostname) error {
+			return cw.Write(customHostnameCSVRecord(ch))
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case CustomHostnameExportJSON:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		sep := "\n"
+		err := api.ForEachCustomHostname(ctx, zoneID, opts, func(ch CustomHostname) error {
+			b, err := json.Marshal(ch)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s%s", sep, b); err != nil {
+				return err
+			}
+			sep = ",\n"
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\n]\n")
+		return err
+
+	default:
+		return errors.Errorf("unknown export format %q", format)
+	}
+}
+
+func customHostnameCSVRecord(ch CustomHostname) []string {
+	var sslStatus, sslMethod, sslType, createdAt, metadata string
+	if ch.SSL != nil {
+		sslStatus, sslMethod, sslType = ch.SSL.Status, ch.SSL.Method, ch.SSL.Type
+	}
+	if ch.CreatedAt != nil {
+		createdAt = ch.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if len(ch.CustomMetadata) > 0 {
+		b, _ := json.Marshal(ch.CustomMetadata)
+		metadata = string(b)
+	}
+	return []string{ch.ID, ch.Hostname, string(ch.Status), sslStatus, sslMethod, sslType, ch.CustomOriginServer, createdAt, metadata}
+}
+
+// customHostnamesPage fetches one page of custom hostnames.
+func (api *API) customHostnamesPage(ctx context.Context, zoneID string, v url.Values) ([]CustomHostname, ResultInfo, error) {
+	uri := fmt.Sprintf("/zones/%s/custom_hostnames?%s", zoneID, v.Encode())
+	res, err := api.makeRequestContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return []CustomHostname{}, ResultInfo{}, err
+	}
+	var customHostnameListResponse CustomHostnameListResponse
+	err = json.Unmarshal(res, &customHostnameListResponse)
+	if err != nil {
+		return []CustomHostname{}, ResultInfo{}, err
+	}
+
+	return customHostnameListResponse.Result, customHostnameListResponse.ResultInfo, nil
+}
@@ -0,0 +1,130 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerFakeCustomHostnameList serves hostnames two per page.
+func registerFakeCustomHostnameList(t *testing.T, hostnames []CustomHostname) {
+	mux.HandleFunc("/zones/"+testZoneID+"/custom_hostnames", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+		assert.Equal(t, "ssl_status", r.URL.Query().Get("order"))
+		assert.Equal(t, "desc", r.URL.Query().Get("direction"))
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := (page - 1) * 2
+		end := start + 2
+		if end > len(hostnames) {
+			end = len(hostnames)
+		}
+		b, err := json.Marshal(hostnames[start:end])
+		require.NoError(t, err)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s, "result_info": {"page": %d, "per_page": 2, "total_pages": %d, "total_count": %d}}`,
+			b, page, (len(hostnames)+1)/2, len(hostnames))
+	})
+}
+
+func testCustomHostnameList() []CustomHostname {
+	return []CustomHostname{
+		{ID: "1", Hostname: "a.example.com", Status: ACTIVE, SSL: &CustomHostnameSSL{Status: "active", Method: "txt", Type: "dv"}, CustomMetadata: CustomMetadata{"plan": "pro"}},
+		{ID: "2", Hostname: "b.example.com", Status: PENDING, SSL: &CustomHostnameSSL{Status: "pending_validation", Method: "http", Type: "dv"}},
+		{ID: "3", Hostname: "c.example.com", Status: ACTIVE, SSL: &CustomHostnameSSL{Status: "active", Method: "txt", Type: "dv"}, CustomMetadata: CustomMetadata{"plan": "free"}},
+		{ID: "4", Hostname: "d.example.com", Status: ACTIVE, CustomMetadata: CustomMetadata{"plan": "pro"}},
+		{ID: "5", Hostname: "e.example.com", Status: ACTIVE, SSL: &CustomHostnameSSL{Status: "active", Method: "txt", Type: "dv"}, CustomMetadata: CustomMetadata{"plan": "pro", "seats": 10}},
+	}
+}
+
+func TestListCustomHostnames(t *testing.T) {
+	setup()
+	defer teardown()
+
+	registerFakeCustomHostnameList(t, testCustomHostnameList())
+
+	opts := CustomHostnameListOptions{PerPage: 2, Order: "ssl_status", Direction: "desc"}
+	all, err := client.ListCustomHostnames(context.Background(), testZoneID, opts)
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	opts.SSLStatus = "active"
+	opts.CustomMetadata = map[string]string{"plan": "pro"}
+	filtered, err := client.ListCustomHostnames(context.Background(), testZoneID, opts)
+	require.NoError(t, err)
+	var ids []string
+	for _, ch := range filtered {
+		ids = append(ids, ch.ID)
+	}
+	assert.Equal(t, []string{"1", "5"}, ids)
+
+	opts = CustomHostnameListOptions{PerPage: 2, Order: "ssl_status", Direction: "desc", Status: PENDING}
+	var seen []string
+	err = client.ForEachCustomHostname(context.Background(), testZoneID, opts, func(ch CustomHostname) error {
+		seen = append(seen, ch.Hostname)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b.example.com"}, seen)
+
+	opts = CustomHostnameListOptions{PerPage: 2, Order: "ssl_status", Direction: "desc"}
+	count := 0
+	err = client.ForEachCustomHostname(context.Background(), testZoneID, opts, func(ch CustomHostname) error {
+		if count++; count == 3 {
+			return fmt.Errorf("stop")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "stop")
+	assert.Equal(t, 3, count)
+}
+
+func TestCustomHostnameListOptions_Match(t *testing.T) {
+	ch := CustomHostname{Status: ACTIVE, CustomMetadata: CustomMetadata{"seats": 10}}
+
+	assert.True(t, CustomHostnameListOptions{}.Match(ch))
+	assert.True(t, CustomHostnameListOptions{CustomMetadata: map[string]string{"seats": "10"}}.Match(ch))
+	assert.False(t, CustomHostnameListOptions{CustomMetadata: map[string]string{"plan": "pro"}}.Match(ch))
+	assert.False(t, CustomHostnameListOptions{SSLStatus: "active"}.Match(ch))
+	assert.False(t, CustomHostnameListOptions{Status: PENDING}.Match(ch))
+}
+
+func TestExportCustomHostnames(t *testing.T) {
+	setup()
+	defer teardown()
+
+	registerFakeCustomHostnameList(t, testCustomHostnameList())
+
+	opts := CustomHostnameListOptions{PerPage: 2, Order: "ssl_status", Direction: "desc", CustomMetadata: map[string]string{"plan": "pro"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, client.ExportCustomHostnames(context.Background(), testZoneID, opts, &buf, CustomHostnameExportCSV))
+	assert.Equal(t, `id,hostname,status,ssl_status,ssl_method,ssl_type,custom_origin_server,created_at,custom_metadata
+1,a.example.com,active,active,txt,dv,,,"{""plan"":""pro""}"
+4,d.example.com,active,,,,,,"{""plan"":""pro""}"
+5,e.example.com,active,active,txt,dv,,,"{""plan"":""pro"",""seats"":10}"
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, client.ExportCustomHostnames(context.Background(), testZoneID, opts, &buf, CustomHostnameExportJSON))
+	var exported []CustomHostname
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &exported))
+	assert.Len(t, exported, 3)
+	assert.Equal(t, "d.example.com", exported[1].Hostname)
+
+	buf.Reset()
+	opts.CustomMetadata = map[string]string{"plan": "enterprise"}
+	require.NoError(t, client.ExportCustomHostnames(context.Background(), testZoneID, opts, &buf, CustomHostnameExportJSON))
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &exported))
+	assert.Empty(t, exported)
+
+	assert.EqualError(t, client.ExportCustomHostnames(context.Background(), testZoneID, opts, &buf, "xml"), `unknown export format "xml"`)
+}
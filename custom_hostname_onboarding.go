@@ -0,0 +1,300 @@
+package cloudflare
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Purposes of the records a customer publishes to onboard a custom hostname.
+const (
+	CustomHostnameRecordOwnership = "ownership"
+	CustomHostnameRecordSSL       = "ssl"
+)
+
+// customHostnameFailedStatuses are the hostname and SSL statuses from which
+// a custom hostname does not become active without intervention.
+var customHostnameFailedStatuses = map[string]bool{
+	"blocked":               true,
+	"moved":                 true,
+	"deleted":               true,
+	"validation_timed_out":  true,
+	"issuance_timed_out":    true,
+	"deployment_timed_out":  true,
+	"deletion_timed_out":    true,
+	"expired":               true,
+	"pending_deletion":      true,
+	"backup_issued_expired": true,
+}
+
+// CustomHostnameRecord is a DNS record, HTTP file or email approval the
+// customer has to publish for a custom hostname to be verified.
+type CustomHostnameRecord struct {
+	Hostname string `json:"hostname"`
+	// Purpose is CustomHostnameRecordOwnership or CustomHostnameRecordSSL.
+	Purpose string `json:"purpose"`
+	// Type is TXT, CNAME, HTTP or EMAIL.
+	Type string `json:"type"`
+	// Name is the record name, the URL of an HTTP file or the email
+	// address approval is sent to.
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+// CustomHostnameRecords returns the records the customer has to publish for
+// the ownership of the hostname and its certificate to be verified.
+func CustomHostnameRecords(ch CustomHostname) []CustomHostnameRecord {
+	var records []CustomHostnameRecord
+	add := func(purpose, typ, name, value string) {
+		if name != "" {
+			records = append(records, CustomHostnameRecord{Hostname: ch.Hostname, Purpose: purpose, Type: typ, Name: name, Value: value})
+		}
+	}
+
+	add(CustomHostnameRecordOwnership, strings.ToUpper(ch.OwnershipVerification.Type), ch.OwnershipVerification.Name, ch.OwnershipVerification.Value)
+	add(CustomHostnameRecordOwnership, "HTTP", ch.OwnershipVerificationHTTP.HTTPUrl, ch.OwnershipVerificationHTTP.HTTPBody)
+
+	if ch.SSL == nil {
+		return records
+	}
+	validation := ch.SSL.ValidationRecords
+	if len(validation) == 0 {
+		validation = []SSLValidationRecord{ch.SSL.SSLValidationRecord}
+	}
+	for _, r := range validation {
+		add(CustomHostnameRecordSSL, "TXT", r.TxtName, r.TxtValue)
+		add(CustomHostnameRecordSSL, "CNAME", r.CnameName, r.CnameTarget)
+		add(CustomHostnameRecordSSL, "HTTP", r.HTTPUrl, r.HTTPBody)
+		for _, email := range r.Emails {
+			add(CustomHostnameRecordSSL, "EMAIL", email, "")
+		}
+	}
+	return records
+}
+
+// CustomHostnameActive reports whether the hostname and its certificate are
+// both active.
+func CustomHostnameActive(ch CustomHostname) bool {
+	return ch.Status == ACTIVE && (ch.SSL == nil || ch.SSL.Status == string(ACTIVE))
+}
+
+// customHostnameFailure returns an error describing why a custom hostname
+// failed verification, or nil if it may still become active.
+func customHostnameFailure(ch CustomHostname) error {
+	status := string(ch.Status)
+	if ch.SSL != nil && customHostnameFailedStatuses[ch.SSL.Status] {
+		status = ch.SSL.Status
+	} else if !customHostnameFailedStatuses[status] {
+		return nil
+	}
+
+	reasons := append([]string{}, ch.VerificationErrors...)
+	if ch.SSL != nil {
+		for _, e := range ch.SSL.ValidationErrors {
+			reasons = append(reasons, e.Message)
+		}
+	}
+	if len(reasons) == 0 {
+		return errors.Errorf("custom hostname %s is %s", ch.Hostname, status)
+	}
+	return errors.Errorf("custom hostname %s is %s: %s", ch.Hostname, status, strings.Join(reasons, "; "))
+}
+
+// CustomHostnameRecordSink receives the records of a newly created custom
+// hostname, for instance to pass them on to the customer.
+type CustomHostnameRecordSink func(ctx context.Context, ch CustomHostname, records []CustomHostnameRecord) error
+
+// CustomHostnameOnboardingOptions configures OnboardCustomHostnames and
+// WaitForCustomHostname.
+type CustomHostnameOnboardingOptions struct {
+	// Publish receives the records of each hostname once it is created and
+	// the validation records of its certificate are known. These usually
+	// appear only after the certificate leaves the initializing status, so
+	// until then the hostname is polled as with Wait. Publish is called
+	// once per hostname, before waiting for it to become active.
+	Publish CustomHostnameRecordSink
+	// Wait polls each hostname until it is active or failed. Without it
+	// onboarding stops after creation.
+	Wait bool
+	// PollInterval is the initial delay between polls, doubled after each
+	// poll up to MaxPollInterval. Defaults to 10 seconds.
+	PollInterval time.Duration
+	// MaxPollInterval defaults to 5 minutes.
+	MaxPollInterval time.Duration
+	// Concurrency is the number of hostnames onboarded at once. Defaults to
+	// 10.
+	Concurrency int
+}
+
+// CustomHostnameOnboarding is the outcome of onboarding one hostname.
+type CustomHostnameOnboarding struct {
+	CustomHostname CustomHostname
+	Records        []CustomHostnameRecord
+	Err            error
+}
+
+// OnboardCustomHostname creates a custom hostname and returns it along with
+// the records the customer has to publish.
+func (api *API) OnboardCustomHostname(ctx context.Context, zoneID string, ch CustomHostname) (CustomHostname, []CustomHostnameRecord, error) {
+	res, err := api.CreateCustomHostname(ctx, zoneID, ch)
+	if err != nil {
+		return CustomHostname{}, nil, errors.Wrapf(err, "failed to create custom hostname %s", ch.Hostname)
+	}
+	return res.Result, CustomHostnameRecords(res.Result), nil
+}
+
+// WaitForCustomHostname polls a custom hostname with exponential backoff
+// until it and its certificate are active. It returns an error including
+// the verification and validation errors if either fails.
+func (api *API) WaitForCustomHostname(ctx context.Context, zoneID, customHostnameID string, opts CustomHostnameOnboardingOptions) (CustomHostname, error) {
+	interval, maxInterval := customHostnamePollIntervals(opts)
+
+	for {
+		ch, err := api.CustomHostname(ctx, zoneID, customHostnameID)
+		if err != nil {
+			return CustomHostname{}, err
+		}
+		if CustomHostnameActive(ch) {
+			return ch, nil
+		}
+		if err := customHostnameFailure(ch); err != nil {
+			return ch, err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ch, errors.Wrapf(ctx.Err(), "custom hostname %s is not active", ch.Hostname)
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// OnboardCustomHostnames creates custom hostnames, publishes their records
+// through opts.Publish and, with opts.Wait set, waits for each to become
+// active. Hostnames are onboarded concurrently and a failure only affects
+// its own hostname; the results are in the order of hostnames.
+func (api *API) OnboardCustomHostnames(ctx context.Context, zoneID string, hostnames []CustomHostname, opts CustomHostnameOnboardingOptions) []CustomHostnameOnboarding {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	results := make([]CustomHostnameOnboarding, len(hostnames))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(hostnames); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = api.onboardCustomHostname(ctx, zoneID, hostnames[i], opts)
+			}
+		}()
+	}
+
+	for i := range hostnames {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+func (api *API) onboardCustomHostname(ctx context.Context, zoneID string, ch CustomHostname, opts CustomHostnameOnboardingOptions) CustomHostnameOnboarding {
+	if err := ctx.Err(); err != nil {
+		return CustomHostnameOnboarding{CustomHostname: ch, Err: err}
+	}
+
+	created, records, err := api.OnboardCustomHostname(ctx, zoneID, ch)
+	if err != nil {
+		return CustomHostnameOnboarding{CustomHostname: ch, Err: err}
+	}
+	result := CustomHostnameOnboarding{CustomHostname: created, Records: records}
+
+	if opts.Publish != nil {
+		created, err = api.waitForCustomHostnameRecords(ctx, zoneID, created, opts)
+		result.CustomHostname, result.Records = created, CustomHostnameRecords(created)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		if err := opts.Publish(ctx, created, result.Records); err != nil {
+			result.Err = errors.Wrapf(err, "failed to publish records of custom hostname %s", created.Hostname)
+			return result
+		}
+	}
+
+	if opts.Wait {
+		ch, err := api.WaitForCustomHostname(ctx, zoneID, created.ID, opts)
+		if ch.ID != "" {
+			result.CustomHostname = ch
+		}
+		result.Err = err
+	}
+
+	return result
+}
+
+// waitForCustomHostnameRecords polls a custom hostname until the validation
+// records of its certificate are known, or until it is active or failed.
+func (api *API) waitForCustomHostnameRecords(ctx context.Context, zoneID string, ch CustomHostname, opts CustomHostnameOnboardingOptions) (CustomHostname, error) {
+	interval, maxInterval := customHostnamePollIntervals(opts)
+
+	for !customHostnameHasSSLRecords(ch) && !CustomHostnameActive(ch) {
+		if err := customHostnameFailure(ch); err != nil {
+			return ch, err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ch, errors.Wrapf(ctx.Err(), "validation records of custom hostname %s are not available", ch.Hostname)
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+
+		current, err := api.CustomHostname(ctx, zoneID, ch.ID)
+		if err != nil {
+			return ch, err
+		}
+		ch = current
+	}
+
+	return ch, nil
+}
+
+// customHostnameHasSSLRecords reports whether the validation records of the
+// certificate of a custom hostname are known, or it has no certificate.
+func customHostnameHasSSLRecords(ch CustomHostname) bool {
+	if ch.SSL == nil {
+		return true
+	}
+	for _, r := range CustomHostnameRecords(ch) {
+		if r.Purpose == CustomHostnameRecordSSL {
+			return true
+		}
+	}
+	return false
+}
+
+func customHostnamePollIntervals(opts CustomHostnameOnboardingOptions) (time.Duration, time.Duration) {
+	interval, maxInterval := opts.PollInterval, opts.MaxPollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if maxInterval <= 0 {
+		maxInterval = 5 * time.Minute
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	return interval, maxInterval
+}
@@ -0,0 +1,204 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// handleCustomHostnameCreation accepts new custom hostnames, which start out
+// pending validation.
+func handleCustomHostnameCreation(t *testing.T) {
+	mux.HandleFunc("/zones/"+testZoneID+"/custom_hostnames", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+		var ch CustomHostname
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ch))
+		assert.Equal(t, CustomHostname{Hostname: ch.Hostname}, ch)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, testCustomHostnameJSON(ch.Hostname, "pending", "pending_validation", ""))
+	})
+}
+
+// handleCustomHostnameStatus serves a custom hostname which is pending on
+// the first poll and then has the given status.
+func handleCustomHostnameStatus(t *testing.T, hostname, status, sslStatus, validationError string) {
+	polls := 0
+	mux.HandleFunc("/zones/"+testZoneID+"/custom_hostnames/id-"+hostname, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		polls++
+		result := testCustomHostnameJSON(hostname, "pending", "pending_validation", "")
+		if polls > 1 {
+			result = testCustomHostnameJSON(hostname, status, sslStatus, validationError)
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, result)
+	})
+}
+
+func testCustomHostnameJSON(hostname, status, sslStatus, validationError string) string {
+	validationErrors := "[]"
+	if validationError != "" {
+		validationErrors = fmt.Sprintf(`[{"message": %q}]`, validationError)
+	}
+	return fmt.Sprintf(`{
+      "id": "id-%[1]s",
+      "hostname": "%[1]s",
+      "status": %[2]q,
+      "ownership_verification": {"type": "txt", "name": "_cf-custom-hostname.%[1]s", "value": "token-%[1]s"},
+      "ssl": {
+        "status": %[3]q,
+        "validation_records": [{"txt_name": "_acme-challenge.%[1]s", "txt_value": "acme-%[1]s"}],
+        "validation_errors": %[4]s
+      }
+    }`, hostname, status, sslStatus, validationErrors)
+}
+
+func TestCustomHostnameRecords(t *testing.T) {
+	ch := CustomHostname{
+		Hostname:                  "app.example.com",
+		OwnershipVerification:     CustomHostnameOwnershipVerification{Type: "txt", Name: "_cf-custom-hostname.app.example.com", Value: "abc"},
+		OwnershipVerificationHTTP: CustomHostnameOwnershipVerificationHTTP{HTTPUrl: "http://app.example.com/.well-known/cf-custom-hostname-challenge/1", HTTPBody: "abc"},
+		SSL: &CustomHostnameSSL{
+			SSLValidationRecord: SSLValidationRecord{CnameName: "app.example.com", CnameTarget: "dcv.example.net", Emails: []string{"admin@example.com"}},
+		},
+	}
+
+	assert.Equal(t, []CustomHostnameRecord{
+		{Hostname: "app.example.com", Purpose: CustomHostnameRecordOwnership, Type: "TXT", Name: "_cf-custom-hostname.app.example.com", Value: "abc"},
+		{Hostname: "app.example.com", Purpose: CustomHostnameRecordOwnership, Type: "HTTP", Name: "http://app.example.com/.well-known/cf-custom-hostname-challenge/1", Value: "abc"},
+		{Hostname: "app.example.com", Purpose: CustomHostnameRecordSSL, Type: "CNAME", Name: "app.example.com", Value: "dcv.example.net"},
+		{Hostname: "app.example.com", Purpose: CustomHostnameRecordSSL, Type: "EMAIL", Name: "admin@example.com"},
+	}, CustomHostnameRecords(ch))
+
+	assert.Empty(t, CustomHostnameRecords(CustomHostname{Hostname: "app.example.com"}))
+}
+
+func TestWaitForCustomHostname(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleCustomHostnameCreation(t)
+	handleCustomHostnameStatus(t, "app.example.com", "active", "active", "")
+	handleCustomHostnameStatus(t, "bad.example.com", "pending", "validation_timed_out", "CAA record prevents issuance")
+	handleCustomHostnameStatus(t, "slow.example.com", "pending", "pending_validation", "")
+
+	ch, records, err := client.OnboardCustomHostname(context.Background(), testZoneID, CustomHostname{Hostname: "app.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, PENDING, ch.Status)
+	assert.Len(t, records, 2)
+
+	ch, err = client.WaitForCustomHostname(context.Background(), testZoneID, ch.ID, CustomHostnameOnboardingOptions{PollInterval: time.Millisecond})
+	if assert.NoError(t, err) {
+		assert.True(t, CustomHostnameActive(ch))
+	}
+
+	ch, _, err = client.OnboardCustomHostname(context.Background(), testZoneID, CustomHostname{Hostname: "bad.example.com"})
+	require.NoError(t, err)
+	_, err = client.WaitForCustomHostname(context.Background(), testZoneID, ch.ID, CustomHostnameOnboardingOptions{PollInterval: time.Millisecond})
+	assert.EqualError(t, err, "custom hostname bad.example.com is validation_timed_out: CAA record prevents issuance")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ch, _, err = client.OnboardCustomHostname(ctx, testZoneID, CustomHostname{Hostname: "slow.example.com"})
+	require.NoError(t, err)
+	_, err = client.WaitForCustomHostname(ctx, testZoneID, ch.ID, CustomHostnameOnboardingOptions{PollInterval: time.Hour})
+	assert.EqualError(t, err, "custom hostname slow.example.com is not active: context deadline exceeded")
+}
+
+func TestOnboardCustomHostnames(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleCustomHostnameCreation(t)
+	handleCustomHostnameStatus(t, "bad.example.com", "pending", "validation_timed_out", "CAA record prevents issuance")
+
+	var hostnames []CustomHostname
+	for i := 0; i < 20; i++ {
+		hostnames = append(hostnames, CustomHostname{Hostname: fmt.Sprintf("app%d.example.com", i)})
+		handleCustomHostnameStatus(t, hostnames[i].Hostname, "active", "active", "")
+	}
+	hostnames = append(hostnames, CustomHostname{Hostname: "bad.example.com"}, CustomHostname{Hostname: "unpublished.example.com"})
+
+	var published sync.Map
+	results := client.OnboardCustomHostnames(context.Background(), testZoneID, hostnames, CustomHostnameOnboardingOptions{
+		Publish: func(ctx context.Context, ch CustomHostname, records []CustomHostnameRecord) error {
+			if ch.Hostname == "unpublished.example.com" {
+				return fmt.Errorf("no contact for %s", ch.Hostname)
+			}
+			published.Store(ch.Hostname, records)
+			return nil
+		},
+		Wait:         true,
+		PollInterval: time.Millisecond,
+		Concurrency:  4,
+	})
+
+	require.Len(t, results, len(hostnames))
+	for i, result := range results[:20] {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, hostnames[i].Hostname, result.CustomHostname.Hostname)
+		assert.True(t, CustomHostnameActive(result.CustomHostname))
+		_, ok := published.Load(hostnames[i].Hostname)
+		assert.True(t, ok)
+	}
+	assert.EqualError(t, results[20].Err, "custom hostname bad.example.com is validation_timed_out: CAA record prevents issuance")
+	assert.Equal(t, "id-bad.example.com", results[20].CustomHostname.ID)
+	assert.EqualError(t, results[21].Err, "failed to publish records of custom hostname unpublished.example.com: no contact for unpublished.example.com")
+	assert.Len(t, results[21].Records, 2)
+}
+
+func TestOnboardCustomHostnames_InitializingCertificate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The certificate is initializing when the hostname is created and its
+	// validation records appear on the second poll.
+	initializing := `{
+      "id": "id-app.example.com",
+      "hostname": "app.example.com",
+      "status": "pending",
+      "ownership_verification": {"type": "txt", "name": "_cf-custom-hostname.app.example.com", "value": "token-app.example.com"},
+      "ssl": {"status": "initializing"}
+    }`
+	mux.HandleFunc("/zones/"+testZoneID+"/custom_hostnames", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, initializing)
+	})
+	polls := 0
+	mux.HandleFunc("/zones/"+testZoneID+"/custom_hostnames/id-app.example.com", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		polls++
+		result := initializing
+		if polls > 1 {
+			result = testCustomHostnameJSON("app.example.com", "pending", "pending_validation", "")
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, result)
+	})
+
+	var published []CustomHostnameRecord
+	results := client.OnboardCustomHostnames(context.Background(), testZoneID, []CustomHostname{{Hostname: "app.example.com"}}, CustomHostnameOnboardingOptions{
+		Publish: func(ctx context.Context, ch CustomHostname, records []CustomHostnameRecord) error {
+			published = records
+			return nil
+		},
+		PollInterval: time.Millisecond,
+	})
+
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, 2, polls)
+	assert.Equal(t, []CustomHostnameRecord{
+		{Hostname: "app.example.com", Purpose: CustomHostnameRecordOwnership, Type: "TXT", Name: "_cf-custom-hostname.app.example.com", Value: "token-app.example.com"},
+		{Hostname: "app.example.com", Purpose: CustomHostnameRecordSSL, Type: "TXT", Name: "_acme-challenge.app.example.com", Value: "acme-app.example.com"},
+	}, published)
+	assert.Equal(t, published, results[0].Records)
+}
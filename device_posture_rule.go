@@ -159,7 +159,9 @@ type DevicePostureRuleMatch struct {
 	Platform string `json:"platform,omitempty"`
 }
 
-// DevicePostureRuleInput represents the value to be checked against.
+// DevicePostureRuleInput represents the value to be checked against. It
+// holds the fields of every rule type; NewDevicePostureRule builds it from
+// a typed input which only holds the fields of one type.
 type DevicePostureRuleInput struct {
 	ID               string `json:"id,omitempty"`
 	Path             string `json:"path,omitempty"`
@@ -0,0 +1,575 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Device posture rule types.
+const (
+	DevicePostureRuleTypeApplication    = "application"
+	DevicePostureRuleTypeCrowdStrike    = "crowdstrike_s2s"
+	DevicePostureRuleTypeDiskEncryption = "disk_encryption"
+	DevicePostureRuleTypeDomainJoined   = "domain_joined"
+	DevicePostureRuleTypeFile           = "file"
+	DevicePostureRuleTypeFirewall       = "firewall"
+	DevicePostureRuleTypeGateway        = "gateway"
+	DevicePostureRuleTypeIntune         = "intune"
+	DevicePostureRuleTypeKolide         = "kolide"
+	DevicePostureRuleTypeOSVersion      = "os_version"
+	DevicePostureRuleTypeUniqueClientID = "unique_client_id"
+	DevicePostureRuleTypeWARP           = "warp"
+)
+
+// Device platforms used in DevicePostureRuleMatch.
+const (
+	DevicePosturePlatformAndroid = "android"
+	DevicePosturePlatformIOS     = "ios"
+	DevicePosturePlatformLinux   = "linux"
+	DevicePosturePlatformMac     = "mac"
+	DevicePosturePlatformWindows = "windows"
+)
+
+// Version comparison operators used by os_version and crowdstrike_s2s rules.
+const (
+	DevicePostureOperatorLess         = "<"
+	DevicePostureOperatorLessEqual    = "<="
+	DevicePostureOperatorGreater      = ">"
+	DevicePostureOperatorGreaterEqual = ">="
+	DevicePostureOperatorEqual        = "=="
+)
+
+// Intune compliance statuses.
+const (
+	DevicePostureIntuneCompliant     = "compliant"
+	DevicePostureIntuneNonCompliant  = "noncompliant"
+	DevicePostureIntuneUnknown       = "unknown"
+	DevicePostureIntuneNotApplicable = "notapplicable"
+	DevicePostureIntuneInGracePeriod = "ingraceperiod"
+	DevicePostureIntuneError         = "error"
+)
+
+var (
+	devicePosturePlatformsDesktop = []string{DevicePosturePlatformWindows, DevicePosturePlatformMac, DevicePosturePlatformLinux}
+	devicePosturePlatformsAll     = []string{DevicePosturePlatformWindows, DevicePosturePlatformMac, DevicePosturePlatformLinux, DevicePosturePlatformAndroid, DevicePosturePlatformIOS}
+
+	devicePostureVersionRegexp = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+)
+
+// DevicePostureRuleInputConfig is the input of a single type of device
+// posture rule. It is implemented by the DevicePosture*Input types, which
+// only hold the fields their rule type supports.
+type DevicePostureRuleInputConfig interface {
+	// PostureRuleType returns the type of the rule.
+	PostureRuleType() string
+	// Platforms returns the platforms the rule can run on.
+	Platforms() []string
+	// Validate checks the required fields are set and well formed.
+	Validate() error
+	// Input converts the input to the combined structure sent to the API.
+	Input() DevicePostureRuleInput
+}
+
+// DevicePostureApplicationInput checks that an application is installed.
+type DevicePostureApplicationInput struct {
+	Path       string
+	Sha256     string
+	Thumbprint string
+	Running    bool
+}
+
+// DevicePostureCrowdStrikeInput checks a device through a CrowdStrike
+// integration, optionally comparing the sensor version with Operator and
+// Version.
+type DevicePostureCrowdStrikeInput struct {
+	ConnectionID string
+	Operator     string
+	Version      string
+}
+
+// DevicePostureDiskEncryptionInput checks that disks are encrypted.
+type DevicePostureDiskEncryptionInput struct {
+	RequireAll bool
+}
+
+// DevicePostureDomainJoinedInput checks that a device is joined to a domain.
+type DevicePostureDomainJoinedInput struct {
+	Domain string
+}
+
+// DevicePostureFileInput checks for the presence of a file.
+type DevicePostureFileInput struct {
+	Path       string
+	Exists     bool
+	Sha256     string
+	Thumbprint string
+}
+
+// DevicePostureFirewallInput checks the state of the device firewall.
+type DevicePostureFirewallInput struct {
+	Enabled bool
+}
+
+// DevicePostureGatewayInput checks that traffic goes through Gateway, which
+// has no settings.
+type DevicePostureGatewayInput struct{}
+
+// DevicePostureIntuneInput checks a device's compliance through an Intune
+// integration.
+type DevicePostureIntuneInput struct {
+	ConnectionID     string
+	ComplianceStatus string
+}
+
+// DevicePostureKolideInput checks a device through a Kolide integration.
+type DevicePostureKolideInput struct {
+	ConnectionID string
+}
+
+// DevicePostureOSVersionInput compares the operating system version. OS
+// versions only make sense for a single platform, so rules of this type
+// must match exactly one.
+type DevicePostureOSVersionInput struct {
+	Operator string
+	Version  string
+}
+
+// DevicePostureUniqueClientIDInput checks the device ID against a list.
+type DevicePostureUniqueClientIDInput struct {
+	ID string
+}
+
+// DevicePostureWARPInput checks that the WARP client is connected, which has
+// no settings.
+type DevicePostureWARPInput struct{}
+
+// NewDevicePostureRule validates a typed input against the platforms it is
+// matched to and returns a rule which can be created with
+// CreateDevicePostureRule. Without platforms the rule runs on every platform
+// its type supports.
+func NewDevicePostureRule(name string, input DevicePostureRuleInputConfig, platforms ...string) (DevicePostureRule, error) {
+	rule := DevicePostureRule{
+		Name:  name,
+		Type:  input.PostureRuleType(),
+		Input: input.Input(),
+	}
+	for _, platform := range platforms {
+		rule.Match = append(rule.Match, DevicePostureRuleMatch{Platform: platform})
+	}
+
+	if err := validateDevicePostureRuleInput(rule, input); err != nil {
+		return DevicePostureRule{}, err
+	}
+
+	return rule, nil
+}
+
+// TypedInput converts the combined input of a rule to the typed input for
+// its type. The typed inputs hold every field the API accepts or returns
+// for their type; anything else in the combined input is ignored here and
+// reported by ValidateDevicePostureRule.
+func (r DevicePostureRule) TypedInput() (DevicePostureRuleInputConfig, error) {
+	in := r.Input
+	switch r.Type {
+	case DevicePostureRuleTypeApplication:
+		return DevicePostureApplicationInput{Path: in.Path, Sha256: in.Sha256, Thumbprint: in.Thumbprint, Running: in.Running}, nil
+	case DevicePostureRuleTypeCrowdStrike:
+		return DevicePostureCrowdStrikeInput{ConnectionID: in.ConnectionID, Operator: in.Operator, Version: in.Version}, nil
+	case DevicePostureRuleTypeDiskEncryption:
+		return DevicePostureDiskEncryptionInput{RequireAll: in.RequireAll}, nil
+	case DevicePostureRuleTypeDomainJoined:
+		return DevicePostureDomainJoinedInput{Domain: in.Domain}, nil
+	case DevicePostureRuleTypeFile:
+		return DevicePostureFileInput{Path: in.Path, Exists: in.Exists, Sha256: in.Sha256, Thumbprint: in.Thumbprint}, nil
+	case DevicePostureRuleTypeFirewall:
+		return DevicePostureFirewallInput{Enabled: in.Enabled}, nil
+	case DevicePostureRuleTypeGateway:
+		return DevicePostureGatewayInput{}, nil
+	case DevicePostureRuleTypeIntune:
+		return DevicePostureIntuneInput{ConnectionID: in.ConnectionID, ComplianceStatus: in.ComplianceStatus}, nil
+	case DevicePostureRuleTypeKolide:
+		return DevicePostureKolideInput{ConnectionID: in.ConnectionID}, nil
+	case DevicePostureRuleTypeOSVersion:
+		return DevicePostureOSVersionInput{Operator: in.Operator, Version: in.Version}, nil
+	case DevicePostureRuleTypeUniqueClientID:
+		return DevicePostureUniqueClientIDInput{ID: in.ID}, nil
+	case DevicePostureRuleTypeWARP:
+		return DevicePostureWARPInput{}, nil
+	}
+
+	return nil, errors.Errorf("unknown device posture rule type %q", r.Type)
+}
+
+// ValidateDevicePostureRule checks that a rule's input has the fields
+// required by its type and no fields belonging to other types, and that the
+// type supports the platforms the rule is matched to.
+func ValidateDevicePostureRule(rule DevicePostureRule) error {
+	input, err := rule.TypedInput()
+	if err != nil {
+		return err
+	}
+	if err := validateDevicePostureRuleInput(rule, input); err != nil {
+		return err
+	}
+
+	set, err := devicePostureRuleInputFields(rule.Input)
+	if err != nil {
+		return err
+	}
+	supported, err := devicePostureRuleInputFields(input.Input())
+	if err != nil {
+		return err
+	}
+
+	var unsupported []string
+	for field := range set {
+		if !supported[field] {
+			unsupported = append(unsupported, field)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return errors.Errorf("invalid %s posture rule: unsupported fields %s", rule.Type, strings.Join(unsupported, ", "))
+	}
+
+	return nil
+}
+
+// validateDevicePostureRuleInput validates a typed input and checks it
+// against the platforms a rule is matched to.
+func validateDevicePostureRuleInput(rule DevicePostureRule, input DevicePostureRuleInputConfig) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	for _, match := range rule.Match {
+		if !contains(input.Platforms(), match.Platform) {
+			return errors.Errorf("invalid %s posture rule: platform %q is not supported, use one of %s",
+				rule.Type, match.Platform, strings.Join(input.Platforms(), ", "))
+		}
+	}
+
+	if rule.Type == DevicePostureRuleTypeOSVersion && len(rule.Match) != 1 {
+		return errors.New("invalid os_version posture rule: exactly one platform must be matched")
+	}
+
+	return nil
+}
+
+// devicePostureRuleInputFields returns the JSON names of the fields set in
+// an input.
+func devicePostureRuleInputFields(in DevicePostureRuleInput) (map[string]bool, error) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(fields))
+	for field := range fields {
+		set[field] = true
+	}
+	return set, nil
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureApplicationInput) PostureRuleType() string {
+	return DevicePostureRuleTypeApplication
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureApplicationInput) Platforms() []string {
+	return devicePosturePlatformsDesktop
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureApplicationInput) Validate() error {
+	if i.Path == "" {
+		return errors.New("invalid application posture rule: missing path")
+	}
+	return validateDevicePostureSha256(i.PostureRuleType(), i.Sha256)
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureApplicationInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{Path: i.Path, Sha256: i.Sha256, Thumbprint: i.Thumbprint, Running: i.Running}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureCrowdStrikeInput) PostureRuleType() string {
+	return DevicePostureRuleTypeCrowdStrike
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureCrowdStrikeInput) Platforms() []string {
+	return devicePosturePlatformsDesktop
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureCrowdStrikeInput) Validate() error {
+	if i.ConnectionID == "" {
+		return errors.New("invalid crowdstrike_s2s posture rule: missing connection_id")
+	}
+	if i.Operator == "" && i.Version == "" {
+		return nil
+	}
+	return validateDevicePostureVersion(i.PostureRuleType(), i.Operator, i.Version)
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureCrowdStrikeInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{ConnectionID: i.ConnectionID, Operator: i.Operator, Version: i.Version}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureDiskEncryptionInput) PostureRuleType() string {
+	return DevicePostureRuleTypeDiskEncryption
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureDiskEncryptionInput) Platforms() []string {
+	return devicePosturePlatformsDesktop
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureDiskEncryptionInput) Validate() error {
+	return nil
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureDiskEncryptionInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{RequireAll: i.RequireAll}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureDomainJoinedInput) PostureRuleType() string {
+	return DevicePostureRuleTypeDomainJoined
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureDomainJoinedInput) Platforms() []string {
+	return []string{DevicePosturePlatformWindows}
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureDomainJoinedInput) Validate() error {
+	return nil
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureDomainJoinedInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{Domain: i.Domain}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureFileInput) PostureRuleType() string {
+	return DevicePostureRuleTypeFile
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureFileInput) Platforms() []string {
+	return devicePosturePlatformsDesktop
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureFileInput) Validate() error {
+	if i.Path == "" {
+		return errors.New("invalid file posture rule: missing path")
+	}
+	return validateDevicePostureSha256(i.PostureRuleType(), i.Sha256)
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureFileInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{Path: i.Path, Exists: i.Exists, Sha256: i.Sha256, Thumbprint: i.Thumbprint}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureFirewallInput) PostureRuleType() string {
+	return DevicePostureRuleTypeFirewall
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureFirewallInput) Platforms() []string {
+	return []string{DevicePosturePlatformWindows, DevicePosturePlatformMac}
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureFirewallInput) Validate() error {
+	return nil
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureFirewallInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{Enabled: i.Enabled}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureGatewayInput) PostureRuleType() string {
+	return DevicePostureRuleTypeGateway
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureGatewayInput) Platforms() []string {
+	return devicePosturePlatformsAll
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureGatewayInput) Validate() error {
+	return nil
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureGatewayInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureIntuneInput) PostureRuleType() string {
+	return DevicePostureRuleTypeIntune
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureIntuneInput) Platforms() []string {
+	return devicePosturePlatformsAll
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureIntuneInput) Validate() error {
+	if i.ConnectionID == "" {
+		return errors.New("invalid intune posture rule: missing connection_id")
+	}
+
+	switch i.ComplianceStatus {
+	case DevicePostureIntuneCompliant, DevicePostureIntuneNonCompliant, DevicePostureIntuneUnknown,
+		DevicePostureIntuneNotApplicable, DevicePostureIntuneInGracePeriod, DevicePostureIntuneError:
+		return nil
+	}
+	return errors.Errorf("invalid intune posture rule: unknown compliance_status %q", i.ComplianceStatus)
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureIntuneInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{ConnectionID: i.ConnectionID, ComplianceStatus: i.ComplianceStatus}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureKolideInput) PostureRuleType() string {
+	return DevicePostureRuleTypeKolide
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureKolideInput) Platforms() []string {
+	return devicePosturePlatformsDesktop
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureKolideInput) Validate() error {
+	if i.ConnectionID == "" {
+		return errors.New("invalid kolide posture rule: missing connection_id")
+	}
+	return nil
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureKolideInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{ConnectionID: i.ConnectionID}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureOSVersionInput) PostureRuleType() string {
+	return DevicePostureRuleTypeOSVersion
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureOSVersionInput) Platforms() []string {
+	return devicePosturePlatformsDesktop
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureOSVersionInput) Validate() error {
+	return validateDevicePostureVersion(i.PostureRuleType(), i.Operator, i.Version)
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureOSVersionInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{Operator: i.Operator, Version: i.Version}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureUniqueClientIDInput) PostureRuleType() string {
+	return DevicePostureRuleTypeUniqueClientID
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureUniqueClientIDInput) Platforms() []string {
+	return devicePosturePlatformsAll
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureUniqueClientIDInput) Validate() error {
+	if i.ID == "" {
+		return errors.New("invalid unique_client_id posture rule: missing id")
+	}
+	return nil
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureUniqueClientIDInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{ID: i.ID}
+}
+
+// PostureRuleType implements DevicePostureRuleInputConfig.
+func (i DevicePostureWARPInput) PostureRuleType() string {
+	return DevicePostureRuleTypeWARP
+}
+
+// Platforms implements DevicePostureRuleInputConfig.
+func (i DevicePostureWARPInput) Platforms() []string {
+	return devicePosturePlatformsAll
+}
+
+// Validate implements DevicePostureRuleInputConfig.
+func (i DevicePostureWARPInput) Validate() error {
+	return nil
+}
+
+// Input implements DevicePostureRuleInputConfig.
+func (i DevicePostureWARPInput) Input() DevicePostureRuleInput {
+	return DevicePostureRuleInput{}
+}
+
+// validateDevicePostureVersion checks a version comparison.
+func validateDevicePostureVersion(ruleType, operator, version string) error {
+	switch operator {
+	case DevicePostureOperatorLess, DevicePostureOperatorLessEqual, DevicePostureOperatorGreater,
+		DevicePostureOperatorGreaterEqual, DevicePostureOperatorEqual:
+	default:
+		return errors.Errorf("invalid %s posture rule: unknown operator %q", ruleType, operator)
+	}
+
+	if !devicePostureVersionRegexp.MatchString(version) {
+		return errors.Errorf("invalid %s posture rule: version %q must be in the form major.minor.patch", ruleType, version)
+	}
+	return nil
+}
+
+// validateDevicePostureSha256 checks that an optional file hash is a hex
+// encoded SHA-256 digest.
+func validateDevicePostureSha256(ruleType, sha256 string) error {
+	if sha256 == "" {
+		return nil
+	}
+	if len(sha256) != 64 || strings.Trim(strings.ToLower(sha256), "0123456789abcdef") != "" {
+		return errors.Errorf("invalid %s posture rule: sha256 %q is not a SHA-256 digest", ruleType, sha256)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cloudflare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDevicePostureRule(t *testing.T) {
+	rule, err := NewDevicePostureRule("macOS 12+", DevicePostureOSVersionInput{Operator: ">=", Version: "12.0.0"}, DevicePosturePlatformMac)
+	if assert.NoError(t, err) {
+		assert.Equal(t, DevicePostureRule{
+			Name:  "macOS 12+",
+			Type:  "os_version",
+			Match: []DevicePostureRuleMatch{{Platform: "mac"}},
+			Input: DevicePostureRuleInput{Operator: ">=", Version: "12.0.0"},
+		}, rule)
+
+		input, err := rule.TypedInput()
+		if assert.NoError(t, err) {
+			assert.Equal(t, DevicePostureOSVersionInput{Operator: ">=", Version: "12.0.0"}, input)
+		}
+	}
+
+	rule, err = NewDevicePostureRule("Firewall", DevicePostureFirewallInput{Enabled: true})
+	if assert.NoError(t, err) {
+		assert.Empty(t, rule.Match)
+		assert.Equal(t, DevicePostureRuleInput{Enabled: true}, rule.Input)
+	}
+
+	_, err = NewDevicePostureRule("OS", DevicePostureOSVersionInput{Operator: "~=", Version: "12.0.0"}, DevicePosturePlatformMac)
+	assert.EqualError(t, err, `invalid os_version posture rule: unknown operator "~="`)
+
+	_, err = NewDevicePostureRule("OS", DevicePostureOSVersionInput{Operator: "<", Version: "12"}, DevicePosturePlatformMac)
+	assert.EqualError(t, err, `invalid os_version posture rule: version "12" must be in the form major.minor.patch`)
+
+	_, err = NewDevicePostureRule("OS", DevicePostureOSVersionInput{Operator: "<", Version: "12.0.0"})
+	assert.EqualError(t, err, "invalid os_version posture rule: exactly one platform must be matched")
+
+	_, err = NewDevicePostureRule("Domain", DevicePostureDomainJoinedInput{Domain: "corp.example.com"}, DevicePosturePlatformMac)
+	assert.EqualError(t, err, `invalid domain_joined posture rule: platform "mac" is not supported, use one of windows`)
+
+	_, err = NewDevicePostureRule("File", DevicePostureFileInput{Exists: true})
+	assert.EqualError(t, err, "invalid file posture rule: missing path")
+
+	_, err = NewDevicePostureRule("File", DevicePostureFileInput{Path: "/etc/agent", Sha256: "abc"})
+	assert.EqualError(t, err, `invalid file posture rule: sha256 "abc" is not a SHA-256 digest`)
+
+	_, err = NewDevicePostureRule("Intune", DevicePostureIntuneInput{ConnectionID: "conn", ComplianceStatus: "ok"})
+	assert.EqualError(t, err, `invalid intune posture rule: unknown compliance_status "ok"`)
+
+	_, err = NewDevicePostureRule("Kolide", DevicePostureKolideInput{})
+	assert.EqualError(t, err, "invalid kolide posture rule: missing connection_id")
+}
+
+func TestValidateDevicePostureRule(t *testing.T) {
+	assert.NoError(t, ValidateDevicePostureRule(DevicePostureRule{
+		Type:  "file",
+		Match: []DevicePostureRuleMatch{{Platform: "windows"}, {Platform: "linux"}},
+		Input: DevicePostureRuleInput{Path: `C:\agent.exe`, Exists: true, Sha256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}))
+
+	assert.EqualError(t, ValidateDevicePostureRule(DevicePostureRule{
+		Type:  "firewall",
+		Input: DevicePostureRuleInput{Enabled: true, Path: "/usr/bin/fw", Version: "1.0.0"},
+	}), "invalid firewall posture rule: unsupported fields path, version")
+
+	crowdstrike := DevicePostureRule{
+		Type:  "crowdstrike_s2s",
+		Input: DevicePostureRuleInput{ConnectionID: "bc7cbfbb-600a-42e4-8a23-45b5e85f804f", Operator: ">=", Version: "6.40.0"},
+	}
+	assert.NoError(t, ValidateDevicePostureRule(crowdstrike))
+	input, err := crowdstrike.TypedInput()
+	if assert.NoError(t, err) {
+		assert.Equal(t, crowdstrike.Input, input.Input())
+	}
+
+	crowdstrike.Input.Version = "6.40"
+	assert.EqualError(t, ValidateDevicePostureRule(crowdstrike), `invalid crowdstrike_s2s posture rule: version "6.40" must be in the form major.minor.patch`)
+
+	assert.EqualError(t, ValidateDevicePostureRule(DevicePostureRule{
+		Type:  "firewall",
+		Match: []DevicePostureRuleMatch{{Platform: "linux"}},
+	}), `invalid firewall posture rule: platform "linux" is not supported, use one of windows, mac`)
+
+	assert.EqualError(t, ValidateDevicePostureRule(DevicePostureRule{Type: "tanium"}), `unknown device posture rule type "tanium"`)
+	assert.NoError(t, ValidateDevicePostureRule(DevicePostureRule{Type: "warp", Match: []DevicePostureRuleMatch{{Platform: "ios"}}}))
+}
@@ -12,24 +12,33 @@ import (
 
 // KeylessSSL represents Keyless SSL configuration.
 type KeylessSSL struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Host        string    `json:"host"`
-	Port        int       `json:"port"`
-	Status      string    `json:"status"`
-	Enabled     bool      `json:"enabled"`
-	Permissions []string  `json:"permissions"`
-	CreatedOn   time.Time `json:"created_on"`
-	ModifiedOn  time.Time `json:"modified_on"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Host        string            `json:"host"`
+	Port        int               `json:"port"`
+	Status      string            `json:"status"`
+	Enabled     bool              `json:"enabled"`
+	Permissions []string          `json:"permissions"`
+	CreatedOn   time.Time         `json:"created_on"`
+	ModifiedOn  time.Time         `json:"modified_on"`
+	Tunnel      *KeylessSSLTunnel `json:"tunnel,omitempty"`
+}
+
+// KeylessSSLTunnel routes requests to a keyless server on a private network
+// through Cloudflare Tunnel.
+type KeylessSSLTunnel struct {
+	PrivateIP string `json:"private_ip"`
+	VnetID    string `json:"vnet_id"`
 }
 
 // KeylessSSLCreateRequest represents the request format made for creating KeylessSSL.
 type KeylessSSLCreateRequest struct {
-	Host         string `json:"host"`
-	Port         int    `json:"port"`
-	Certificate  string `json:"certificate"`
-	Name         string `json:"name,omitempty"`
-	BundleMethod string `json:"bundle_method,omitempty"`
+	Host         string            `json:"host"`
+	Port         int               `json:"port"`
+	Certificate  string            `json:"certificate"`
+	Name         string            `json:"name,omitempty"`
+	BundleMethod string            `json:"bundle_method,omitempty"`
+	Tunnel       *KeylessSSLTunnel `json:"tunnel,omitempty"`
 }
 
 // KeylessSSLDetailResponse is the API response, containing a single Keyless SSL.
@@ -0,0 +1,172 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// KeylessSSLCheckOptions configures the local checks of a keyless server.
+type KeylessSSLCheckOptions struct {
+	// PrivateKey is the PEM private key held by the keyless server. When
+	// set it is checked against the certificate being uploaded.
+	PrivateKey string
+	// Address is dialled instead of the configured host and port, for
+	// instance to check against a locally-run keyless stand-in. Servers
+	// behind a tunnel are only dialled when it is set.
+	Address string
+	// SkipConnectivity skips resolving and dialling the keyless server, for
+	// servers only reachable from Cloudflare.
+	SkipConnectivity bool
+	// Timeout limits each connection attempt. Defaults to 5 seconds.
+	Timeout time.Duration
+	// Resolver resolves the keyless host. Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+	// CertificateBundle is passed on to ParseCertificateBundle.
+	CertificateBundle CertificateBundleOptions
+}
+
+// ValidateKeylessSSL checks a keyless configuration before it is created:
+// the port and tunnel settings, that the host resolves and accepts TCP
+// connections, and that the certificate parses and matches opts.PrivateKey.
+// The connection is closed straight away, so a server which accepts it but
+// does not speak the keyless protocol passes. All problems are reported
+// together.
+func ValidateKeylessSSL(ctx context.Context, keylessSSL KeylessSSLCreateRequest, opts KeylessSSLCheckOptions) error {
+	var problems []string
+
+	problems = append(problems, keylessSSLSettingsProblems(keylessSSL.Host, keylessSSL.Port, keylessSSL.Tunnel)...)
+
+	if keylessSSL.Certificate == "" {
+		problems = append(problems, "certificate is required")
+	} else if _, err := ParseCertificateBundle(keylessSSL.Certificate, opts.PrivateKey, opts.CertificateBundle); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if !opts.SkipConnectivity && len(problems) == 0 {
+		if err := checkKeylessSSLConnectivity(ctx, keylessSSL.Host, keylessSSL.Port, keylessSSL.Tunnel, opts); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid keyless configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CreateValidatedKeylessSSL runs ValidateKeylessSSL and creates the
+// configuration if it passes.
+func (api *API) CreateValidatedKeylessSSL(ctx context.Context, zoneID string, keylessSSL KeylessSSLCreateRequest, opts KeylessSSLCheckOptions) (KeylessSSL, error) {
+	if err := ValidateKeylessSSL(ctx, keylessSSL, opts); err != nil {
+		return KeylessSSL{}, err
+	}
+	return api.CreateKeylessSSL(ctx, zoneID, keylessSSL)
+}
+
+// KeylessSSLStatus is a keyless configuration and the problems found with
+// it.
+type KeylessSSLStatus struct {
+	KeylessSSL KeylessSSL
+	Problems   []string
+}
+
+// OK reports whether no problems were found.
+func (s KeylessSSLStatus) OK() bool {
+	return len(s.Problems) == 0
+}
+
+// KeylessSSLStatusReport lists the keyless configurations of a zone and
+// flags those which are disabled, not active, misconfigured or, unless
+// opts.SkipConnectivity is set, whose keyless server does not accept TCP
+// connections. Servers behind a tunnel are not dialled.
+func (api *API) KeylessSSLStatusReport(ctx context.Context, zoneID string, opts KeylessSSLCheckOptions) ([]KeylessSSLStatus, error) {
+	configs, err := api.ListKeylessSSL(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]KeylessSSLStatus, 0, len(configs))
+	for _, config := range configs {
+		status := KeylessSSLStatus{KeylessSSL: config}
+		if !config.Enabled {
+			status.Problems = append(status.Problems, "keyless server is disabled")
+		}
+		if config.Status != "" && config.Status != "active" {
+			status.Problems = append(status.Problems, fmt.Sprintf("status is %s", config.Status))
+		}
+		settings := keylessSSLSettingsProblems(config.Host, config.Port, config.Tunnel)
+		status.Problems = append(status.Problems, settings...)
+
+		if !opts.SkipConnectivity && config.Enabled && len(settings) == 0 {
+			if err := checkKeylessSSLConnectivity(ctx, config.Host, config.Port, config.Tunnel, opts); err != nil {
+				status.Problems = append(status.Problems, err.Error())
+			}
+		}
+		report = append(report, status)
+	}
+
+	return report, nil
+}
+
+// keylessSSLSettingsProblems checks the host, port and tunnel settings of a
+// keyless configuration.
+func keylessSSLSettingsProblems(host string, port int, tunnel *KeylessSSLTunnel) []string {
+	var problems []string
+	if host == "" {
+		problems = append(problems, "host is required")
+	}
+	if port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("port must be between 1 and 65535, got %d", port))
+	}
+	if tunnel != nil {
+		if net.ParseIP(tunnel.PrivateIP) == nil {
+			problems = append(problems, fmt.Sprintf("tunnel private_ip %q is not an IP address", tunnel.PrivateIP))
+		}
+		if tunnel.VnetID == "" {
+			problems = append(problems, "tunnel requires a vnet_id")
+		}
+	}
+	return problems
+}
+
+// checkKeylessSSLConnectivity resolves the keyless host and opens a TCP
+// connection to it, without speaking the keyless protocol. Servers behind a
+// tunnel sit on a private network Cloudflare reaches through the tunnel, so
+// they are skipped unless opts.Address is set.
+func checkKeylessSSLConnectivity(ctx context.Context, host string, port int, tunnel *KeylessSSLTunnel, opts KeylessSSLCheckOptions) error {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	address := opts.Address
+	if address == "" {
+		if tunnel != nil {
+			return nil
+		}
+
+		resolver := opts.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if _, err := resolver.LookupHost(lookupCtx, host); err != nil {
+			return errors.Errorf("host %s does not resolve: %s", host, err)
+		}
+		address = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return errors.Errorf("keyless server %s is not reachable: %s", address, err)
+	}
+	return conn.Close()
+}
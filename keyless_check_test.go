@@ -0,0 +1,115 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenKeylessStandIn starts a TCP listener standing in for a keyless
+// server and returns its port.
+func listenKeylessStandIn(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a port nothing listens on.
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestValidateKeylessSSL(t *testing.T) {
+	ca := newTestCA(t, "Keyless CA", nil)
+	leaf := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"example.com"}}, ca)
+	other := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}}, ca)
+
+	port := listenKeylessStandIn(t)
+	input := KeylessSSLCreateRequest{Host: "127.0.0.1", Port: port, Certificate: leaf.pem}
+
+	assert.NoError(t, ValidateKeylessSSL(context.Background(), input, KeylessSSLCheckOptions{PrivateKey: leaf.keyPEM}))
+
+	err := ValidateKeylessSSL(context.Background(), input, KeylessSSLCheckOptions{PrivateKey: other.keyPEM})
+	assert.EqualError(t, err, "invalid keyless configuration: private key does not match the certificate")
+
+	down := closedPort(t)
+	err = ValidateKeylessSSL(context.Background(), KeylessSSLCreateRequest{Host: "127.0.0.1", Port: down, Certificate: leaf.pem}, KeylessSSLCheckOptions{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid keyless configuration: keyless server 127.0.0.1:"+strconv.Itoa(down)+" is not reachable")
+	}
+
+	// A stand-in address replaces the configured host and port.
+	tunnelled := KeylessSSLCreateRequest{
+		Host:        "keyless.internal.example.com",
+		Port:        2407,
+		Certificate: leaf.pem,
+		Tunnel:      &KeylessSSLTunnel{PrivateIP: "10.0.0.5", VnetID: "vnet"},
+	}
+	assert.NoError(t, ValidateKeylessSSL(context.Background(), tunnelled, KeylessSSLCheckOptions{Address: "127.0.0.1:" + strconv.Itoa(port)}))
+
+	// Without one, tunnelled servers are not dialled as their private IP is
+	// only reachable through the tunnel.
+	tunnelled.Tunnel.PrivateIP = "127.0.0.1"
+	tunnelled.Port = down
+	assert.NoError(t, ValidateKeylessSSL(context.Background(), tunnelled, KeylessSSLCheckOptions{}))
+
+	err = ValidateKeylessSSL(context.Background(), KeylessSSLCreateRequest{
+		Port:   70000,
+		Tunnel: &KeylessSSLTunnel{PrivateIP: "keyless"},
+	}, KeylessSSLCheckOptions{})
+	assert.EqualError(t, err, "invalid keyless configuration: host is required; port must be between 1 and 65535, got 70000; "+
+		`tunnel private_ip "keyless" is not an IP address; tunnel requires a vnet_id; certificate is required`)
+
+	assert.NoError(t, ValidateKeylessSSL(context.Background(), KeylessSSLCreateRequest{Host: "keyless.invalid", Port: 2407, Certificate: leaf.pem}, KeylessSSLCheckOptions{SkipConnectivity: true}))
+}
+
+func TestKeylessSSLStatusReport(t *testing.T) {
+	setup()
+	defer teardown()
+
+	up := listenKeylessStandIn(t)
+	down := closedPort(t)
+
+	mux.HandleFunc("/zones/"+testZoneID+"/keyless_certificates", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		writeFakeResult(t, w, []KeylessSSL{
+			{ID: "healthy", Host: "127.0.0.1", Port: up, Status: "active", Enabled: true},
+			{ID: "disabled", Host: "127.0.0.1", Port: up, Status: "active"},
+			{ID: "unreachable", Host: "127.0.0.1", Port: down, Status: "active", Enabled: true},
+			{ID: "misconfigured", Host: "keyless.example.com", Port: 2407, Status: "deleted", Enabled: true, Tunnel: &KeylessSSLTunnel{PrivateIP: "10.0.0.5"}},
+		})
+	})
+
+	report, err := client.KeylessSSLStatusReport(context.Background(), testZoneID, KeylessSSLCheckOptions{})
+	require.NoError(t, err)
+	require.Len(t, report, 4)
+
+	assert.True(t, report[0].OK())
+	assert.Equal(t, []string{"keyless server is disabled"}, report[1].Problems)
+	if assert.Len(t, report[2].Problems, 1) {
+		assert.Contains(t, report[2].Problems[0], fmt.Sprintf("keyless server 127.0.0.1:%d is not reachable", down))
+	}
+	assert.Equal(t, []string{"status is deleted", "tunnel requires a vnet_id"}, report[3].Problems)
+}
@@ -0,0 +1,388 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	LoadBalancerMonitorTypeHTTP     LoadBalancerMonitorType = "http"
+	LoadBalancerMonitorTypeHTTPS    LoadBalancerMonitorType = "https"
+	LoadBalancerMonitorTypeTCP      LoadBalancerMonitorType = "tcp"
+	LoadBalancerMonitorTypeUDPICMP  LoadBalancerMonitorType = "udp_icmp"
+	LoadBalancerMonitorTypeICMPPing LoadBalancerMonitorType = "icmp_ping"
+	LoadBalancerMonitorTypeSMTP     LoadBalancerMonitorType = "smtp"
+)
+
+// LoadBalancerMonitorTypeValues exposes all the available
+// `LoadBalancerMonitorType` values as a slice of strings.
+func LoadBalancerMonitorTypeValues() []string {
+	return []string{
+		string(LoadBalancerMonitorTypeHTTP),
+		string(LoadBalancerMonitorTypeHTTPS),
+		string(LoadBalancerMonitorTypeTCP),
+		string(LoadBalancerMonitorTypeUDPICMP),
+		string(LoadBalancerMonitorTypeICMPPing),
+		string(LoadBalancerMonitorTypeSMTP),
+	}
+}
+
+// LoadBalancerMonitorType is the custom type for the protocol a load
+// balancer monitor uses to check origins.
+type LoadBalancerMonitorType string
+
+// loadBalancerMonitorMethodTCP is the only method TCP monitors accept.
+const loadBalancerMonitorMethodTCP = "connection_established"
+
+var loadBalancerMonitorExpectedCodesRegexp = regexp.MustCompile(`^[1-5](\d\d|xx)$`)
+
+// LoadBalancerMonitorSettings holds the settings shared by every monitor
+// type. Zero values let the API apply its defaults.
+type LoadBalancerMonitorSettings struct {
+	Description string
+
+	// Timeout is the number of seconds to wait for a response, between 1
+	// and 10.
+	Timeout int
+
+	// Retries is the number of retries before an origin is marked
+	// unhealthy, between 0 and 5.
+	Retries int
+
+	// Interval is the number of seconds between checks, between 5 and
+	// 3600. It must be greater than Timeout.
+	Interval int
+}
+
+// LoadBalancerHTTPMonitor configures an HTTP or HTTPS monitor.
+type LoadBalancerHTTPMonitor struct {
+	LoadBalancerMonitorSettings
+
+	Method          string
+	Path            string
+	Header          map[string][]string
+	Port            uint16
+	ExpectedBody    string
+	ExpectedCodes   string
+	FollowRedirects bool
+	ProbeZone       string
+
+	// AllowInsecure skips certificate validation and is only valid for
+	// HTTPS monitors.
+	AllowInsecure bool
+}
+
+// LoadBalancerPortMonitor configures a TCP, UDP-ICMP or SMTP monitor.
+type LoadBalancerPortMonitor struct {
+	LoadBalancerMonitorSettings
+
+	Port uint16
+}
+
+// NewHTTPLoadBalancerMonitor returns a validated HTTP monitor.
+func NewHTTPLoadBalancerMonitor(m LoadBalancerHTTPMonitor) (LoadBalancerMonitor, error) {
+	return newHTTPLoadBalancerMonitor(LoadBalancerMonitorTypeHTTP, m)
+}
+
+// NewHTTPSLoadBalancerMonitor returns a validated HTTPS monitor.
+func NewHTTPSLoadBalancerMonitor(m LoadBalancerHTTPMonitor) (LoadBalancerMonitor, error) {
+	return newHTTPLoadBalancerMonitor(LoadBalancerMonitorTypeHTTPS, m)
+}
+
+// NewTCPLoadBalancerMonitor returns a validated TCP monitor.
+func NewTCPLoadBalancerMonitor(m LoadBalancerPortMonitor) (LoadBalancerMonitor, error) {
+	return newPortLoadBalancerMonitor(LoadBalancerMonitorTypeTCP, m)
+}
+
+// NewUDPICMPLoadBalancerMonitor returns a validated UDP-ICMP monitor.
+func NewUDPICMPLoadBalancerMonitor(m LoadBalancerPortMonitor) (LoadBalancerMonitor, error) {
+	return newPortLoadBalancerMonitor(LoadBalancerMonitorTypeUDPICMP, m)
+}
+
+// NewSMTPLoadBalancerMonitor returns a validated SMTP monitor.
+func NewSMTPLoadBalancerMonitor(m LoadBalancerPortMonitor) (LoadBalancerMonitor, error) {
+	return newPortLoadBalancerMonitor(LoadBalancerMonitorTypeSMTP, m)
+}
+
+// NewICMPPingLoadBalancerMonitor returns a validated ICMP ping monitor.
+func NewICMPPingLoadBalancerMonitor(m LoadBalancerMonitorSettings) (LoadBalancerMonitor, error) {
+	monitor := LoadBalancerMonitor{
+		Type:        string(LoadBalancerMonitorTypeICMPPing),
+		Description: m.Description,
+		Timeout:     m.Timeout,
+		Retries:     m.Retries,
+		Interval:    m.Interval,
+	}
+
+	return monitor, ValidateLoadBalancerMonitor(monitor)
+}
+
+func newHTTPLoadBalancerMonitor(t LoadBalancerMonitorType, m LoadBalancerHTTPMonitor) (LoadBalancerMonitor, error) {
+	monitor := LoadBalancerMonitor{
+		Type:            string(t),
+		Description:     m.Description,
+		Method:          m.Method,
+		Path:            m.Path,
+		Header:          m.Header,
+		Timeout:         m.Timeout,
+		Retries:         m.Retries,
+		Interval:        m.Interval,
+		Port:            m.Port,
+		ExpectedBody:    m.ExpectedBody,
+		ExpectedCodes:   m.ExpectedCodes,
+		FollowRedirects: m.FollowRedirects,
+		AllowInsecure:   m.AllowInsecure,
+		ProbeZone:       m.ProbeZone,
+	}
+	if monitor.Method == "" {
+		monitor.Method = http.MethodGet
+	}
+	if monitor.Path == "" {
+		monitor.Path = "/"
+	}
+
+	return monitor, ValidateLoadBalancerMonitor(monitor)
+}
+
+func newPortLoadBalancerMonitor(t LoadBalancerMonitorType, m LoadBalancerPortMonitor) (LoadBalancerMonitor, error) {
+	monitor := LoadBalancerMonitor{
+		Type:        string(t),
+		Description: m.Description,
+		Timeout:     m.Timeout,
+		Retries:     m.Retries,
+		Interval:    m.Interval,
+		Port:        m.Port,
+	}
+	if t == LoadBalancerMonitorTypeTCP {
+		monitor.Method = loadBalancerMonitorMethodTCP
+	}
+
+	return monitor, ValidateLoadBalancerMonitor(monitor)
+}
+
+// ValidateLoadBalancerMonitor checks a monitor for settings the API rejects
+// or ignores for its type.
+func ValidateLoadBalancerMonitor(m LoadBalancerMonitor) error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if m.Timeout != 0 && (m.Timeout < 1 || m.Timeout > 10) {
+		problem("timeout must be between 1 and 10 seconds, got %d", m.Timeout)
+	}
+	if m.Retries < 0 || m.Retries > 5 {
+		problem("retries must be between 0 and 5, got %d", m.Retries)
+	}
+	if m.Interval != 0 && (m.Interval < 5 || m.Interval > 3600) {
+		problem("interval must be between 5 and 3600 seconds, got %d", m.Interval)
+	}
+	if m.Timeout != 0 && m.Interval != 0 && m.Timeout >= m.Interval {
+		problem("timeout (%d) must be less than interval (%d)", m.Timeout, m.Interval)
+	}
+
+	switch LoadBalancerMonitorType(m.Type) {
+	case LoadBalancerMonitorTypeHTTP, LoadBalancerMonitorTypeHTTPS:
+		if m.Method != http.MethodGet && m.Method != http.MethodHead {
+			problem("method must be GET or HEAD, got %q", m.Method)
+		}
+		if !strings.HasPrefix(m.Path, "/") {
+			problem("path must start with /, got %q", m.Path)
+		}
+		if !loadBalancerMonitorExpectedCodesRegexp.MatchString(m.ExpectedCodes) {
+			problem("expected codes must be a status code such as 200 or a range such as 2xx, got %q", m.ExpectedCodes)
+		}
+		if m.Method == http.MethodHead && m.ExpectedBody != "" {
+			problem("expected body cannot be checked with the HEAD method")
+		}
+		if m.AllowInsecure && m.Type != string(LoadBalancerMonitorTypeHTTPS) {
+			problem("allow insecure is only valid for https monitors")
+		}
+	case LoadBalancerMonitorTypeTCP, LoadBalancerMonitorTypeUDPICMP, LoadBalancerMonitorTypeSMTP, LoadBalancerMonitorTypeICMPPing:
+		if m.Path != "" || m.ExpectedBody != "" || m.ExpectedCodes != "" || len(m.Header) > 0 ||
+			m.FollowRedirects || m.AllowInsecure || m.ProbeZone != "" {
+			problem("%s monitors do not support HTTP settings", m.Type)
+		}
+		if m.Method != "" && !(m.Type == string(LoadBalancerMonitorTypeTCP) && m.Method == loadBalancerMonitorMethodTCP) {
+			problem("%s monitors do not support method %q", m.Type, m.Method)
+		}
+		if LoadBalancerMonitorType(m.Type) == LoadBalancerMonitorTypeICMPPing && m.Port != 0 {
+			problem("icmp_ping monitors do not use a port")
+		}
+		if LoadBalancerMonitorType(m.Type) == LoadBalancerMonitorTypeTCP && m.Port == 0 {
+			problem("tcp monitors require a port")
+		}
+	default:
+		problem("unknown monitor type %q, expected one of %s", m.Type, strings.Join(LoadBalancerMonitorTypeValues(), ", "))
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid load balancer monitor: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// LoadBalancerPoolHealthEvent reports a change in health of a pool, or of one
+// of its origins, as seen from a health check region.
+type LoadBalancerPoolHealthEvent struct {
+	Time   time.Time
+	PoolID string
+	Region string
+
+	// Origin is the address of the origin whose health changed, or empty
+	// when the event is about the pool.
+	Origin string
+
+	Healthy bool
+
+	// Health is the latest check result for the origin.
+	Health LoadBalancerOriginHealth
+
+	// Err is set when the pool health could not be fetched. Polling
+	// continues after errors.
+	Err error
+}
+
+func (e LoadBalancerPoolHealthEvent) String() string {
+	if e.Err != nil {
+		return fmt.Sprintf("pool %s: %s", e.PoolID, e.Err)
+	}
+
+	state := "unhealthy"
+	if e.Healthy {
+		state = "healthy"
+	}
+
+	if e.Origin == "" {
+		return fmt.Sprintf("pool %s went %s in region %s", e.PoolID, state, e.Region)
+	}
+
+	msg := fmt.Sprintf("origin %s in pool %s went %s in region %s", e.Origin, e.PoolID, state, e.Region)
+	if !e.Healthy && e.Health.FailureReason != "" {
+		msg += ": " + e.Health.FailureReason
+	}
+	return msg
+}
+
+// WatchPoolHealth polls the health of pools every interval and emits an
+// event whenever a pool or origin changes health in a region. The first poll
+// only reports what is unhealthy. The interval defaults to 1 minute. The
+// channel is closed once ctx is done. At least one pool must be given.
+func (api *API) WatchPoolHealth(ctx context.Context, interval time.Duration, poolIDs ...string) (<-chan LoadBalancerPoolHealthEvent, error) {
+	if len(poolIDs) == 0 {
+		return nil, errors.New("at least one pool ID must be provided")
+	}
+
+	events := make(chan LoadBalancerPoolHealthEvent)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		previous := make(map[string]bool)
+		for {
+			for _, poolID := range poolIDs {
+				health, err := api.PoolHealthDetails(ctx, poolID)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					if !sendPoolHealthEvent(ctx, events, LoadBalancerPoolHealthEvent{Time: time.Now(), PoolID: poolID, Err: err}) {
+						return
+					}
+					continue
+				}
+
+				for _, e := range diffPoolHealth(previous, poolID, health) {
+					if !sendPoolHealthEvent(ctx, events, e) {
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func sendPoolHealthEvent(ctx context.Context, events chan<- LoadBalancerPoolHealthEvent, e LoadBalancerPoolHealthEvent) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// diffPoolHealth compares the health of a pool with the previously seen
+// state, updating it and returning the changes in a stable order.
+func diffPoolHealth(previous map[string]bool, poolID string, health LoadBalancerPoolHealth) []LoadBalancerPoolHealthEvent {
+	now := time.Now()
+	regions := make([]string, 0, len(health.PopHealth))
+	for region := range health.PopHealth {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var events []LoadBalancerPoolHealthEvent
+	changed := func(key string, healthy bool) bool {
+		prev, seen := previous[key]
+		previous[key] = healthy
+		return (seen && prev != healthy) || (!seen && !healthy)
+	}
+
+	for _, region := range regions {
+		ph := health.PopHealth[region]
+		if changed(poolID+"|"+region, ph.Healthy) {
+			events = append(events, LoadBalancerPoolHealthEvent{
+				Time:    now,
+				PoolID:  poolID,
+				Region:  region,
+				Healthy: ph.Healthy,
+			})
+		}
+
+		for _, origins := range ph.Origins {
+			addresses := make([]string, 0, len(origins))
+			for address := range origins {
+				addresses = append(addresses, address)
+			}
+			sort.Strings(addresses)
+
+			for _, address := range addresses {
+				oh := origins[address]
+				if changed(poolID+"|"+region+"|"+address, oh.Healthy) {
+					events = append(events, LoadBalancerPoolHealthEvent{
+						Time:    now,
+						PoolID:  poolID,
+						Region:  region,
+						Origin:  address,
+						Healthy: oh.Healthy,
+						Health:  oh,
+					})
+				}
+			}
+		}
+	}
+
+	return events
+}
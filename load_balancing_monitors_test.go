@@ -0,0 +1,220 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPSLoadBalancerMonitor(t *testing.T) {
+	monitor, err := NewHTTPSLoadBalancerMonitor(LoadBalancerHTTPMonitor{
+		LoadBalancerMonitorSettings: LoadBalancerMonitorSettings{
+			Description: "Login page monitor",
+			Timeout:     3,
+			Retries:     0,
+			Interval:    90,
+		},
+		Path:          "/status",
+		Header:        map[string][]string{"Host": {"example.com"}},
+		ExpectedBody:  "alive",
+		ExpectedCodes: "2xx",
+		AllowInsecure: true,
+	})
+
+	want := LoadBalancerMonitor{
+		Type:          "https",
+		Description:   "Login page monitor",
+		Method:        http.MethodGet,
+		Path:          "/status",
+		Header:        map[string][]string{"Host": {"example.com"}},
+		Timeout:       3,
+		Interval:      90,
+		ExpectedBody:  "alive",
+		ExpectedCodes: "2xx",
+		AllowInsecure: true,
+	}
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, want, monitor)
+	}
+}
+
+func TestNewHTTPLoadBalancerMonitor_Invalid(t *testing.T) {
+	_, err := NewHTTPLoadBalancerMonitor(LoadBalancerHTTPMonitor{
+		LoadBalancerMonitorSettings: LoadBalancerMonitorSettings{
+			Timeout:  10,
+			Interval: 10,
+		},
+		Method:        http.MethodHead,
+		Path:          "status",
+		ExpectedBody:  "alive",
+		ExpectedCodes: "600",
+		AllowInsecure: true,
+	})
+
+	assert.EqualError(t, err, "invalid load balancer monitor: "+
+		"timeout (10) must be less than interval (10); "+
+		`path must start with /, got "status"; `+
+		`expected codes must be a status code such as 200 or a range such as 2xx, got "600"; `+
+		"expected body cannot be checked with the HEAD method; "+
+		"allow insecure is only valid for https monitors")
+
+	_, err = NewHTTPLoadBalancerMonitor(LoadBalancerHTTPMonitor{Method: http.MethodPost, ExpectedCodes: "200"})
+	assert.EqualError(t, err, `invalid load balancer monitor: method must be GET or HEAD, got "POST"`)
+}
+
+func TestNewPortLoadBalancerMonitors(t *testing.T) {
+	monitor, err := NewTCPLoadBalancerMonitor(LoadBalancerPortMonitor{Port: 8080})
+	if assert.NoError(t, err) {
+		assert.Equal(t, LoadBalancerMonitor{Type: "tcp", Method: "connection_established", Port: 8080}, monitor)
+	}
+
+	monitor, err = NewUDPICMPLoadBalancerMonitor(LoadBalancerPortMonitor{Port: 53})
+	if assert.NoError(t, err) {
+		assert.Equal(t, LoadBalancerMonitor{Type: "udp_icmp", Port: 53}, monitor)
+	}
+
+	monitor, err = NewSMTPLoadBalancerMonitor(LoadBalancerPortMonitor{
+		LoadBalancerMonitorSettings: LoadBalancerMonitorSettings{Retries: 6},
+	})
+	assert.EqualError(t, err, "invalid load balancer monitor: retries must be between 0 and 5, got 6")
+	assert.Equal(t, "smtp", monitor.Type)
+
+	monitor, err = NewICMPPingLoadBalancerMonitor(LoadBalancerMonitorSettings{Interval: 60, Timeout: 2})
+	if assert.NoError(t, err) {
+		assert.Equal(t, LoadBalancerMonitor{Type: "icmp_ping", Interval: 60, Timeout: 2}, monitor)
+	}
+}
+
+func TestValidateLoadBalancerMonitor(t *testing.T) {
+	assert.EqualError(t, ValidateLoadBalancerMonitor(LoadBalancerMonitor{Type: "ftp"}),
+		`invalid load balancer monitor: unknown monitor type "ftp", expected one of http, https, tcp, udp_icmp, icmp_ping, smtp`)
+
+	assert.EqualError(t, ValidateLoadBalancerMonitor(LoadBalancerMonitor{Type: "tcp", Port: 80, Path: "/", ExpectedCodes: "200"}),
+		"invalid load balancer monitor: tcp monitors do not support HTTP settings")
+
+	assert.EqualError(t, ValidateLoadBalancerMonitor(LoadBalancerMonitor{Type: "tcp", Method: "connection_established"}),
+		"invalid load balancer monitor: tcp monitors require a port")
+
+	assert.EqualError(t, ValidateLoadBalancerMonitor(LoadBalancerMonitor{Type: "icmp_ping", Port: 80, Method: "GET"}),
+		`invalid load balancer monitor: icmp_ping monitors do not support method "GET"; icmp_ping monitors do not use a port`)
+
+	assert.EqualError(t, ValidateLoadBalancerMonitor(LoadBalancerMonitor{Type: "http", Method: "GET", Path: "/", ExpectedCodes: "200", Timeout: 11, Interval: 4}),
+		"invalid load balancer monitor: timeout must be between 1 and 10 seconds, got 11; interval must be between 5 and 3600 seconds, got 4; timeout (11) must be less than interval (4)")
+}
+
+func TestWatchPoolHealth(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var mu sync.Mutex
+	responses := []string{
+		// Initial state: only unhealthy items are reported.
+		`{"pool_id": "17b5962d775c646f3f9725cbc7a53df4", "pop_health": {
+            "Amsterdam, NL": {"healthy": true, "origins": [{"192.0.2.1": {"healthy": true}}, {"192.0.2.2": {"healthy": false, "failure_reason": "TCP connection failed"}}]}
+        }}`,
+		// No change.
+		`{"pool_id": "17b5962d775c646f3f9725cbc7a53df4", "pop_health": {
+            "Amsterdam, NL": {"healthy": true, "origins": [{"192.0.2.1": {"healthy": true}}, {"192.0.2.2": {"healthy": false, "failure_reason": "TCP connection failed"}}]}
+        }}`,
+		// The remaining origin fails, taking the pool with it.
+		`{"pool_id": "17b5962d775c646f3f9725cbc7a53df4", "pop_health": {
+            "Amsterdam, NL": {"healthy": false, "origins": [{"192.0.2.1": {"healthy": false, "failure_reason": "HTTP timeout occurred"}}, {"192.0.2.2": {"healthy": false}}]}
+        }}`,
+		// Everything recovers.
+		`{"pool_id": "17b5962d775c646f3f9725cbc7a53df4", "pop_health": {
+            "Amsterdam, NL": {"healthy": true, "origins": [{"192.0.2.1": {"healthy": true}}, {"192.0.2.2": {"healthy": true}}]}
+        }}`,
+	}
+	calls := 0
+
+	mux.HandleFunc("/user/load_balancers/pools/17b5962d775c646f3f9725cbc7a53df4/health", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		mu.Lock()
+		defer mu.Unlock()
+
+		if calls == 1 {
+			calls++
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success": false, "errors": [{"code": 1000, "message": "boom"}], "messages": [], "result": null}`)
+			return
+		}
+
+		i := calls
+		if i > 1 {
+			i--
+		}
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		calls++
+
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, responses[i])
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := client.WatchPoolHealth(ctx, time.Millisecond, "17b5962d775c646f3f9725cbc7a53df4")
+	require.NoError(t, err)
+
+	var got []string
+	for e := range events {
+		got = append(got, e.String())
+		if len(got) == 7 {
+			cancel()
+		}
+	}
+
+	assert.Equal(t, []string{
+		"origin 192.0.2.2 in pool 17b5962d775c646f3f9725cbc7a53df4 went unhealthy in region Amsterdam, NL: TCP connection failed",
+		"pool 17b5962d775c646f3f9725cbc7a53df4: HTTP status 400: boom (1000)",
+		"pool 17b5962d775c646f3f9725cbc7a53df4 went unhealthy in region Amsterdam, NL",
+		"origin 192.0.2.1 in pool 17b5962d775c646f3f9725cbc7a53df4 went unhealthy in region Amsterdam, NL: HTTP timeout occurred",
+		"pool 17b5962d775c646f3f9725cbc7a53df4 went healthy in region Amsterdam, NL",
+		"origin 192.0.2.1 in pool 17b5962d775c646f3f9725cbc7a53df4 went healthy in region Amsterdam, NL",
+		"origin 192.0.2.2 in pool 17b5962d775c646f3f9725cbc7a53df4 went healthy in region Amsterdam, NL",
+	}, got)
+}
+
+func TestWatchPoolHealth_DefaultInterval(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The response carries no pool ID; events use the one being watched.
+	mux.HandleFunc("/user/load_balancers/pools/17b5962d775c646f3f9725cbc7a53df4/health", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": {"pop_health": {
+            "Amsterdam, NL": {"healthy": false, "origins": []}
+        }}}`)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := client.WatchPoolHealth(ctx, 0, "17b5962d775c646f3f9725cbc7a53df4")
+	require.NoError(t, err)
+	e := <-events
+	cancel()
+	assert.Equal(t, "17b5962d775c646f3f9725cbc7a53df4", e.PoolID)
+	assert.Equal(t, "pool 17b5962d775c646f3f9725cbc7a53df4 went unhealthy in region Amsterdam, NL", e.String())
+	for range events {
+	}
+}
+
+func TestWatchPoolHealth_NoPools(t *testing.T) {
+	setup()
+	defer teardown()
+
+	events, err := client.WatchPoolHealth(context.Background(), time.Millisecond)
+	assert.EqualError(t, err, "at least one pool ID must be provided")
+	assert.Nil(t, events)
+}
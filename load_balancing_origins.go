@@ -0,0 +1,211 @@
+package cloudflare
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LoadBalancerOriginUpdate describes a change to an origin, applied to every
+// pool containing an origin with that name. Nil fields are left untouched.
+type LoadBalancerOriginUpdate struct {
+	Name    string
+	Enabled *bool
+	Weight  *float64
+}
+
+// LoadBalancerOriginState is the state of an origin in a pool before it was
+// updated, used to restore it afterwards.
+type LoadBalancerOriginState struct {
+	PoolID  string  `json:"pool_id"`
+	Name    string  `json:"name"`
+	Address string  `json:"address"`
+	Enabled bool    `json:"enabled"`
+	Weight  float64 `json:"weight"`
+}
+
+// UpdateLoadBalancerOrigin applies an update to a named origin across all
+// pools that contain it and returns the previous state of the origin in each
+// pool. Each pool is fetched immediately before it is modified and only the
+// named origin is changed, but the whole pool is saved without a conflict
+// check: edits made to a pool between the fetch and the update are lost.
+//
+// When an error occurs the states of the pools updated so far are returned
+// alongside it, so they can be passed to RestoreLoadBalancerOrigins.
+func (api *API) UpdateLoadBalancerOrigin(ctx context.Context, update LoadBalancerOriginUpdate) ([]LoadBalancerOriginState, error) {
+	if update.Name == "" {
+		return nil, errors.New("origin name must be provided")
+	}
+
+	if update.Weight != nil && (*update.Weight < 0 || *update.Weight > 1) {
+		return nil, errors.Errorf("origin weight must be between 0 and 1, got %g", *update.Weight)
+	}
+
+	pools, err := api.ListLoadBalancerPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []LoadBalancerOriginState
+	for _, p := range pools {
+		if findLoadBalancerOrigin(p, update.Name) < 0 {
+			continue
+		}
+
+		state, err := api.updateLoadBalancerPoolOrigin(ctx, p.ID, update.Name, update.Enabled, update.Weight)
+		if state.PoolID != "" {
+			states = append(states, state)
+		}
+		if err != nil {
+			return states, errors.Wrapf(err, "failed to update origin %q in pool %s", update.Name, p.ID)
+		}
+	}
+
+	if len(states) == 0 {
+		return nil, errors.Errorf("origin %q not found in any pool", update.Name)
+	}
+
+	return states, nil
+}
+
+// RestoreLoadBalancerOrigins sets the enabled state and weight of origins
+// back to the values recorded by UpdateLoadBalancerOrigin.
+func (api *API) RestoreLoadBalancerOrigins(ctx context.Context, states []LoadBalancerOriginState) error {
+	for _, s := range states {
+		enabled, weight := s.Enabled, s.Weight
+		if _, err := api.updateLoadBalancerPoolOrigin(ctx, s.PoolID, s.Name, &enabled, &weight); err != nil {
+			return errors.Wrapf(err, "failed to restore origin %q in pool %s", s.Name, s.PoolID)
+		}
+	}
+
+	return nil
+}
+
+// WaitForLoadBalancerOriginHealth polls the health of the pools in states
+// every interval until it reflects the origins being enabled or disabled. A
+// disabled origin must no longer be reported healthy from any region while an
+// enabled origin must be reported healthy from a majority of regions. The
+// interval defaults to 10 seconds.
+func (api *API) WaitForLoadBalancerOriginHealth(ctx context.Context, states []LoadBalancerOriginState, enabled bool, interval time.Duration) error {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pending := append([]LoadBalancerOriginState{}, states...)
+	for {
+		var remaining []LoadBalancerOriginState
+		for _, s := range pending {
+			health, err := api.PoolHealthDetails(ctx, s.PoolID)
+			if err != nil {
+				return err
+			}
+
+			healthy, total := loadBalancerOriginHealthCount(health, s.Address)
+			done := healthy == 0
+			if enabled {
+				done = total > 0 && healthy*2 > total
+			}
+			if !done {
+				remaining = append(remaining, s)
+			}
+		}
+
+		if len(remaining) == 0 {
+			return nil
+		}
+		pending = remaining
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "pool health did not reflect the origin change")
+		}
+	}
+}
+
+// DrainLoadBalancerOrigin disables a named origin in every pool containing
+// it and waits until pool health no longer reports it as healthy. The
+// returned states restore the origin with RestoreLoadBalancerOrigins. Callers
+// which must save the states before the wait, which can take minutes, should
+// use UpdateLoadBalancerOrigin and WaitForLoadBalancerOriginHealth instead.
+func (api *API) DrainLoadBalancerOrigin(ctx context.Context, name string, interval time.Duration) ([]LoadBalancerOriginState, error) {
+	states, err := api.UpdateLoadBalancerOrigin(ctx, LoadBalancerOriginUpdate{Name: name, Enabled: BoolPtr(false)})
+	if err != nil {
+		return states, err
+	}
+
+	return states, api.WaitForLoadBalancerOriginHealth(ctx, states, false, interval)
+}
+
+// updateLoadBalancerPoolOrigin fetches a pool, changes a single origin and
+// saves the pool, returning the previous state of the origin. The state is
+// returned with the error when the pool was saved but does not reflect the
+// change, as the pool may still need restoring.
+func (api *API) updateLoadBalancerPoolOrigin(ctx context.Context, poolID, name string, enabled *bool, weight *float64) (LoadBalancerOriginState, error) {
+	pool, err := api.LoadBalancerPoolDetails(ctx, poolID)
+	if err != nil {
+		return LoadBalancerOriginState{}, err
+	}
+
+	i := findLoadBalancerOrigin(pool, name)
+	if i < 0 {
+		return LoadBalancerOriginState{}, errors.Errorf("origin %q no longer exists in pool %s", name, poolID)
+	}
+
+	origin := pool.Origins[i]
+	state := LoadBalancerOriginState{
+		PoolID:  poolID,
+		Name:    origin.Name,
+		Address: origin.Address,
+		Enabled: origin.Enabled,
+		Weight:  origin.Weight,
+	}
+
+	if enabled != nil {
+		origin.Enabled = *enabled
+	}
+	if weight != nil {
+		origin.Weight = *weight
+	}
+	pool.Origins[i] = origin
+
+	updated, err := api.ModifyLoadBalancerPool(ctx, pool)
+	if err != nil {
+		return LoadBalancerOriginState{}, err
+	}
+
+	if j := findLoadBalancerOrigin(updated, name); j < 0 || updated.Origins[j].Enabled != origin.Enabled || updated.Origins[j].Weight != origin.Weight {
+		return state, errors.Errorf("pool %s did not apply the change to origin %q", poolID, name)
+	}
+
+	return state, nil
+}
+
+func findLoadBalancerOrigin(pool LoadBalancerPool, name string) int {
+	for i, o := range pool.Origins {
+		if o.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadBalancerOriginHealthCount returns how many regions report the origin
+// healthy and how many report it at all.
+func loadBalancerOriginHealthCount(health LoadBalancerPoolHealth, address string) (int, int) {
+	healthy, total := 0, 0
+	for _, ph := range health.PopHealth {
+		for _, origins := range ph.Origins {
+			if h, ok := origins[address]; ok {
+				total++
+				if h.Healthy {
+					healthy++
+				}
+			}
+		}
+	}
+	return healthy, total
+}
@@ -0,0 +1,248 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testLoadBalancerOriginPools = `[
+  {
+    "id": "pool-1",
+    "name": "primary",
+    "enabled": true,
+    "origins": [
+      {"name": "app-1", "address": "192.0.2.1", "enabled": true, "weight": 1},
+      {"name": "app-2", "address": "192.0.2.2", "enabled": true, "weight": 1}
+    ]
+  },
+  {
+    "id": "pool-2",
+    "name": "secondary",
+    "enabled": true,
+    "origins": [
+      {"name": "app-1", "address": "192.0.2.1", "enabled": true, "weight": 0.5}
+    ]
+  },
+  {
+    "id": "pool-3",
+    "name": "other",
+    "enabled": true,
+    "origins": [
+      {"name": "app-3", "address": "192.0.2.3", "enabled": true, "weight": 1}
+    ]
+  }
+]`
+
+func handleLoadBalancerOriginPools(t *testing.T) {
+	mux.HandleFunc("/user/load_balancers/pools", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, testLoadBalancerOriginPools)
+	})
+}
+
+// handleLoadBalancerOriginPool serves pool on GET and echoes the pool saved on
+// PUT after checking its origins against expected.
+func handleLoadBalancerOriginPool(t *testing.T, id, pool string, expected []LoadBalancerOrigin) {
+	mux.HandleFunc("/user/load_balancers/pools/"+id, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, pool)
+		case http.MethodPut:
+			b, err := ioutil.ReadAll(r.Body)
+			defer r.Body.Close()
+			var saved LoadBalancerPool
+			if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(b, &saved)) {
+				assert.Equal(t, id, saved.ID)
+				assert.Equal(t, expected, saved.Origins)
+			}
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, b)
+		default:
+			t.Errorf("Expected method 'GET' or 'PUT', got %s", r.Method)
+		}
+	})
+}
+
+func TestUpdateLoadBalancerOrigin(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleLoadBalancerOriginPools(t)
+	handleLoadBalancerOriginPool(t, "pool-1", `{
+      "id": "pool-1",
+      "name": "primary",
+      "enabled": true,
+      "origins": [
+        {"name": "app-1", "address": "192.0.2.1", "enabled": true, "weight": 1},
+        {"name": "app-2", "address": "192.0.2.2", "enabled": true, "weight": 0.3}
+      ]
+    }`, []LoadBalancerOrigin{
+		{Name: "app-1", Address: "192.0.2.1", Enabled: true, Weight: 0.1},
+		{Name: "app-2", Address: "192.0.2.2", Enabled: true, Weight: 0.3},
+	})
+	handleLoadBalancerOriginPool(t, "pool-2", `{
+      "id": "pool-2",
+      "name": "secondary",
+      "enabled": true,
+      "origins": [{"name": "app-1", "address": "192.0.2.1", "enabled": true, "weight": 0.5}]
+    }`, []LoadBalancerOrigin{
+		{Name: "app-1", Address: "192.0.2.1", Enabled: true, Weight: 0.1},
+	})
+
+	states, err := client.UpdateLoadBalancerOrigin(context.Background(), LoadBalancerOriginUpdate{Name: "app-1", Weight: Float64Ptr(0.1)})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []LoadBalancerOriginState{
+			{PoolID: "pool-1", Name: "app-1", Address: "192.0.2.1", Enabled: true, Weight: 1},
+			{PoolID: "pool-2", Name: "app-1", Address: "192.0.2.1", Enabled: true, Weight: 0.5},
+		}, states)
+	}
+}
+
+func TestUpdateLoadBalancerOrigin_Errors(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleLoadBalancerOriginPools(t)
+
+	_, err := client.UpdateLoadBalancerOrigin(context.Background(), LoadBalancerOriginUpdate{Name: "app-9", Enabled: BoolPtr(false)})
+	assert.EqualError(t, err, `origin "app-9" not found in any pool`)
+
+	_, err = client.UpdateLoadBalancerOrigin(context.Background(), LoadBalancerOriginUpdate{Name: "app-1", Weight: Float64Ptr(2)})
+	assert.EqualError(t, err, "origin weight must be between 0 and 1, got 2")
+
+	_, err = client.UpdateLoadBalancerOrigin(context.Background(), LoadBalancerOriginUpdate{})
+	assert.EqualError(t, err, "origin name must be provided")
+}
+
+func TestUpdateLoadBalancerOrigin_NotApplied(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleLoadBalancerOriginPools(t)
+	mux.HandleFunc("/user/load_balancers/pools/pool-1", func(w http.ResponseWriter, r *http.Request) {
+		// The pool is saved but comes back without the change.
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+          "success": true,
+          "errors": [],
+          "messages": [],
+          "result": {
+            "id": "pool-1",
+            "origins": [{"name": "app-1", "address": "192.0.2.1", "enabled": true, "weight": 1}]
+          }
+        }`)
+	})
+
+	states, err := client.UpdateLoadBalancerOrigin(context.Background(), LoadBalancerOriginUpdate{Name: "app-1", Enabled: BoolPtr(false)})
+	assert.EqualError(t, err, `failed to update origin "app-1" in pool pool-1: pool pool-1 did not apply the change to origin "app-1"`)
+	assert.Equal(t, []LoadBalancerOriginState{
+		{PoolID: "pool-1", Name: "app-1", Address: "192.0.2.1", Enabled: true, Weight: 1},
+	}, states)
+}
+
+func TestRestoreLoadBalancerOrigins(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleLoadBalancerOriginPool(t, "pool-1", `{
+      "id": "pool-1",
+      "origins": [
+        {"name": "app-1", "address": "192.0.2.1", "enabled": false, "weight": 0.1},
+        {"name": "app-2", "address": "192.0.2.2", "enabled": true, "weight": 0.3}
+      ]
+    }`, []LoadBalancerOrigin{
+		{Name: "app-1", Address: "192.0.2.1", Enabled: true, Weight: 1},
+		{Name: "app-2", Address: "192.0.2.2", Enabled: true, Weight: 0.3},
+	})
+
+	err := client.RestoreLoadBalancerOrigins(context.Background(), []LoadBalancerOriginState{
+		{PoolID: "pool-1", Name: "app-1", Address: "192.0.2.1", Enabled: true, Weight: 1},
+	})
+	assert.NoError(t, err)
+}
+
+func TestDrainLoadBalancerOrigin(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleLoadBalancerOriginPools(t)
+	handleLoadBalancerOriginPool(t, "pool-3", `{
+      "id": "pool-3",
+      "origins": [{"name": "app-3", "address": "192.0.2.3", "enabled": true, "weight": 1}]
+    }`, []LoadBalancerOrigin{
+		{Name: "app-3", Address: "192.0.2.3", Enabled: false, Weight: 1},
+	})
+
+	// Health checks take a poll to notice the origin was disabled.
+	polls := 0
+	mux.HandleFunc("/user/load_balancers/pools/pool-3/health", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		polls++
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{
+          "success": true,
+          "errors": [],
+          "messages": [],
+          "result": {
+            "pool_id": "pool-3",
+            "pop_health": {
+              "Amsterdam, NL": {"healthy": true, "origins": [{"192.0.2.3": {"healthy": %t}}]}
+            }
+          }
+        }`, polls == 1)
+	})
+
+	states, err := client.DrainLoadBalancerOrigin(context.Background(), "app-3", 5*time.Millisecond)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []LoadBalancerOriginState{
+			{PoolID: "pool-3", Name: "app-3", Address: "192.0.2.3", Enabled: true, Weight: 1},
+		}, states)
+	}
+	assert.Equal(t, 2, polls)
+
+	// A non-positive interval falls back to the default rather than
+	// panicking; the origin is already drained so no tick is needed.
+	assert.NoError(t, client.WaitForLoadBalancerOriginHealth(context.Background(), states, false, 0))
+}
+
+func TestWaitForLoadBalancerOriginHealth_Timeout(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/user/load_balancers/pools/pool-3/health", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+          "success": true,
+          "errors": [],
+          "messages": [],
+          "result": {
+            "pool_id": "pool-3",
+            "pop_health": {
+              "Amsterdam, NL": {"healthy": true, "origins": [{"192.0.2.3": {"healthy": true}}]}
+            }
+          }
+        }`)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	states := []LoadBalancerOriginState{{PoolID: "pool-3", Name: "app-3", Address: "192.0.2.3"}}
+	assert.Error(t, client.WaitForLoadBalancerOriginHealth(ctx, states, false, 5*time.Millisecond))
+}
+
+func writeFakeResult(t *testing.T, w http.ResponseWriter, result interface{}) {
+	b, err := json.Marshal(result)
+	assert.NoError(t, err)
+	w.Header().Set("content-type", "application/json")
+	fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, b)
+}
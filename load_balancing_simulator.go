@@ -0,0 +1,563 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// LoadBalancerSimulationRequest describes the visitor a simulated request
+// comes from.
+type LoadBalancerSimulationRequest struct {
+	// Country is the ISO 3166-1 alpha-2 country code of the visitor.
+	Country string
+
+	// PoP is the three letter code of the Cloudflare data center receiving
+	// the request.
+	PoP string
+
+	// Region is the load balancer region code of the PoP, e.g. "WNAM". It
+	// selects the health check results to use, falling back to PoP when
+	// the results have no entry for the region.
+	Region string
+
+	// Latitude and Longitude of the visitor, used by the proximity steering
+	// policy.
+	Latitude  *float32
+	Longitude *float32
+
+	// MatchedRules are the names of the load balancer rules whose condition
+	// matches the request. Rule conditions are not evaluated locally.
+	MatchedRules []string
+
+	// AffinityOrigin is the name of the origin a previous response pinned
+	// the session to, when session affinity is enabled.
+	AffinityOrigin string
+}
+
+// LoadBalancerSimulationResult is the predicted routing of a request.
+type LoadBalancerSimulationResult struct {
+	// SteeringPolicy is the policy used once rules and defaults are applied.
+	SteeringPolicy string
+
+	// Rules are the names of the rules applied to the request.
+	Rules []string
+
+	// FixedResponse is set when a rule answers the request directly; Pool
+	// and Origin are empty in that case.
+	FixedResponse *LoadBalancerFixedResponseData
+
+	// Candidates are the pools considered, in order.
+	Candidates []string
+
+	// Pool is the ID of the pool the request lands on.
+	Pool string
+
+	// Origin is the name of the origin the request lands on.
+	Origin string
+
+	// OriginWeights is the probability of each healthy origin of Pool being
+	// selected for a new session.
+	OriginWeights map[string]float64
+
+	// Failover is true when one or more candidate pools were skipped for
+	// being unhealthy.
+	Failover bool
+
+	// Fallback is true when every candidate pool was unhealthy and the
+	// fallback pool was used.
+	Fallback bool
+
+	// Trace explains each decision taken.
+	Trace []string
+}
+
+// LoadBalancerSimulator predicts which pool and origin of a load balancer a
+// request lands on, given the health of its pools.
+type LoadBalancerSimulator struct {
+	LoadBalancer LoadBalancer
+	Pools        map[string]LoadBalancerPool
+	Health       map[string]LoadBalancerPoolHealth
+
+	// Rand is used to order pools for the random steering policy and to
+	// pick origins. When nil the most heavily weighted origin is picked and
+	// random steering keeps the default pool order.
+	Rand *rand.Rand
+
+	unhealthyPools   map[string]bool
+	unhealthyOrigins map[string]map[string]bool
+}
+
+// NewLoadBalancerSimulator returns a simulator for a load balancer, its pools
+// and their health.
+func NewLoadBalancerSimulator(lb LoadBalancer, pools []LoadBalancerPool, health []LoadBalancerPoolHealth) *LoadBalancerSimulator {
+	s := &LoadBalancerSimulator{
+		LoadBalancer:     lb,
+		Pools:            make(map[string]LoadBalancerPool),
+		Health:           make(map[string]LoadBalancerPoolHealth),
+		unhealthyPools:   make(map[string]bool),
+		unhealthyOrigins: make(map[string]map[string]bool),
+	}
+	for _, p := range pools {
+		s.Pools[p.ID] = p
+	}
+	for _, h := range health {
+		s.Health[h.ID] = h
+	}
+
+	return s
+}
+
+// LoadBalancerSimulator fetches a load balancer along with the details and
+// health of every pool it references.
+func (api *API) LoadBalancerSimulator(ctx context.Context, zoneID, lbID string) (*LoadBalancerSimulator, error) {
+	lb, err := api.LoadBalancerDetails(ctx, zoneID, lbID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pools []LoadBalancerPool
+	var health []LoadBalancerPoolHealth
+	seen := make(map[string]bool)
+	for _, ref := range loadBalancerPoolReferences(lb) {
+		if seen[ref.PoolID] {
+			continue
+		}
+		seen[ref.PoolID] = true
+
+		pool, err := api.LoadBalancerPoolDetails(ctx, ref.PoolID)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+
+		h, err := api.PoolHealthDetails(ctx, ref.PoolID)
+		if err != nil {
+			return nil, err
+		}
+		health = append(health, h)
+	}
+
+	return NewLoadBalancerSimulator(lb, pools, health), nil
+}
+
+// MarkPoolUnhealthy makes the simulator treat a pool as unhealthy regardless
+// of its health check results.
+func (s *LoadBalancerSimulator) MarkPoolUnhealthy(poolID string) {
+	if s.unhealthyPools == nil {
+		s.unhealthyPools = make(map[string]bool)
+	}
+	s.unhealthyPools[poolID] = true
+}
+
+// MarkOriginUnhealthy makes the simulator treat an origin of a pool as
+// unhealthy regardless of its health check results.
+func (s *LoadBalancerSimulator) MarkOriginUnhealthy(poolID, originName string) {
+	if s.unhealthyOrigins == nil {
+		s.unhealthyOrigins = make(map[string]map[string]bool)
+	}
+	if s.unhealthyOrigins[poolID] == nil {
+		s.unhealthyOrigins[poolID] = make(map[string]bool)
+	}
+	s.unhealthyOrigins[poolID][originName] = true
+}
+
+// Simulate predicts the pool and origin a request lands on.
+func (s *LoadBalancerSimulator) Simulate(req LoadBalancerSimulationRequest) (LoadBalancerSimulationResult, error) {
+	var res LoadBalancerSimulationResult
+	trace := func(format string, args ...interface{}) {
+		res.Trace = append(res.Trace, fmt.Sprintf(format, args...))
+	}
+
+	lb := s.LoadBalancer
+	cfg := LoadBalancerRuleOverrides{
+		SteeringPolicy: lb.SteeringPolicy,
+		FallbackPool:   lb.FallbackPool,
+		DefaultPools:   lb.DefaultPools,
+		RegionPools:    lb.RegionPools,
+		PoPPools:       lb.PopPools,
+		CountryPools:   lb.CountryPools,
+		Persistence:    lb.Persistence,
+	}
+
+	rules := make([]*LoadBalancerRule, 0, len(lb.Rules))
+	for _, r := range lb.Rules {
+		if r != nil && !r.Disabled && contains(req.MatchedRules, r.Name) {
+			rules = append(rules, r)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+
+	for _, r := range rules {
+		res.Rules = append(res.Rules, r.Name)
+		if r.FixedResponse != nil {
+			trace("rule %q responds with fixed response", r.Name)
+			res.FixedResponse = r.FixedResponse
+			return res, nil
+		}
+
+		trace("rule %q applies overrides", r.Name)
+		mergeLoadBalancerRuleOverrides(&cfg, r.Overrides)
+		if r.Terminates {
+			trace("rule %q terminates rule evaluation", r.Name)
+			break
+		}
+	}
+
+	policy := cfg.SteeringPolicy
+	if policy == "" {
+		if len(cfg.RegionPools) > 0 || len(cfg.PoPPools) > 0 || len(cfg.CountryPools) > 0 {
+			policy = "geo"
+		} else {
+			policy = "off"
+		}
+	}
+	res.SteeringPolicy = policy
+
+	switch policy {
+	case "geo":
+		switch {
+		case req.PoP != "" && len(cfg.PoPPools[req.PoP]) > 0:
+			trace("using pools for PoP %s", req.PoP)
+			res.Candidates = cfg.PoPPools[req.PoP]
+		case req.Country != "" && len(cfg.CountryPools[req.Country]) > 0:
+			trace("using pools for country %s", req.Country)
+			res.Candidates = cfg.CountryPools[req.Country]
+		case req.Region != "" && len(cfg.RegionPools[req.Region]) > 0:
+			trace("using pools for region %s", req.Region)
+			res.Candidates = cfg.RegionPools[req.Region]
+		default:
+			trace("no geo pools match, using default pools")
+		}
+
+		// Once every geo pool is unhealthy traffic moves on to the default
+		// pools before reaching the fallback pool.
+		candidates := append([]string{}, res.Candidates...)
+		for _, id := range cfg.DefaultPools {
+			if !contains(candidates, id) {
+				candidates = append(candidates, id)
+			}
+		}
+		res.Candidates = candidates
+	case "random":
+		res.Candidates = append([]string{}, cfg.DefaultPools...)
+		if s.Rand != nil {
+			s.Rand.Shuffle(len(res.Candidates), func(i, j int) {
+				res.Candidates[i], res.Candidates[j] = res.Candidates[j], res.Candidates[i]
+			})
+		}
+		trace("default pools in random order")
+	case "dynamic_latency":
+		res.Candidates = s.poolsByLatency(cfg.DefaultPools, req)
+		trace("default pools ordered by round trip time")
+	case "proximity":
+		if req.Latitude != nil && req.Longitude != nil {
+			res.Candidates = s.poolsByDistance(cfg.DefaultPools, *req.Latitude, *req.Longitude)
+			trace("default pools ordered by distance")
+		} else {
+			res.Candidates = cfg.DefaultPools
+			trace("visitor location unknown, using default pool order")
+		}
+	default:
+		res.Candidates = cfg.DefaultPools
+		trace("using default pools in order")
+	}
+
+	for _, id := range res.Candidates {
+		healthy, reason := s.poolHealthy(id, req)
+		if healthy {
+			res.Pool = id
+			break
+		}
+		trace("skipping pool %s: %s", id, reason)
+		res.Failover = true
+	}
+
+	if res.Pool == "" {
+		if cfg.FallbackPool == "" {
+			return res, errors.New("no healthy pool and no fallback pool")
+		}
+		trace("all candidate pools unhealthy, using fallback pool %s", cfg.FallbackPool)
+		res.Pool = cfg.FallbackPool
+		res.Fallback = true
+	}
+
+	pool, ok := s.Pools[res.Pool]
+	if !ok {
+		return res, errors.Errorf("pool %s is not known to the simulator", res.Pool)
+	}
+
+	res.OriginWeights = s.originWeights(pool, req)
+	if cfg.Persistence != "" && cfg.Persistence != "none" && req.AffinityOrigin != "" {
+		if _, ok := res.OriginWeights[req.AffinityOrigin]; ok {
+			trace("session affinity keeps origin %s", req.AffinityOrigin)
+			res.Origin = req.AffinityOrigin
+			return res, nil
+		}
+		trace("session affinity origin %s is unavailable", req.AffinityOrigin)
+	}
+
+	res.Origin = s.pickOrigin(res.OriginWeights)
+	if res.Origin == "" {
+		trace("pool %s has no healthy origins", res.Pool)
+	}
+
+	return res, nil
+}
+
+// mergeLoadBalancerRuleOverrides applies the non-empty fields of overrides to
+// cfg.
+func mergeLoadBalancerRuleOverrides(cfg *LoadBalancerRuleOverrides, o LoadBalancerRuleOverrides) {
+	if o.SteeringPolicy != "" {
+		cfg.SteeringPolicy = o.SteeringPolicy
+	}
+	if o.FallbackPool != "" {
+		cfg.FallbackPool = o.FallbackPool
+	}
+	if len(o.DefaultPools) > 0 {
+		cfg.DefaultPools = o.DefaultPools
+	}
+	if len(o.RegionPools) > 0 {
+		cfg.RegionPools = o.RegionPools
+	}
+	if len(o.PoPPools) > 0 {
+		cfg.PoPPools = o.PoPPools
+	}
+	if len(o.CountryPools) > 0 {
+		cfg.CountryPools = o.CountryPools
+	}
+	if o.Persistence != "" {
+		cfg.Persistence = o.Persistence
+	}
+}
+
+// popHealth returns the health check results of a pool for the region of a
+// request, or for its PoP, along with the key they were found under.
+func popHealth(health LoadBalancerPoolHealth, req LoadBalancerSimulationRequest) (LoadBalancerPoolPopHealth, string, bool) {
+	for _, key := range []string{req.Region, req.PoP} {
+		if ph, ok := health.PopHealth[key]; ok && key != "" {
+			return ph, key, true
+		}
+	}
+	return LoadBalancerPoolPopHealth{}, "", false
+}
+
+// poolHealthy reports whether a pool can take traffic for a request and why
+// not.
+func (s *LoadBalancerSimulator) poolHealthy(id string, req LoadBalancerSimulationRequest) (bool, string) {
+	pool, ok := s.Pools[id]
+	if !ok {
+		return false, "unknown pool"
+	}
+	if !pool.Enabled {
+		return false, "pool disabled"
+	}
+	if s.unhealthyPools[id] {
+		return false, "marked unhealthy"
+	}
+
+	if health, ok := s.Health[id]; ok && len(health.PopHealth) > 0 {
+		if ph, key, ok := popHealth(health, req); ok {
+			if !ph.Healthy {
+				return false, "unhealthy at " + key
+			}
+		} else {
+			healthy := 0
+			for _, ph := range health.PopHealth {
+				if ph.Healthy {
+					healthy++
+				}
+			}
+			if healthy*2 <= len(health.PopHealth) {
+				return false, "unhealthy in a majority of check regions"
+			}
+		}
+	}
+
+	minimum := pool.MinimumOrigins
+	if minimum < 1 {
+		minimum = 1
+	}
+	if n := len(s.originWeights(pool, req)); n < minimum {
+		return false, fmt.Sprintf("%d healthy origins, %d required", n, minimum)
+	}
+
+	return true, ""
+}
+
+// originHealthy reports whether an origin of a pool can take traffic.
+func (s *LoadBalancerSimulator) originHealthy(pool LoadBalancerPool, origin LoadBalancerOrigin, req LoadBalancerSimulationRequest) bool {
+	if !origin.Enabled || s.unhealthyOrigins[pool.ID][origin.Name] {
+		return false
+	}
+
+	health, ok := s.Health[pool.ID]
+	if !ok {
+		return true
+	}
+
+	var results []bool
+	collect := func(ph LoadBalancerPoolPopHealth) {
+		for _, origins := range ph.Origins {
+			if h, ok := origins[origin.Address]; ok {
+				results = append(results, h.Healthy)
+			}
+		}
+	}
+	if ph, _, ok := popHealth(health, req); ok {
+		collect(ph)
+	} else {
+		for _, ph := range health.PopHealth {
+			collect(ph)
+		}
+	}
+	if len(results) == 0 {
+		return true
+	}
+
+	healthy := 0
+	for _, r := range results {
+		if r {
+			healthy++
+		}
+	}
+	return healthy*2 > len(results)
+}
+
+// originWeights returns the selection probability of every healthy origin of
+// a pool.
+func (s *LoadBalancerSimulator) originWeights(pool LoadBalancerPool, req LoadBalancerSimulationRequest) map[string]float64 {
+	weights := make(map[string]float64)
+	var total float64
+	for _, o := range pool.Origins {
+		if !s.originHealthy(pool, o, req) {
+			continue
+		}
+		weights[o.Name] = o.Weight
+		total += o.Weight
+	}
+
+	for name, w := range weights {
+		if total > 0 {
+			weights[name] = w / total
+		} else {
+			weights[name] = 1 / float64(len(weights))
+		}
+	}
+
+	return weights
+}
+
+// pickOrigin selects an origin according to weights.
+func (s *LoadBalancerSimulator) pickOrigin(weights map[string]float64) string {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if s.Rand != nil {
+		r := s.Rand.Float64()
+		for _, name := range names {
+			r -= weights[name]
+			if r < 0 {
+				return name
+			}
+		}
+	}
+
+	best := ""
+	for _, name := range names {
+		if best == "" || weights[name] > weights[best] {
+			best = name
+		}
+	}
+	return best
+}
+
+// poolsByLatency orders pools by the average round trip time of their
+// healthy origins. Pools without measurements keep their relative order at
+// the end.
+func (s *LoadBalancerSimulator) poolsByLatency(ids []string, req LoadBalancerSimulationRequest) []string {
+	rtt := make(map[string]float64)
+	for _, id := range ids {
+		health, ok := s.Health[id]
+		if !ok {
+			continue
+		}
+
+		pops := health.PopHealth
+		if ph, key, ok := popHealth(health, req); ok {
+			pops = map[string]LoadBalancerPoolPopHealth{key: ph}
+		}
+
+		var sum float64
+		var n int
+		for _, ph := range pops {
+			for _, origins := range ph.Origins {
+				for _, h := range origins {
+					if h.Healthy {
+						sum += float64(h.RTT.Duration)
+						n++
+					}
+				}
+			}
+		}
+		if n > 0 {
+			rtt[id] = sum / float64(n)
+		}
+	}
+
+	sorted := append([]string{}, ids...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, aok := rtt[sorted[i]]
+		b, bok := rtt[sorted[j]]
+		if aok != bok {
+			return aok
+		}
+		return a < b
+	})
+
+	return sorted
+}
+
+// poolsByDistance orders pools by great-circle distance from the visitor.
+// Pools without coordinates keep their relative order at the end.
+func (s *LoadBalancerSimulator) poolsByDistance(ids []string, lat, lon float32) []string {
+	distance := make(map[string]float64)
+	for _, id := range ids {
+		p, ok := s.Pools[id]
+		if ok && p.Latitude != nil && p.Longitude != nil {
+			distance[id] = haversine(float64(lat), float64(lon), float64(*p.Latitude), float64(*p.Longitude))
+		}
+	}
+
+	sorted := append([]string{}, ids...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, aok := distance[sorted[i]]
+		b, bok := distance[sorted[j]]
+		if aok != bok {
+			return aok
+		}
+		return a < b
+	})
+
+	return sorted
+}
+
+// haversine returns the distance in kilometres between two coordinates.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -0,0 +1,355 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLoadBalancerSimulator() *LoadBalancerSimulator {
+	lb := LoadBalancer{
+		ID:           "699d98642c564d2e855e9661899b7252",
+		Name:         "www.example.com",
+		FallbackPool: "fallback",
+		DefaultPools: []string{"us", "eu"},
+		RegionPools:  map[string][]string{"WEU": {"eu", "us"}},
+		PopPools:     map[string][]string{"LAX": {"us"}},
+		CountryPools: map[string][]string{"GB": {"eu"}},
+		Persistence:  "cookie",
+		Rules: []*LoadBalancerRule{
+			{
+				Name:          "maintenance",
+				Priority:      1,
+				FixedResponse: &LoadBalancerFixedResponseData{StatusCode: 503},
+			},
+			{
+				Name:       "api",
+				Priority:   2,
+				Terminates: true,
+				Overrides: LoadBalancerRuleOverrides{
+					SteeringPolicy: "off",
+					DefaultPools:   []string{"eu"},
+				},
+			},
+			{
+				Name:     "disabled",
+				Priority: 0,
+				Disabled: true,
+				Overrides: LoadBalancerRuleOverrides{
+					DefaultPools: []string{"fallback"},
+				},
+			},
+		},
+	}
+
+	pools := []LoadBalancerPool{
+		{
+			ID:      "us",
+			Enabled: true,
+			Origins: []LoadBalancerOrigin{
+				{Name: "us-1", Address: "192.0.2.1", Enabled: true, Weight: 0.75},
+				{Name: "us-2", Address: "192.0.2.2", Enabled: true, Weight: 0.25},
+			},
+		},
+		{
+			ID:      "eu",
+			Enabled: true,
+			Origins: []LoadBalancerOrigin{
+				{Name: "eu-1", Address: "198.51.100.1", Enabled: true, Weight: 1},
+				{Name: "eu-2", Address: "198.51.100.2", Enabled: false, Weight: 1},
+			},
+		},
+		{
+			ID:      "fallback",
+			Enabled: true,
+			Origins: []LoadBalancerOrigin{
+				{Name: "fallback-1", Address: "203.0.113.1", Enabled: true, Weight: 1},
+			},
+		},
+	}
+
+	health := []LoadBalancerPoolHealth{
+		{
+			ID: "us",
+			PopHealth: map[string]LoadBalancerPoolPopHealth{
+				"Amsterdam, NL": {
+					Healthy: true,
+					Origins: []map[string]LoadBalancerOriginHealth{
+						{"192.0.2.1": {Healthy: true, RTT: Duration{80 * time.Millisecond}}},
+						{"192.0.2.2": {Healthy: true, RTT: Duration{90 * time.Millisecond}}},
+					},
+				},
+			},
+		},
+		{
+			ID: "eu",
+			PopHealth: map[string]LoadBalancerPoolPopHealth{
+				"Amsterdam, NL": {
+					Healthy: true,
+					Origins: []map[string]LoadBalancerOriginHealth{
+						{"198.51.100.1": {Healthy: true, RTT: Duration{10 * time.Millisecond}}},
+					},
+				},
+			},
+		},
+	}
+
+	return NewLoadBalancerSimulator(lb, pools, health)
+}
+
+func TestLoadBalancerSimulator_Geo(t *testing.T) {
+	s := newTestLoadBalancerSimulator()
+
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX", Country: "US", Region: "WNAM"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "geo", res.SteeringPolicy)
+		assert.Equal(t, []string{"us", "eu"}, res.Candidates)
+		assert.Equal(t, "us", res.Pool)
+		assert.Equal(t, "us-1", res.Origin)
+		assert.Equal(t, map[string]float64{"us-1": 0.75, "us-2": 0.25}, res.OriginWeights)
+		assert.False(t, res.Failover)
+	}
+
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "LHR", Country: "GB", Region: "WEU"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"eu", "us"}, res.Candidates)
+		assert.Equal(t, "eu", res.Pool)
+		assert.Equal(t, "eu-1", res.Origin)
+	}
+
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "CDG", Country: "FR", Region: "WEU"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "eu", res.Pool)
+	}
+
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "NRT", Country: "JP", Region: "NEAS"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"us", "eu"}, res.Candidates)
+		assert.Equal(t, "us", res.Pool)
+	}
+}
+
+func TestLoadBalancerSimulator_Failover(t *testing.T) {
+	s := newTestLoadBalancerSimulator()
+	s.MarkOriginUnhealthy("us", "us-1")
+	s.MarkOriginUnhealthy("us", "us-2")
+
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX", Country: "US"})
+	if assert.NoError(t, err) {
+		assert.True(t, res.Failover)
+		assert.False(t, res.Fallback)
+		assert.Equal(t, "eu", res.Pool)
+		assert.Contains(t, res.Trace, "skipping pool us: 0 healthy origins, 1 required")
+	}
+
+	s.MarkPoolUnhealthy("eu")
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX", Country: "US"})
+	if assert.NoError(t, err) {
+		assert.True(t, res.Fallback)
+		assert.Equal(t, "fallback", res.Pool)
+		assert.Equal(t, "fallback-1", res.Origin)
+	}
+}
+
+func TestLoadBalancerSimulator_HealthChecks(t *testing.T) {
+	s := newTestLoadBalancerSimulator()
+	s.Health["us"] = LoadBalancerPoolHealth{
+		ID: "us",
+		PopHealth: map[string]LoadBalancerPoolPopHealth{
+			"Amsterdam, NL": {Healthy: false},
+			"Singapore, SG": {Healthy: true},
+		},
+	}
+
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "eu", res.Pool)
+		assert.Contains(t, res.Trace, "skipping pool us: unhealthy in a majority of check regions")
+	}
+
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "Singapore, SG"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us", res.Pool)
+	}
+}
+
+func TestLoadBalancerSimulator_Rules(t *testing.T) {
+	s := newTestLoadBalancerSimulator()
+
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX", MatchedRules: []string{"maintenance", "api"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"maintenance"}, res.Rules)
+		assert.Equal(t, 503, res.FixedResponse.StatusCode)
+		assert.Empty(t, res.Pool)
+	}
+
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX", MatchedRules: []string{"api", "disabled"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"api"}, res.Rules)
+		assert.Equal(t, "off", res.SteeringPolicy)
+		assert.Equal(t, []string{"eu"}, res.Candidates)
+		assert.Equal(t, "eu", res.Pool)
+	}
+}
+
+func TestLoadBalancerSimulator_SessionAffinity(t *testing.T) {
+	s := newTestLoadBalancerSimulator()
+
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX", AffinityOrigin: "us-2"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us-2", res.Origin)
+	}
+
+	s.MarkOriginUnhealthy("us", "us-2")
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX", AffinityOrigin: "us-2"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us-1", res.Origin)
+	}
+}
+
+func TestLoadBalancerSimulator_SteeringPolicies(t *testing.T) {
+	s := newTestLoadBalancerSimulator()
+
+	s.LoadBalancer.SteeringPolicy = "dynamic_latency"
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"eu", "us"}, res.Candidates)
+	}
+
+	s.LoadBalancer.SteeringPolicy = "proximity"
+	s.Pools["us"] = withPoolLocation(s.Pools["us"], 37.77, -122.42)
+	s.Pools["eu"] = withPoolLocation(s.Pools["eu"], 51.51, -0.13)
+	res, err = s.Simulate(LoadBalancerSimulationRequest{Latitude: Float32Ptr(48.86), Longitude: Float32Ptr(2.35)})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"eu", "us"}, res.Candidates)
+	}
+
+	s.LoadBalancer.SteeringPolicy = "random"
+	s.Rand = rand.New(rand.NewSource(1))
+	res, err = s.Simulate(LoadBalancerSimulationRequest{})
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []string{"eu", "us"}, res.Candidates)
+	}
+}
+
+func TestLoadBalancerSimulator_NoFallback(t *testing.T) {
+	s := NewLoadBalancerSimulator(LoadBalancer{DefaultPools: []string{"missing"}}, nil, nil)
+	_, err := s.Simulate(LoadBalancerSimulationRequest{})
+	assert.Error(t, err)
+}
+
+func TestLoadBalancerSimulatorFromAPI(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/zones/"+testZoneID+"/load_balancers/699d98642c564d2e855e9661899b7252", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+            "success": true,
+            "errors": [],
+            "messages": [],
+            "result": {
+              "id": "699d98642c564d2e855e9661899b7252",
+              "fallback_pool": "17b5962d775c646f3f9725cbc7a53df4",
+              "default_pools": ["17b5962d775c646f3f9725cbc7a53df4"]
+            }
+        }`)
+	})
+	mux.HandleFunc("/user/load_balancers/pools/17b5962d775c646f3f9725cbc7a53df4", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+            "success": true,
+            "errors": [],
+            "messages": [],
+            "result": {
+              "id": "17b5962d775c646f3f9725cbc7a53df4",
+              "enabled": true,
+              "origins": [{"name": "app-server-1", "address": "192.0.2.1", "enabled": true, "weight": 1}]
+            }
+        }`)
+	})
+	mux.HandleFunc("/user/load_balancers/pools/17b5962d775c646f3f9725cbc7a53df4/health", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+            "success": true,
+            "errors": [],
+            "messages": [],
+            "result": {
+              "pool_id": "17b5962d775c646f3f9725cbc7a53df4",
+              "pop_health": {
+                "Amsterdam, NL": {
+                  "healthy": true,
+                  "origins": [{"192.0.2.1": {"healthy": true, "rtt": "12.1ms"}}]
+                }
+              }
+            }
+        }`)
+	})
+
+	s, err := client.LoadBalancerSimulator(context.Background(), testZoneID, "699d98642c564d2e855e9661899b7252")
+	if assert.NoError(t, err) {
+		res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "AMS"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "17b5962d775c646f3f9725cbc7a53df4", res.Pool)
+			assert.Equal(t, "app-server-1", res.Origin)
+		}
+	}
+}
+
+func withPoolLocation(p LoadBalancerPool, lat, lon float32) LoadBalancerPool {
+	p.Latitude = &lat
+	p.Longitude = &lon
+	return p
+}
+
+func TestLoadBalancerSimulator_Literal(t *testing.T) {
+	s := &LoadBalancerSimulator{
+		LoadBalancer: LoadBalancer{DefaultPools: []string{"us", "eu"}, FallbackPool: "eu"},
+		Pools: map[string]LoadBalancerPool{
+			"us": {ID: "us", Enabled: true, Origins: []LoadBalancerOrigin{{Name: "us-1", Address: "192.0.2.1", Enabled: true, Weight: 1}}},
+			"eu": {ID: "eu", Enabled: true, Origins: []LoadBalancerOrigin{
+				{Name: "eu-1", Address: "198.51.100.1", Enabled: true, Weight: 1},
+				{Name: "eu-2", Address: "198.51.100.2", Enabled: true, Weight: 1},
+			}},
+		},
+	}
+	s.MarkPoolUnhealthy("us")
+	s.MarkOriginUnhealthy("eu", "eu-2")
+
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "LAX"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "eu", res.Pool)
+		assert.Equal(t, "eu-1", res.Origin)
+	}
+}
+
+func TestLoadBalancerSimulator_RegionHealth(t *testing.T) {
+	s := newTestLoadBalancerSimulator()
+	s.Health["us"] = LoadBalancerPoolHealth{
+		ID: "us",
+		PopHealth: map[string]LoadBalancerPoolPopHealth{
+			"WNAM": {Healthy: false},
+			"ENAM": {Healthy: true},
+			"WEU":  {Healthy: true},
+		},
+	}
+
+	res, err := s.Simulate(LoadBalancerSimulationRequest{PoP: "SJC", Region: "WNAM"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "eu", res.Pool)
+		assert.Contains(t, res.Trace, "skipping pool us: unhealthy at WNAM")
+	}
+
+	res, err = s.Simulate(LoadBalancerSimulationRequest{PoP: "EWR", Region: "ENAM"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us", res.Pool)
+	}
+}
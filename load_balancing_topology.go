@@ -0,0 +1,429 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// LoadBalancerRegionCodes are the region codes accepted as keys of
+// RegionPools.
+var LoadBalancerRegionCodes = []string{
+	"WNAM", "ENAM", "WEU", "EEU", "NSAM", "SSAM", "OC", "ME", "NAF", "SAF", "SAS", "SEAS", "NEAS",
+}
+
+// LoadBalancerCheckRegionCodes are the region codes accepted in the
+// CheckRegions of a pool.
+var LoadBalancerCheckRegionCodes = []string{
+	"WNAM", "ENAM", "WEU", "EEU", "NSAM", "SSAM", "OC", "ME", "NAF", "SAF", "IN", "SEAS", "NEAS", "ALL_REGIONS",
+}
+
+// LoadBalancerSteeringPolicies are the accepted values of a load balancer's
+// SteeringPolicy.
+var LoadBalancerSteeringPolicies = []string{
+	"", "off", "geo", "dynamic_latency", "random", "proximity",
+}
+
+var (
+	loadBalancerPopCodeRegexp     = regexp.MustCompile(`^[A-Z]{3}$`)
+	loadBalancerCountryCodeRegexp = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// LoadBalancerTopologyObjectKind identifies the kind of object a topology
+// issue or graph node refers to.
+type LoadBalancerTopologyObjectKind string
+
+// Kinds of objects in a load balancer topology.
+const (
+	LoadBalancerTopologyLoadBalancer LoadBalancerTopologyObjectKind = "load_balancer"
+	LoadBalancerTopologyPool         LoadBalancerTopologyObjectKind = "pool"
+	LoadBalancerTopologyMonitor      LoadBalancerTopologyObjectKind = "monitor"
+)
+
+// LoadBalancerTopologySeverity is how serious a topology issue is. Errors are
+// rejected by the API, warnings are accepted but likely unintended.
+type LoadBalancerTopologySeverity string
+
+// Severities of topology issues.
+const (
+	LoadBalancerTopologyError   LoadBalancerTopologySeverity = "error"
+	LoadBalancerTopologyWarning LoadBalancerTopologySeverity = "warning"
+)
+
+// LoadBalancerTopology is a local model of the load balancers, pools and
+// monitors of an account.
+type LoadBalancerTopology struct {
+	LoadBalancers []LoadBalancer        `json:"load_balancers"`
+	Pools         []LoadBalancerPool    `json:"pools"`
+	Monitors      []LoadBalancerMonitor `json:"monitors"`
+}
+
+// LoadBalancerTopologyIssue describes a problem found while validating a
+// load balancer topology.
+type LoadBalancerTopologyIssue struct {
+	Severity LoadBalancerTopologySeverity   `json:"severity"`
+	Kind     LoadBalancerTopologyObjectKind `json:"kind"`
+	ID       string                         `json:"id"`
+	Message  string                         `json:"message"`
+}
+
+func (i LoadBalancerTopologyIssue) String() string {
+	return fmt.Sprintf("%s: %s %s: %s", i.Severity, i.Kind, i.ID, i.Message)
+}
+
+// LoadBalancerTopologyGraph is the topology rendered as nodes and edges.
+type LoadBalancerTopologyGraph struct {
+	Nodes []LoadBalancerTopologyNode `json:"nodes"`
+	Edges []LoadBalancerTopologyEdge `json:"edges"`
+}
+
+// LoadBalancerTopologyNode is a load balancer, pool or monitor. Nodes for
+// dangling references have an empty Name.
+type LoadBalancerTopologyNode struct {
+	ID   string                         `json:"id"`
+	Kind LoadBalancerTopologyObjectKind `json:"kind"`
+	Name string                         `json:"name"`
+}
+
+// LoadBalancerTopologyEdge is a reference from one node to another. Label
+// describes where the reference comes from, e.g. "default", "fallback",
+// "region:WNAM" or "monitor".
+type LoadBalancerTopologyEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label"`
+}
+
+// loadBalancerPoolReference is a pool referenced from a load balancer.
+type loadBalancerPoolReference struct {
+	PoolID string
+	Label  string
+}
+
+// LoadBalancerTopology loads all pools and monitors of the account along with
+// the load balancers of the given zones.
+func (api *API) LoadBalancerTopology(ctx context.Context, zoneIDs ...string) (LoadBalancerTopology, error) {
+	pools, err := api.ListLoadBalancerPools(ctx)
+	if err != nil {
+		return LoadBalancerTopology{}, err
+	}
+
+	monitors, err := api.ListLoadBalancerMonitors(ctx)
+	if err != nil {
+		return LoadBalancerTopology{}, err
+	}
+
+	var lbs []LoadBalancer
+	for _, zoneID := range zoneIDs {
+		zoneLBs, err := api.ListLoadBalancers(ctx, zoneID)
+		if err != nil {
+			return LoadBalancerTopology{}, err
+		}
+		lbs = append(lbs, zoneLBs...)
+	}
+
+	return LoadBalancerTopology{LoadBalancers: lbs, Pools: pools, Monitors: monitors}, nil
+}
+
+// Pool returns the pool with the given ID.
+func (t LoadBalancerTopology) Pool(id string) (LoadBalancerPool, bool) {
+	for _, p := range t.Pools {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return LoadBalancerPool{}, false
+}
+
+// Monitor returns the monitor with the given ID.
+func (t LoadBalancerTopology) Monitor(id string) (LoadBalancerMonitor, bool) {
+	for _, m := range t.Monitors {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return LoadBalancerMonitor{}, false
+}
+
+// Validate checks references between load balancers, pools and monitors,
+// region, PoP and country codes and origin weights. Pools and monitors that
+// are not referenced are reported as warnings.
+func (t LoadBalancerTopology) Validate() []LoadBalancerTopologyIssue {
+	var issues []LoadBalancerTopologyIssue
+
+	usedPools := make(map[string]bool)
+	for _, lb := range t.LoadBalancers {
+		issue := func(severity LoadBalancerTopologySeverity, format string, args ...interface{}) {
+			issues = append(issues, LoadBalancerTopologyIssue{
+				Severity: severity,
+				Kind:     LoadBalancerTopologyLoadBalancer,
+				ID:       lb.ID,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		if lb.FallbackPool == "" {
+			issue(LoadBalancerTopologyError, "fallback pool is not set")
+		}
+		if len(lb.DefaultPools) == 0 {
+			issue(LoadBalancerTopologyError, "no default pools")
+		}
+		if !contains(LoadBalancerSteeringPolicies, lb.SteeringPolicy) {
+			issue(LoadBalancerTopologyError, "unknown steering policy %q", lb.SteeringPolicy)
+		}
+
+		for _, ref := range loadBalancerPoolReferences(lb) {
+			usedPools[ref.PoolID] = true
+			if _, ok := t.Pool(ref.PoolID); !ok {
+				issue(LoadBalancerTopologyError, "%s references unknown pool %s", ref.Label, ref.PoolID)
+			}
+		}
+
+		for _, msg := range validateLoadBalancerPoolMaps(lb.RegionPools, lb.PopPools, lb.CountryPools) {
+			issue(LoadBalancerTopologyError, "%s", msg)
+		}
+
+		priorities := make(map[int]string)
+		for _, rule := range lb.Rules {
+			if rule == nil {
+				continue
+			}
+			if other, ok := priorities[rule.Priority]; ok {
+				issue(LoadBalancerTopologyWarning, "rule %q has the same priority as rule %q", rule.Name, other)
+			}
+			priorities[rule.Priority] = rule.Name
+
+			if !contains(LoadBalancerSteeringPolicies, rule.Overrides.SteeringPolicy) {
+				issue(LoadBalancerTopologyError, "rule %q: unknown steering policy %q", rule.Name, rule.Overrides.SteeringPolicy)
+			}
+			for _, msg := range validateLoadBalancerPoolMaps(rule.Overrides.RegionPools, rule.Overrides.PoPPools, rule.Overrides.CountryPools) {
+				issue(LoadBalancerTopologyError, "rule %q: %s", rule.Name, msg)
+			}
+		}
+	}
+
+	usedMonitors := make(map[string]bool)
+	for _, pool := range t.Pools {
+		issue := func(severity LoadBalancerTopologySeverity, format string, args ...interface{}) {
+			issues = append(issues, LoadBalancerTopologyIssue{
+				Severity: severity,
+				Kind:     LoadBalancerTopologyPool,
+				ID:       pool.ID,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		if pool.Monitor != "" {
+			usedMonitors[pool.Monitor] = true
+			if _, ok := t.Monitor(pool.Monitor); !ok {
+				issue(LoadBalancerTopologyError, "references unknown monitor %s", pool.Monitor)
+			}
+		}
+
+		if len(pool.Origins) == 0 {
+			issue(LoadBalancerTopologyError, "no origins")
+		}
+
+		names := make(map[string]bool)
+		enabled := 0
+		var weights float64
+		for _, origin := range pool.Origins {
+			if names[origin.Name] {
+				issue(LoadBalancerTopologyError, "duplicate origin name %q", origin.Name)
+			}
+			names[origin.Name] = true
+
+			if origin.Weight < 0 || origin.Weight > 1 {
+				issue(LoadBalancerTopologyError, "origin %q has weight %g, expected a value between 0 and 1", origin.Name, origin.Weight)
+			}
+			if origin.Enabled {
+				enabled++
+				weights += origin.Weight
+			}
+		}
+
+		if len(pool.Origins) > 0 && enabled > 0 && weights == 0 {
+			issue(LoadBalancerTopologyWarning, "all enabled origins have a weight of 0")
+		}
+		if pool.MinimumOrigins > enabled {
+			issue(LoadBalancerTopologyWarning, "minimum origins is %d but only %d origins are enabled", pool.MinimumOrigins, enabled)
+		}
+
+		for _, region := range pool.CheckRegions {
+			if !contains(LoadBalancerCheckRegionCodes, region) {
+				issue(LoadBalancerTopologyError, "unknown check region %q", region)
+			}
+		}
+
+		if !usedPools[pool.ID] {
+			issue(LoadBalancerTopologyWarning, "not used by any load balancer")
+		}
+	}
+
+	for _, monitor := range t.Monitors {
+		if !usedMonitors[monitor.ID] {
+			issues = append(issues, LoadBalancerTopologyIssue{
+				Severity: LoadBalancerTopologyWarning,
+				Kind:     LoadBalancerTopologyMonitor,
+				ID:       monitor.ID,
+				Message:  "not used by any pool",
+			})
+		}
+	}
+
+	return issues
+}
+
+// Graph returns the topology as nodes and edges, sorted for stable output.
+func (t LoadBalancerTopology) Graph() LoadBalancerTopologyGraph {
+	var g LoadBalancerTopologyGraph
+	nodes := make(map[string]bool)
+	addNode := func(id string, kind LoadBalancerTopologyObjectKind, name string) {
+		if nodes[id] {
+			return
+		}
+		nodes[id] = true
+		g.Nodes = append(g.Nodes, LoadBalancerTopologyNode{ID: id, Kind: kind, Name: name})
+	}
+
+	for _, lb := range t.LoadBalancers {
+		addNode(lb.ID, LoadBalancerTopologyLoadBalancer, lb.Name)
+	}
+	for _, pool := range t.Pools {
+		addNode(pool.ID, LoadBalancerTopologyPool, pool.Name)
+	}
+	for _, monitor := range t.Monitors {
+		addNode(monitor.ID, LoadBalancerTopologyMonitor, monitor.Description)
+	}
+
+	edges := make(map[LoadBalancerTopologyEdge]bool)
+	for _, lb := range t.LoadBalancers {
+		for _, ref := range loadBalancerPoolReferences(lb) {
+			addNode(ref.PoolID, LoadBalancerTopologyPool, "")
+			edges[LoadBalancerTopologyEdge{From: lb.ID, To: ref.PoolID, Label: ref.Label}] = true
+		}
+	}
+	for _, pool := range t.Pools {
+		if pool.Monitor != "" {
+			addNode(pool.Monitor, LoadBalancerTopologyMonitor, "")
+			edges[LoadBalancerTopologyEdge{From: pool.ID, To: pool.Monitor, Label: "monitor"}] = true
+		}
+	}
+
+	for e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		if g.Nodes[i].Kind != g.Nodes[j].Kind {
+			return g.Nodes[i].Kind < g.Nodes[j].Kind
+		}
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Label < b.Label
+	})
+
+	return g
+}
+
+// DOT renders the topology in the Graphviz DOT language.
+func (t LoadBalancerTopology) DOT() string {
+	shapes := map[LoadBalancerTopologyObjectKind]string{
+		LoadBalancerTopologyLoadBalancer: "box",
+		LoadBalancerTopologyPool:         "ellipse",
+		LoadBalancerTopologyMonitor:      "diamond",
+	}
+
+	g := t.Graph()
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph load_balancers {\n")
+	for _, n := range g.Nodes {
+		label := n.Name
+		if label == "" {
+			label = n.ID + " (missing)"
+		}
+		fmt.Fprintf(&buf, "  %q [label=%q, shape=%s];\n", n.ID, fmt.Sprintf("%s\n%s", n.Kind, label), shapes[n.Kind])
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "  %q -> %q [label=%q];\n", e.From, e.To, e.Label)
+	}
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// loadBalancerPoolReferences returns every pool a load balancer references,
+// including those in rule overrides.
+func loadBalancerPoolReferences(lb LoadBalancer) []loadBalancerPoolReference {
+	var refs []loadBalancerPoolReference
+	add := func(prefix string, fallback string, defaults []string, region, pop, country map[string][]string) {
+		if fallback != "" {
+			refs = append(refs, loadBalancerPoolReference{PoolID: fallback, Label: prefix + "fallback"})
+		}
+		for _, id := range defaults {
+			refs = append(refs, loadBalancerPoolReference{PoolID: id, Label: prefix + "default"})
+		}
+		for label, m := range map[string]map[string][]string{"region": region, "pop": pop, "country": country} {
+			for _, key := range sortedKeys(m) {
+				for _, id := range m[key] {
+					refs = append(refs, loadBalancerPoolReference{PoolID: id, Label: prefix + label + ":" + key})
+				}
+			}
+		}
+	}
+
+	add("", lb.FallbackPool, lb.DefaultPools, lb.RegionPools, lb.PopPools, lb.CountryPools)
+	for _, rule := range lb.Rules {
+		if rule == nil {
+			continue
+		}
+		o := rule.Overrides
+		add(fmt.Sprintf("rule %q ", rule.Name), o.FallbackPool, o.DefaultPools, o.RegionPools, o.PoPPools, o.CountryPools)
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Label < refs[j].Label })
+
+	return refs
+}
+
+// validateLoadBalancerPoolMaps checks the keys of region, PoP and country
+// pool maps.
+func validateLoadBalancerPoolMaps(region, pop, country map[string][]string) []string {
+	var msgs []string
+	for _, key := range sortedKeys(region) {
+		if !contains(LoadBalancerRegionCodes, key) {
+			msgs = append(msgs, fmt.Sprintf("unknown region code %q", key))
+		}
+	}
+	for _, key := range sortedKeys(pop) {
+		if !loadBalancerPopCodeRegexp.MatchString(key) {
+			msgs = append(msgs, fmt.Sprintf("invalid PoP code %q", key))
+		}
+	}
+	for _, key := range sortedKeys(country) {
+		if !loadBalancerCountryCodeRegexp.MatchString(key) {
+			msgs = append(msgs, fmt.Sprintf("invalid country code %q", key))
+		}
+	}
+	return msgs
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
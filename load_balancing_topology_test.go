@@ -0,0 +1,206 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testLoadBalancerTopology = LoadBalancerTopology{
+	LoadBalancers: []LoadBalancer{
+		{
+			ID:           "699d98642c564d2e855e9661899b7252",
+			Name:         "www.example.com",
+			FallbackPool: "17b5962d775c646f3f9725cbc7a53df4",
+			DefaultPools: []string{"de90f38ced07c2e2f4df50b1f61d4194", "9290f38c5d07c2e2f4df57b1f61d4196"},
+			RegionPools: map[string][]string{
+				"WNAM": {"de90f38ced07c2e2f4df50b1f61d4194"},
+				"MARS": {"de90f38ced07c2e2f4df50b1f61d4194"},
+			},
+			PopPools: map[string][]string{
+				"LAX": {"00920f38ce07c2e2f4df50b1f61d4194"},
+			},
+			CountryPools: map[string][]string{
+				"usa": {"de90f38ced07c2e2f4df50b1f61d4194"},
+			},
+			Rules: []*LoadBalancerRule{
+				{
+					Name:     "api",
+					Priority: 1,
+					Overrides: LoadBalancerRuleOverrides{
+						DefaultPools: []string{"17b5962d775c646f3f9725cbc7a53df4"},
+					},
+				},
+			},
+		},
+	},
+	Pools: []LoadBalancerPool{
+		{
+			ID:      "17b5962d775c646f3f9725cbc7a53df4",
+			Name:    "fallback",
+			Monitor: "f1aba936b94213e5b8dca0c0dbf1f9cc",
+			Origins: []LoadBalancerOrigin{
+				{Name: "app-server-1", Address: "192.0.2.1", Enabled: true, Weight: 1},
+			},
+		},
+		{
+			ID:             "de90f38ced07c2e2f4df50b1f61d4194",
+			Name:           "primary",
+			Monitor:        "a5a2f23e62ac4bb8ab1eae40ec0d3e70",
+			MinimumOrigins: 2,
+			CheckRegions:   []string{"WEU", "MOON"},
+			Origins: []LoadBalancerOrigin{
+				{Name: "app-server-2", Address: "192.0.2.2", Enabled: true, Weight: 1.5},
+				{Name: "app-server-2", Address: "192.0.2.3", Enabled: false, Weight: 1},
+			},
+		},
+		{
+			ID:   "9290f38c5d07c2e2f4df57b1f61d4196",
+			Name: "secondary",
+			Origins: []LoadBalancerOrigin{
+				{Name: "app-server-4", Address: "192.0.2.4", Enabled: true, Weight: 0},
+			},
+		},
+		{
+			ID:   "3c8b7ba1e2b4a6f0e9e6d2f2d7bd8c23",
+			Name: "unused",
+			Origins: []LoadBalancerOrigin{
+				{Name: "app-server-5", Address: "192.0.2.5", Enabled: true, Weight: 1},
+			},
+		},
+	},
+	Monitors: []LoadBalancerMonitor{
+		{ID: "f1aba936b94213e5b8dca0c0dbf1f9cc", Type: "https", Description: "Login page monitor"},
+		{ID: "0bd4d3a6b3d84a7e8c6aa4b8b4f1b9e0", Type: "tcp", Description: "Unused monitor"},
+	},
+}
+
+func TestLoadBalancerTopology(t *testing.T) {
+	setup(UsingAccount(testAccountID))
+	defer teardown()
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/load_balancers/pools", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+            "success": true,
+            "errors": [],
+            "messages": [],
+            "result": [
+              {
+                "id": "17b5962d775c646f3f9725cbc7a53df4",
+                "name": "primary-dc-1",
+                "monitor": "f1aba936b94213e5b8dca0c0dbf1f9cc",
+                "origins": [{"name": "app-server-1", "address": "192.0.2.1", "enabled": true, "weight": 1}]
+              }
+            ]
+        }`)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/load_balancers/monitors", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+            "success": true,
+            "errors": [],
+            "messages": [],
+            "result": [{"id": "f1aba936b94213e5b8dca0c0dbf1f9cc", "type": "https"}]
+        }`)
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/load_balancers", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+            "success": true,
+            "errors": [],
+            "messages": [],
+            "result": [
+              {
+                "id": "699d98642c564d2e855e9661899b7252",
+                "name": "www.example.com",
+                "fallback_pool": "17b5962d775c646f3f9725cbc7a53df4",
+                "default_pools": ["17b5962d775c646f3f9725cbc7a53df4"]
+              }
+            ]
+        }`)
+	})
+
+	topology, err := client.LoadBalancerTopology(context.Background(), testZoneID)
+	if assert.NoError(t, err) {
+		assert.Len(t, topology.LoadBalancers, 1)
+		assert.Len(t, topology.Pools, 1)
+		assert.Len(t, topology.Monitors, 1)
+		assert.Empty(t, topology.Validate())
+	}
+}
+
+func TestLoadBalancerTopology_Validate(t *testing.T) {
+	lbID := "699d98642c564d2e855e9661899b7252"
+	want := []LoadBalancerTopologyIssue{
+		{LoadBalancerTopologyError, LoadBalancerTopologyLoadBalancer, lbID, "pop:LAX references unknown pool 00920f38ce07c2e2f4df50b1f61d4194"},
+		{LoadBalancerTopologyError, LoadBalancerTopologyLoadBalancer, lbID, `unknown region code "MARS"`},
+		{LoadBalancerTopologyError, LoadBalancerTopologyLoadBalancer, lbID, `invalid country code "usa"`},
+		{LoadBalancerTopologyError, LoadBalancerTopologyPool, "de90f38ced07c2e2f4df50b1f61d4194", "references unknown monitor a5a2f23e62ac4bb8ab1eae40ec0d3e70"},
+		{LoadBalancerTopologyError, LoadBalancerTopologyPool, "de90f38ced07c2e2f4df50b1f61d4194", `origin "app-server-2" has weight 1.5, expected a value between 0 and 1`},
+		{LoadBalancerTopologyError, LoadBalancerTopologyPool, "de90f38ced07c2e2f4df50b1f61d4194", `duplicate origin name "app-server-2"`},
+		{LoadBalancerTopologyWarning, LoadBalancerTopologyPool, "de90f38ced07c2e2f4df50b1f61d4194", "minimum origins is 2 but only 1 origins are enabled"},
+		{LoadBalancerTopologyError, LoadBalancerTopologyPool, "de90f38ced07c2e2f4df50b1f61d4194", `unknown check region "MOON"`},
+		{LoadBalancerTopologyWarning, LoadBalancerTopologyPool, "9290f38c5d07c2e2f4df57b1f61d4196", "all enabled origins have a weight of 0"},
+		{LoadBalancerTopologyWarning, LoadBalancerTopologyPool, "3c8b7ba1e2b4a6f0e9e6d2f2d7bd8c23", "not used by any load balancer"},
+		{LoadBalancerTopologyWarning, LoadBalancerTopologyMonitor, "0bd4d3a6b3d84a7e8c6aa4b8b4f1b9e0", "not used by any pool"},
+	}
+
+	assert.Equal(t, want, testLoadBalancerTopology.Validate())
+}
+
+func TestLoadBalancerTopology_Graph(t *testing.T) {
+	g := LoadBalancerTopology{
+		LoadBalancers: []LoadBalancer{{
+			ID:           "lb",
+			Name:         "www.example.com",
+			FallbackPool: "pool-a",
+			DefaultPools: []string{"pool-a", "pool-b"},
+		}},
+		Pools: []LoadBalancerPool{
+			{ID: "pool-a", Name: "primary", Monitor: "monitor"},
+		},
+		Monitors: []LoadBalancerMonitor{
+			{ID: "monitor", Description: "Login page monitor"},
+		},
+	}
+
+	want := LoadBalancerTopologyGraph{
+		Nodes: []LoadBalancerTopologyNode{
+			{ID: "lb", Kind: LoadBalancerTopologyLoadBalancer, Name: "www.example.com"},
+			{ID: "monitor", Kind: LoadBalancerTopologyMonitor, Name: "Login page monitor"},
+			{ID: "pool-a", Kind: LoadBalancerTopologyPool, Name: "primary"},
+			{ID: "pool-b", Kind: LoadBalancerTopologyPool, Name: ""},
+		},
+		Edges: []LoadBalancerTopologyEdge{
+			{From: "lb", To: "pool-a", Label: "default"},
+			{From: "lb", To: "pool-a", Label: "fallback"},
+			{From: "lb", To: "pool-b", Label: "default"},
+			{From: "pool-a", To: "monitor", Label: "monitor"},
+		},
+	}
+	assert.Equal(t, want, g.Graph())
+
+	_, err := json.Marshal(g.Graph())
+	assert.NoError(t, err)
+
+	wantDOT := `digraph load_balancers {
+  "lb" [label="load_balancer\nwww.example.com", shape=box];
+  "monitor" [label="monitor\nLogin page monitor", shape=diamond];
+  "pool-a" [label="pool\nprimary", shape=ellipse];
+  "pool-b" [label="pool\npool-b (missing)", shape=ellipse];
+  "lb" -> "pool-a" [label="default"];
+  "lb" -> "pool-a" [label="fallback"];
+  "lb" -> "pool-b" [label="default"];
+  "pool-a" -> "monitor" [label="monitor"];
+}
+`
+	assert.Equal(t, wantDOT, g.DOT())
+}
@@ -0,0 +1,332 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Origin CA request types.
+const (
+	OriginCARequestTypeRSA = "origin-rsa"
+	OriginCARequestTypeECC = "origin-ecc"
+)
+
+// Origin CA certificate validities, in days.
+const (
+	OriginCAValidity7Days   = 7
+	OriginCAValidity30Days  = 30
+	OriginCAValidity90Days  = 90
+	OriginCAValidity1Year   = 365
+	OriginCAValidity2Years  = 730
+	OriginCAValidity3Years  = 1095
+	OriginCAValidity15Years = 5475
+)
+
+// OriginCAIssueOptions configures IssueOriginCertificate.
+type OriginCAIssueOptions struct {
+	Hostnames []string
+	// RequestType is OriginCARequestTypeRSA (the default) or
+	// OriginCARequestTypeECC and selects the kind of key generated.
+	RequestType string
+	// RequestValidity is the validity in days. Defaults to 15 years.
+	RequestValidity int
+	// RootCertificate is the PEM encoded Origin CA root used to verify the
+	// issued certificate. When empty it is fetched with
+	// OriginCARootCertificate.
+	RootCertificate []byte
+}
+
+// OriginCACertificateBundle is an issued certificate with its private key.
+type OriginCACertificateBundle struct {
+	Certificate    OriginCACertificate
+	PrivateKey     crypto.Signer
+	PrivateKeyPEM  []byte
+	CertificatePEM []byte
+}
+
+// WriteFiles writes the certificate and private key in PEM format. The key
+// file is only readable by its owner.
+func (b *OriginCACertificateBundle) WriteFiles(certFile, keyFile string) error {
+	if err := ioutil.WriteFile(keyFile, b.PrivateKeyPEM, 0600); err != nil {
+		return errors.Wrap(err, "failed to write private key")
+	}
+	if err := ioutil.WriteFile(certFile, b.CertificatePEM, 0644); err != nil { //nolint:gosec
+		return errors.Wrap(err, "failed to write certificate")
+	}
+	return nil
+}
+
+// GenerateOriginCACSR generates a private key of the kind matching the
+// request type and a certificate signing request for the hostnames. Both
+// are returned PEM encoded along with the key.
+func GenerateOriginCACSR(requestType string, hostnames []string) (crypto.Signer, []byte, []byte, error) {
+	if len(hostnames) == 0 {
+		return nil, nil, nil, errors.New("at least one hostname is required")
+	}
+
+	var key crypto.Signer
+	var err error
+	switch requestType {
+	case OriginCARequestTypeRSA, "":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case OriginCARequestTypeECC:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, nil, nil, errors.Errorf("unsupported request type %q", requestType)
+	}
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to generate private key")
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to encode private key")
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: hostnames[0]},
+		DNSNames: hostnames,
+	}, key)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to create certificate signing request")
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	return key, keyPEM, csrPEM, nil
+}
+
+// VerifyOriginCACertificate checks that a PEM encoded certificate chains to
+// the given Origin CA root, covers the hostnames and, when key is not nil,
+// matches the private key.
+func VerifyOriginCACertificate(certPEM, rootPEM []byte, hostnames []string, key crypto.Signer) error {
+	var chain []*x509.Certificate
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse certificate")
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return errors.New("no certificate found")
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(rootPEM) {
+		return errors.New("invalid Origin CA root certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := chain[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "certificate does not chain to the Origin CA root")
+	}
+
+	names := make(map[string]bool, len(leaf.DNSNames))
+	for _, name := range leaf.DNSNames {
+		names[strings.ToLower(name)] = true
+	}
+	var missing []string
+	for _, hostname := range hostnames {
+		if !names[strings.ToLower(hostname)] {
+			missing = append(missing, hostname)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("certificate does not cover %s", strings.Join(missing, ", "))
+	}
+
+	if key != nil {
+		pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(leaf.PublicKey) {
+			return errors.New("certificate does not match the private key")
+		}
+	}
+
+	return nil
+}
+
+// IssueOriginCertificate generates a private key and CSR locally, requests
+// an Origin CA certificate for it and verifies the result against the
+// Origin CA root.
+//
+// This function requires api.APIUserServiceKey be set to your Certificates API key.
+func (api *API) IssueOriginCertificate(ctx context.Context, opts OriginCAIssueOptions) (*OriginCACertificateBundle, error) {
+	requestType := opts.RequestType
+	if requestType == "" {
+		requestType = OriginCARequestTypeRSA
+	}
+	validity := opts.RequestValidity
+	if validity == 0 {
+		validity = OriginCAValidity15Years
+	}
+
+	root := opts.RootCertificate
+	if len(root) == 0 {
+		var err error
+		if root, err = OriginCARootCertificate(originCARootAlgorithm(requestType)); err != nil {
+			return nil, errors.Wrap(err, "failed to get Origin CA root certificate")
+		}
+	}
+
+	key, keyPEM, csrPEM, err := GenerateOriginCACSR(requestType, opts.Hostnames)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := api.CreateOriginCertificate(ctx, OriginCACertificate{
+		Hostnames:       opts.Hostnames,
+		RequestType:     requestType,
+		RequestValidity: validity,
+		CSR:             string(csrPEM),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := []byte(cert.Certificate)
+	if err := VerifyOriginCACertificate(certPEM, root, opts.Hostnames, key); err != nil {
+		// The certificate is unusable, so don't leave it active.
+		_, _ = api.RevokeOriginCertificate(ctx, cert.ID)
+		return nil, errors.Wrapf(err, "invalid certificate %s", cert.ID)
+	}
+
+	return &OriginCACertificateBundle{
+		Certificate:    *cert,
+		PrivateKey:     key,
+		PrivateKeyPEM:  keyPEM,
+		CertificatePEM: certPEM,
+	}, nil
+}
+
+// originCARootAlgorithm returns the algorithm of the Origin CA root which
+// signs certificates of a request type.
+func originCARootAlgorithm(requestType string) string {
+	if requestType == OriginCARequestTypeECC {
+		return "ecc"
+	}
+	return "rsa"
+}
+
+// OriginCACertificateSink receives a renewed certificate, for instance to
+// install it on the origin, before the certificate it replaces is revoked.
+type OriginCACertificateSink func(ctx context.Context, old OriginCACertificate, renewed *OriginCACertificateBundle) error
+
+// OriginCARenewalOptions configures RenewOriginCertificates.
+type OriginCARenewalOptions struct {
+	// ZoneID selects the certificates to consider.
+	ZoneID string
+	// Threshold renews certificates expiring within this duration.
+	Threshold time.Duration
+	// Sink receives each renewed certificate. If it fails the renewed
+	// certificate is revoked and the old one kept.
+	Sink OriginCACertificateSink
+	// RootCertificate is passed on to IssueOriginCertificate. If empty, the
+	// roots are downloaded once per key algorithm.
+	RootCertificate []byte
+}
+
+// OriginCARenewal is a certificate replaced by RenewOriginCertificates.
+type OriginCARenewal struct {
+	Old     OriginCACertificate
+	Renewed *OriginCACertificateBundle
+}
+
+// RenewOriginCertificates re-issues the certificates of a zone which expire
+// within the threshold, keeping their hostnames, request type and validity,
+// hands each new certificate to the sink and then revokes the old one.
+// Certificates are renewed soonest expiring first; on error the renewals
+// handed to the sink so far are returned, including one whose old
+// certificate could not be revoked.
+//
+// This function requires api.APIUserServiceKey be set to your Certificates API key.
+func (api *API) RenewOriginCertificates(ctx context.Context, opts OriginCARenewalOptions) ([]OriginCARenewal, error) {
+	if opts.Sink == nil {
+		return nil, errors.New("a sink is required to receive renewed certificates")
+	}
+
+	certs, err := api.OriginCertificates(ctx, OriginCACertificateListOptions{ZoneID: opts.ZoneID})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(opts.Threshold)
+	var expiring []OriginCACertificate
+	for _, cert := range certs {
+		if cert.RevokedAt.IsZero() && cert.ExpiresOn.Before(deadline) {
+			expiring = append(expiring, cert)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool { return expiring[i].ExpiresOn.Before(expiring[j].ExpiresOn) })
+
+	roots := make(map[string][]byte)
+	var renewals []OriginCARenewal
+	for _, old := range expiring {
+		root := opts.RootCertificate
+		if len(root) == 0 {
+			algorithm := originCARootAlgorithm(old.RequestType)
+			if root = roots[algorithm]; root == nil {
+				if root, err = OriginCARootCertificate(algorithm); err != nil {
+					return renewals, errors.Wrap(err, "failed to get Origin CA root certificate")
+				}
+				roots[algorithm] = root
+			}
+		}
+
+		renewed, err := api.IssueOriginCertificate(ctx, OriginCAIssueOptions{
+			Hostnames:       old.Hostnames,
+			RequestType:     old.RequestType,
+			RequestValidity: old.RequestValidity,
+			RootCertificate: root,
+		})
+		if err != nil {
+			return renewals, errors.Wrapf(err, "failed to renew certificate %s", old.ID)
+		}
+
+		if err := opts.Sink(ctx, old, renewed); err != nil {
+			if _, revokeErr := api.RevokeOriginCertificate(ctx, renewed.Certificate.ID); revokeErr != nil {
+				return renewals, errors.Wrapf(err, "failed to store renewal of certificate %s (revoking %s also failed: %s)", old.ID, renewed.Certificate.ID, revokeErr)
+			}
+			return renewals, errors.Wrapf(err, "failed to store renewal of certificate %s", old.ID)
+		}
+
+		// The new certificate is in use from here on, so it is reported even
+		// if the old one cannot be revoked.
+		renewals = append(renewals, OriginCARenewal{Old: old, Renewed: renewed})
+
+		if _, err := api.RevokeOriginCertificate(ctx, old.ID); err != nil {
+			return renewals, errors.Wrapf(err, "failed to revoke certificate %s", old.ID)
+		}
+	}
+
+	return renewals, nil
+}
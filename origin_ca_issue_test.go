@@ -0,0 +1,305 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOriginCA is a fake Origin CA which signs the CSRs it receives.
+type testOriginCA struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	cert    *x509.Certificate
+	rootPEM []byte
+
+	mu      sync.Mutex
+	serial  int64
+	issued  map[string]OriginCACertificate
+	revoked []string
+	// dropHostname removes a hostname from issued certificates.
+	dropHostname string
+}
+
+func newTestOriginCA(t *testing.T) *testOriginCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Origin CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testOriginCA{
+		t:       t,
+		key:     key,
+		cert:    cert,
+		rootPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial:  1,
+		issued:  map[string]OriginCACertificate{},
+	}
+}
+
+func (ca *testOriginCA) handleCreate(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var req OriginCACertificate
+	assert.NoError(ca.t, json.NewDecoder(r.Body).Decode(&req))
+	block, _ := pem.Decode([]byte(req.CSR))
+	if !assert.NotNil(ca.t, block) {
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if !assert.NoError(ca.t, err) || !assert.NoError(ca.t, csr.CheckSignature()) {
+		return
+	}
+
+	var names []string
+	for _, name := range csr.DNSNames {
+		if name != ca.dropHostname {
+			names = append(names, name)
+		}
+	}
+
+	ca.serial++
+	expires := time.Now().Add(time.Duration(req.RequestValidity) * 24 * time.Hour).UTC().Truncate(time.Second)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      csr.Subject,
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     ca.cert.NotAfter,
+	}, ca.cert, csr.PublicKey, ca.key)
+	if !assert.NoError(ca.t, err) {
+		return
+	}
+
+	cert := OriginCACertificate{
+		ID:              fmt.Sprintf("cert-%d", ca.serial),
+		Certificate:     string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Hostnames:       req.Hostnames,
+		ExpiresOn:       expires,
+		RequestType:     req.RequestType,
+		RequestValidity: req.RequestValidity,
+		CSR:             req.CSR,
+	}
+	ca.issued[cert.ID] = cert
+	writeFakeResult(ca.t, w, cert)
+}
+
+func (ca *testOriginCA) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(ca.t, http.MethodDelete, r.Method, "Expected method 'DELETE', got %s", r.Method)
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	id := filepath.Base(r.URL.Path)
+	ca.revoked = append(ca.revoked, id)
+	writeFakeResult(ca.t, w, OriginCACertificateID{ID: id})
+}
+
+func TestGenerateOriginCACSR(t *testing.T) {
+	key, keyPEM, csrPEM, err := GenerateOriginCACSR(OriginCARequestTypeECC, []string{"example.com", "*.example.com"})
+	require.NoError(t, err)
+	assert.IsType(t, &ecdsa.PrivateKey{}, key)
+
+	block, _ := pem.Decode(keyPEM)
+	require.NotNil(t, block)
+	assert.Equal(t, "PRIVATE KEY", block.Type)
+
+	block, _ = pem.Decode(csrPEM)
+	require.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "*.example.com"}, csr.DNSNames)
+	assert.Equal(t, "example.com", csr.Subject.CommonName)
+
+	key, _, _, err = GenerateOriginCACSR(OriginCARequestTypeRSA, []string{"example.com"})
+	require.NoError(t, err)
+	assert.IsType(t, &rsa.PrivateKey{}, key)
+
+	_, _, _, err = GenerateOriginCACSR("origin-dsa", []string{"example.com"})
+	assert.EqualError(t, err, `unsupported request type "origin-dsa"`)
+	_, _, _, err = GenerateOriginCACSR(OriginCARequestTypeRSA, nil)
+	assert.EqualError(t, err, "at least one hostname is required")
+}
+
+func TestIssueOriginCertificate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ca := newTestOriginCA(t)
+	mux.HandleFunc("/certificates", ca.handleCreate)
+	mux.HandleFunc("/certificates/", ca.handleRevoke)
+
+	bundle, err := client.IssueOriginCertificate(context.Background(), OriginCAIssueOptions{
+		Hostnames:       []string{"example.com", "*.example.com"},
+		RequestType:     OriginCARequestTypeECC,
+		RequestValidity: OriginCAValidity90Days,
+		RootCertificate: ca.rootPEM,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "cert-2", bundle.Certificate.ID)
+	assert.Equal(t, OriginCARequestTypeECC, bundle.Certificate.RequestType)
+	assert.NoError(t, VerifyOriginCACertificate(bundle.CertificatePEM, ca.rootPEM, []string{"*.example.com"}, bundle.PrivateKey))
+
+	dir, err := ioutil.TempDir("", "origin-ca")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "origin.pem"), filepath.Join(dir, "origin.key")
+	require.NoError(t, bundle.WriteFiles(certFile, keyFile))
+	info, err := os.Stat(keyFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	written, err := ioutil.ReadFile(certFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, bundle.CertificatePEM, written)
+	}
+
+	// A certificate that does not match the request is revoked.
+	ca.dropHostname = "*.example.com"
+	_, err = client.IssueOriginCertificate(context.Background(), OriginCAIssueOptions{
+		Hostnames:       []string{"example.com", "*.example.com"},
+		RootCertificate: ca.rootPEM,
+	})
+	assert.EqualError(t, err, "invalid certificate cert-3: certificate does not cover *.example.com")
+	assert.Equal(t, []string{"cert-3"}, ca.revoked)
+
+	other := newTestOriginCA(t)
+	assert.Error(t, VerifyOriginCACertificate(bundle.CertificatePEM, other.rootPEM, nil, nil))
+	otherKey, _, _, err := GenerateOriginCACSR(OriginCARequestTypeECC, []string{"example.com"})
+	require.NoError(t, err)
+	assert.EqualError(t, VerifyOriginCACertificate(bundle.CertificatePEM, ca.rootPEM, nil, otherKey), "certificate does not match the private key")
+}
+
+func TestRenewOriginCertificates(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ca := newTestOriginCA(t)
+	mux.HandleFunc("/certificates", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			ca.handleCreate(w, r)
+			return
+		}
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		assert.Equal(t, testZoneID, r.URL.Query().Get("zone_id"))
+		soon := time.Now().Add(7 * 24 * time.Hour).UTC().Format(time.RFC3339)
+		sooner := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+		later := time.Now().Add(365 * 24 * time.Hour).UTC().Format(time.RFC3339)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": [
+			{"id": "old-1", "hostnames": ["a.example.com"], "expires_on": %q, "request_type": "origin-rsa", "requested_validity": 30},
+			{"id": "old-2", "hostnames": ["b.example.com"], "expires_on": %q, "request_type": "origin-ecc", "requested_validity": 90},
+			{"id": "fresh", "hostnames": ["c.example.com"], "expires_on": %q, "request_type": "origin-rsa", "requested_validity": 5475},
+			{"id": "revoked", "hostnames": ["d.example.com"], "expires_on": %q, "request_type": "origin-rsa", "requested_validity": 30, "revoked_at": %q}
+		]}`, soon, sooner, later, soon, sooner)
+	})
+	mux.HandleFunc("/certificates/", ca.handleRevoke)
+
+	var stored []string
+	renewals, err := client.RenewOriginCertificates(context.Background(), OriginCARenewalOptions{
+		ZoneID:          testZoneID,
+		Threshold:       30 * 24 * time.Hour,
+		RootCertificate: ca.rootPEM,
+		Sink: func(ctx context.Context, old OriginCACertificate, renewed *OriginCACertificateBundle) error {
+			stored = append(stored, old.ID+"->"+renewed.Certificate.ID)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	if assert.Len(t, renewals, 2) {
+		assert.Equal(t, "old-2", renewals[0].Old.ID)
+		assert.Equal(t, OriginCARequestTypeECC, renewals[0].Renewed.Certificate.RequestType)
+		assert.Equal(t, OriginCAValidity90Days, renewals[0].Renewed.Certificate.RequestValidity)
+		assert.Equal(t, []string{"b.example.com"}, renewals[0].Renewed.Certificate.Hostnames)
+		assert.Equal(t, "old-1", renewals[1].Old.ID)
+	}
+	assert.Equal(t, []string{"old-2->cert-2", "old-1->cert-3"}, stored)
+	assert.Equal(t, []string{"old-2", "old-1"}, ca.revoked)
+
+	// When the sink fails the renewed certificate is revoked instead.
+	ca.revoked = nil
+	renewals, err = client.RenewOriginCertificates(context.Background(), OriginCARenewalOptions{
+		ZoneID:          testZoneID,
+		Threshold:       30 * 24 * time.Hour,
+		RootCertificate: ca.rootPEM,
+		Sink: func(ctx context.Context, old OriginCACertificate, renewed *OriginCACertificateBundle) error {
+			return fmt.Errorf("disk full")
+		},
+	})
+	assert.EqualError(t, err, "failed to store renewal of certificate old-2: disk full")
+	assert.Empty(t, renewals)
+	assert.Equal(t, []string{"cert-4"}, ca.revoked)
+
+	_, err = client.RenewOriginCertificates(context.Background(), OriginCARenewalOptions{ZoneID: testZoneID})
+	assert.EqualError(t, err, "a sink is required to receive renewed certificates")
+}
+
+func TestRenewOriginCertificates_RevokeFails(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ca := newTestOriginCA(t)
+	mux.HandleFunc("/certificates", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			ca.handleCreate(w, r)
+			return
+		}
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": [
+			{"id": "old-1", "hostnames": ["a.example.com"], "expires_on": %q, "request_type": "origin-rsa", "requested_validity": 30}
+		]}`, time.Now().Add(24*time.Hour).UTC().Format(time.RFC3339))
+	})
+	mux.HandleFunc("/certificates/old-1", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method, "Expected method 'DELETE', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"success": false, "errors": [{"code": 1100, "message": "certificate is locked"}], "messages": [], "result": null}`)
+	})
+
+	// The sink has installed the new certificate, so it must be reported
+	// even though the old one is still active.
+	renewals, err := client.RenewOriginCertificates(context.Background(), OriginCARenewalOptions{
+		ZoneID:          testZoneID,
+		Threshold:       30 * 24 * time.Hour,
+		RootCertificate: ca.rootPEM,
+		Sink: func(ctx context.Context, old OriginCACertificate, renewed *OriginCACertificateBundle) error {
+			return nil
+		},
+	})
+	assert.EqualError(t, err, "failed to revoke certificate old-1: HTTP status 400: certificate is locked (1100)")
+	if assert.Len(t, renewals, 1) {
+		assert.Equal(t, "old-1", renewals[0].Old.ID)
+		assert.Equal(t, "cert-2", renewals[0].Renewed.Certificate.ID)
+	}
+}
@@ -251,6 +251,7 @@ type RulesetRule struct {
 	Description            string                             `json:"description"`
 	LastUpdated            *time.Time                         `json:"last_updated,omitempty"`
 	Ref                    string                             `json:"ref,omitempty"`
+	Categories             []string                           `json:"categories,omitempty"`
 	Enabled                bool                               `json:"enabled"`
 	ScoreThreshold         int                                `json:"score_threshold,omitempty"`
 	RateLimit              *RulesetRuleRateLimit              `json:"ratelimit,omitempty"`
@@ -0,0 +1,415 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RulesetRuleSensitivityLevelDefault RulesetRuleSensitivityLevel = "default"
+	RulesetRuleSensitivityLevelMedium  RulesetRuleSensitivityLevel = "medium"
+	RulesetRuleSensitivityLevelLow     RulesetRuleSensitivityLevel = "low"
+	RulesetRuleSensitivityLevelEOff    RulesetRuleSensitivityLevel = "eoff"
+)
+
+// RulesetRuleSensitivityLevelValues exposes all the available
+// `RulesetRuleSensitivityLevel` values as a slice of strings.
+func RulesetRuleSensitivityLevelValues() []string {
+	return []string{
+		string(RulesetRuleSensitivityLevelDefault),
+		string(RulesetRuleSensitivityLevelMedium),
+		string(RulesetRuleSensitivityLevelLow),
+		string(RulesetRuleSensitivityLevelEOff),
+	}
+}
+
+// RulesetRuleSensitivityLevel is the custom type for the sensitivity level
+// that can be set on individual rules of a managed ruleset.
+type RulesetRuleSensitivityLevel string
+
+// ManagedRulesetRuleFilter narrows down the rules of a managed ruleset. Empty
+// fields match every rule.
+type ManagedRulesetRuleFilter struct {
+	// Categories matches rules tagged with at least one of the categories.
+	Categories []string
+
+	// Description matches rules whose description contains the value,
+	// ignoring case.
+	Description string
+}
+
+// ManagedRulesetOverride is the desired behaviour for a rule or category of a
+// managed ruleset. Zero values leave the corresponding setting untouched.
+type ManagedRulesetOverride struct {
+	Action           RulesetRuleAction
+	Enabled          *bool
+	ScoreThreshold   int
+	SensitivityLevel RulesetRuleSensitivityLevel
+}
+
+// ManagedRulesetRuleBehaviour is the configuration a single rule of a managed
+// ruleset runs with.
+type ManagedRulesetRuleBehaviour struct {
+	ID               string
+	Description      string
+	Categories       []string
+	Action           string
+	Enabled          bool
+	ScoreThreshold   int
+	SensitivityLevel string
+}
+
+// ManagedRulesetRuleDiff compares the default behaviour of a managed rule with
+// the behaviour once overrides are applied.
+type ManagedRulesetRuleDiff struct {
+	Default   ManagedRulesetRuleBehaviour
+	Effective ManagedRulesetRuleBehaviour
+}
+
+// ManagedRulesetOverrides builds the overrides of an execute rule deploying a
+// managed ruleset, validating every override against the rules and
+// categories the ruleset actually contains.
+type ManagedRulesetOverrides struct {
+	ruleset   Ruleset
+	overrides RulesetRuleActionParametersOverrides
+}
+
+// NewManagedRulesetOverrides returns an empty set of overrides for a managed
+// ruleset.
+func NewManagedRulesetOverrides(ruleset Ruleset) (*ManagedRulesetOverrides, error) {
+	if ruleset.Kind != string(RulesetKindManaged) {
+		return nil, errors.Errorf("ruleset %q is of kind %q, expected %q", ruleset.ID, ruleset.Kind, RulesetKindManaged)
+	}
+
+	return &ManagedRulesetOverrides{ruleset: ruleset}, nil
+}
+
+// ManagedRulesetOverrides loads a managed ruleset from the account and
+// returns an empty set of overrides for it.
+//
+// API reference: https://api.cloudflare.com/#account-rulesets-get-an-account-ruleset
+func (api *API) ManagedRulesetOverrides(ctx context.Context, accountID, rulesetID string) (*ManagedRulesetOverrides, error) {
+	ruleset, err := api.GetAccountRuleset(ctx, accountID, rulesetID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewManagedRulesetOverrides(ruleset)
+}
+
+// FindManagedRulesetRules returns the rules of a ruleset matching the filter.
+func FindManagedRulesetRules(ruleset Ruleset, filter ManagedRulesetRuleFilter) []RulesetRule {
+	var rules []RulesetRule
+	description := strings.ToLower(filter.Description)
+	for _, rule := range ruleset.Rules {
+		if description != "" && !strings.Contains(strings.ToLower(rule.Description), description) {
+			continue
+		}
+
+		if len(filter.Categories) > 0 && !hasAnyCategory(rule, filter.Categories) {
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// ManagedRulesetCategories returns the sorted, de-duplicated categories the
+// rules of a ruleset are tagged with.
+func ManagedRulesetCategories(ruleset Ruleset) []string {
+	seen := make(map[string]bool)
+	var categories []string
+	for _, rule := range ruleset.Rules {
+		for _, category := range rule.Categories {
+			if !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+
+	return categories
+}
+
+// Ruleset returns the managed ruleset the overrides apply to.
+func (o *ManagedRulesetOverrides) Ruleset() Ruleset {
+	return o.ruleset
+}
+
+// SetRuleset overrides the action and enabled state of every rule in the
+// ruleset.
+func (o *ManagedRulesetOverrides) SetRuleset(override ManagedRulesetOverride) error {
+	if override.ScoreThreshold != 0 || override.SensitivityLevel != "" {
+		return errors.New("score threshold and sensitivity level can only be overridden on individual rules")
+	}
+
+	if err := validateManagedRulesetAction(override.Action); err != nil {
+		return err
+	}
+
+	o.overrides.Action = string(override.Action)
+	o.overrides.Enabled = override.Enabled
+
+	return nil
+}
+
+// OverrideCategory overrides the action and enabled state of every rule
+// tagged with the category. A later override of the same category, compared
+// case-insensitively, replaces the earlier one.
+func (o *ManagedRulesetOverrides) OverrideCategory(category string, override ManagedRulesetOverride) error {
+	if len(FindManagedRulesetRules(o.ruleset, ManagedRulesetRuleFilter{Categories: []string{category}})) == 0 {
+		return errors.Errorf("category %q not found in ruleset %q", category, o.ruleset.ID)
+	}
+
+	if override.ScoreThreshold != 0 || override.SensitivityLevel != "" {
+		return errors.New("score threshold and sensitivity level can only be overridden on individual rules")
+	}
+
+	if err := validateManagedRulesetAction(override.Action); err != nil {
+		return err
+	}
+
+	c := RulesetRuleActionParametersCategories{
+		Category: category,
+		Action:   string(override.Action),
+		Enabled:  override.Enabled,
+	}
+
+	for i := range o.overrides.Categories {
+		if strings.EqualFold(o.overrides.Categories[i].Category, category) {
+			o.overrides.Categories[i] = c
+			return nil
+		}
+	}
+	o.overrides.Categories = append(o.overrides.Categories, c)
+
+	return nil
+}
+
+// OverrideRule overrides a single rule by ID. A later override of the same
+// rule replaces the earlier one.
+func (o *ManagedRulesetOverrides) OverrideRule(ruleID string, override ManagedRulesetOverride) error {
+	found := false
+	for _, rule := range o.ruleset.Rules {
+		if rule.ID == ruleID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf("rule %q not found in ruleset %q", ruleID, o.ruleset.ID)
+	}
+
+	if err := validateManagedRulesetAction(override.Action); err != nil {
+		return err
+	}
+
+	if override.ScoreThreshold < 0 {
+		return errors.Errorf("score threshold must not be negative, got %d", override.ScoreThreshold)
+	}
+
+	if override.SensitivityLevel != "" && !contains(RulesetRuleSensitivityLevelValues(), string(override.SensitivityLevel)) {
+		return errors.Errorf("invalid sensitivity level %q, expected one of %s", override.SensitivityLevel, strings.Join(RulesetRuleSensitivityLevelValues(), ", "))
+	}
+
+	r := RulesetRuleActionParametersRules{
+		ID:               ruleID,
+		Action:           string(override.Action),
+		Enabled:          override.Enabled,
+		ScoreThreshold:   override.ScoreThreshold,
+		SensitivityLevel: string(override.SensitivityLevel),
+	}
+
+	for i := range o.overrides.Rules {
+		if o.overrides.Rules[i].ID == ruleID {
+			o.overrides.Rules[i] = r
+			return nil
+		}
+	}
+	o.overrides.Rules = append(o.overrides.Rules, r)
+
+	return nil
+}
+
+// OverrideRules overrides every rule matching the filter and returns the
+// number of rules affected.
+func (o *ManagedRulesetOverrides) OverrideRules(filter ManagedRulesetRuleFilter, override ManagedRulesetOverride) (int, error) {
+	rules := FindManagedRulesetRules(o.ruleset, filter)
+	for _, rule := range rules {
+		if err := o.OverrideRule(rule.ID, override); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(rules), nil
+}
+
+// Overrides returns the overrides built so far.
+func (o *ManagedRulesetOverrides) Overrides() RulesetRuleActionParametersOverrides {
+	return o.overrides
+}
+
+// ExecuteRule returns an execute rule deploying the managed ruleset with the
+// overrides for requests matching the expression. An empty expression matches
+// all requests. The rule belongs in the entrypoint ruleset of the managed
+// ruleset's phase, such as http_request_firewall_managed.
+func (o *ManagedRulesetOverrides) ExecuteRule(expression, description string) RulesetRule {
+	if expression == "" {
+		expression = "true"
+	}
+
+	rule := RulesetRule{
+		Action:      string(RulesetRuleActionExecute),
+		Expression:  expression,
+		Description: description,
+		Enabled:     true,
+		ActionParameters: &RulesetRuleActionParameters{
+			ID: o.ruleset.ID,
+		},
+	}
+
+	overrides := o.overrides
+	if overrides.Action != "" || overrides.Enabled != nil || len(overrides.Categories) > 0 || len(overrides.Rules) > 0 {
+		rule.ActionParameters.Overrides = &overrides
+	}
+
+	return rule
+}
+
+// EffectiveRules returns the behaviour of every rule in the ruleset once the
+// overrides are applied. Rule overrides take precedence over category
+// overrides which take precedence over ruleset overrides.
+func (o *ManagedRulesetOverrides) EffectiveRules() []ManagedRulesetRuleBehaviour {
+	behaviours := make([]ManagedRulesetRuleBehaviour, 0, len(o.ruleset.Rules))
+	for _, rule := range o.ruleset.Rules {
+		behaviours = append(behaviours, effectiveManagedRule(rule, o.overrides))
+	}
+
+	return behaviours
+}
+
+// Diff returns the rules whose effective behaviour differs from the managed
+// ruleset defaults.
+func (o *ManagedRulesetOverrides) Diff() []ManagedRulesetRuleDiff {
+	var diffs []ManagedRulesetRuleDiff
+	for _, rule := range o.ruleset.Rules {
+		def := defaultManagedRule(rule)
+		eff := effectiveManagedRule(rule, o.overrides)
+		if def.Action != eff.Action || def.Enabled != eff.Enabled ||
+			def.ScoreThreshold != eff.ScoreThreshold || def.SensitivityLevel != eff.SensitivityLevel {
+			diffs = append(diffs, ManagedRulesetRuleDiff{Default: def, Effective: eff})
+		}
+	}
+
+	return diffs
+}
+
+// String returns a human readable summary of the change.
+func (d ManagedRulesetRuleDiff) String() string {
+	var changes []string
+	if d.Default.Action != d.Effective.Action {
+		changes = append(changes, fmt.Sprintf("action %s -> %s", d.Default.Action, d.Effective.Action))
+	}
+	if d.Default.Enabled != d.Effective.Enabled {
+		changes = append(changes, fmt.Sprintf("enabled %t -> %t", d.Default.Enabled, d.Effective.Enabled))
+	}
+	if d.Default.ScoreThreshold != d.Effective.ScoreThreshold {
+		changes = append(changes, fmt.Sprintf("score threshold %d -> %d", d.Default.ScoreThreshold, d.Effective.ScoreThreshold))
+	}
+	if d.Default.SensitivityLevel != d.Effective.SensitivityLevel {
+		changes = append(changes, fmt.Sprintf("sensitivity level %s -> %s", d.Default.SensitivityLevel, d.Effective.SensitivityLevel))
+	}
+
+	return fmt.Sprintf("%s (%s): %s", d.Default.ID, d.Default.Description, strings.Join(changes, ", "))
+}
+
+func defaultManagedRule(rule RulesetRule) ManagedRulesetRuleBehaviour {
+	return ManagedRulesetRuleBehaviour{
+		ID:             rule.ID,
+		Description:    rule.Description,
+		Categories:     rule.Categories,
+		Action:         rule.Action,
+		Enabled:        rule.Enabled,
+		ScoreThreshold: rule.ScoreThreshold,
+	}
+}
+
+func effectiveManagedRule(rule RulesetRule, overrides RulesetRuleActionParametersOverrides) ManagedRulesetRuleBehaviour {
+	b := defaultManagedRule(rule)
+
+	if overrides.Action != "" {
+		b.Action = overrides.Action
+	}
+	if overrides.Enabled != nil {
+		b.Enabled = *overrides.Enabled
+	}
+
+	for _, c := range overrides.Categories {
+		if !hasAnyCategory(rule, []string{c.Category}) {
+			continue
+		}
+		if c.Action != "" {
+			b.Action = c.Action
+		}
+		if c.Enabled != nil {
+			b.Enabled = *c.Enabled
+		}
+	}
+
+	for _, r := range overrides.Rules {
+		if r.ID != rule.ID {
+			continue
+		}
+		if r.Action != "" {
+			b.Action = r.Action
+		}
+		if r.Enabled != nil {
+			b.Enabled = *r.Enabled
+		}
+		if r.ScoreThreshold != 0 {
+			b.ScoreThreshold = r.ScoreThreshold
+		}
+		if r.SensitivityLevel != "" {
+			b.SensitivityLevel = r.SensitivityLevel
+		}
+	}
+
+	return b
+}
+
+// managedRulesetOverrideActions are the actions managed rules can be
+// overridden with.
+var managedRulesetOverrideActions = []string{
+	string(RulesetRuleActionBlock),
+	string(RulesetRuleActionChallenge),
+	string(RulesetRuleActionJSChallenge),
+	string(RulesetRuleActionManagedChallenge),
+	string(RulesetRuleActionLog),
+}
+
+func validateManagedRulesetAction(action RulesetRuleAction) error {
+	if action != "" && !contains(managedRulesetOverrideActions, string(action)) {
+		return errors.Errorf("invalid override action %q, expected one of %s", action, strings.Join(managedRulesetOverrideActions, ", "))
+	}
+
+	return nil
+}
+
+func hasAnyCategory(rule RulesetRule, categories []string) bool {
+	for _, want := range categories {
+		for _, got := range rule.Categories {
+			if strings.EqualFold(want, got) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
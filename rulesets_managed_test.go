@@ -0,0 +1,198 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testManagedRuleset = Ruleset{
+	ID:    "efb7b8c949ac4650a09736fc376e9aee",
+	Name:  "Cloudflare Managed Ruleset",
+	Kind:  string(RulesetKindManaged),
+	Phase: string(RulesetPhaseHTTPRequestFirewallManaged),
+	Rules: []RulesetRule{
+		{
+			ID:          "5de7edfa648c4d6891dc3e7f84534ffa",
+			Action:      string(RulesetRuleActionBlock),
+			Description: "Apache Struts - Code Injection - CVE:CVE-2017-5638",
+			Categories:  []string{"apache-struts", "cve-2017-5638"},
+			Enabled:     true,
+		},
+		{
+			ID:          "e3a567afc347477d9702d9047e97d760",
+			Action:      string(RulesetRuleActionLog),
+			Description: "WordPress - Dangerous File Upload",
+			Categories:  []string{"wordpress"},
+			Enabled:     false,
+		},
+		{
+			ID:          "6179ae15870a4bb7b2d480d4843b323c",
+			Action:      string(RulesetRuleActionBlock),
+			Description: "Anomaly score threshold",
+			Categories:  []string{"paranoia-level-1"},
+			Enabled:     true,
+		},
+	},
+}
+
+func TestManagedRulesetOverrides(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{
+      "result": {
+        "id": "efb7b8c949ac4650a09736fc376e9aee",
+        "name": "Cloudflare Managed Ruleset",
+        "kind": "managed",
+        "phase": "http_request_firewall_managed",
+        "rules": [
+          {
+            "id": "5de7edfa648c4d6891dc3e7f84534ffa",
+            "action": "block",
+            "categories": ["apache-struts", "cve-2017-5638"],
+            "description": "Apache Struts - Code Injection - CVE:CVE-2017-5638",
+            "enabled": true
+          }
+        ]
+      },
+      "success": true,
+      "errors": [],
+      "messages": []
+    }`)
+	}
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/rulesets/efb7b8c949ac4650a09736fc376e9aee", handler)
+
+	o, err := client.ManagedRulesetOverrides(context.Background(), testAccountID, "efb7b8c949ac4650a09736fc376e9aee")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"apache-struts", "cve-2017-5638"}, o.Ruleset().Rules[0].Categories)
+	}
+}
+
+func TestNewManagedRulesetOverrides_NotManaged(t *testing.T) {
+	_, err := NewManagedRulesetOverrides(Ruleset{ID: "abc", Kind: string(RulesetKindCustom)})
+	assert.Error(t, err)
+}
+
+func TestFindManagedRulesetRules(t *testing.T) {
+	rules := FindManagedRulesetRules(testManagedRuleset, ManagedRulesetRuleFilter{Categories: []string{"WordPress"}})
+	if assert.Len(t, rules, 1) {
+		assert.Equal(t, "e3a567afc347477d9702d9047e97d760", rules[0].ID)
+	}
+
+	rules = FindManagedRulesetRules(testManagedRuleset, ManagedRulesetRuleFilter{Description: "struts"})
+	if assert.Len(t, rules, 1) {
+		assert.Equal(t, "5de7edfa648c4d6891dc3e7f84534ffa", rules[0].ID)
+	}
+
+	rules = FindManagedRulesetRules(testManagedRuleset, ManagedRulesetRuleFilter{})
+	assert.Len(t, rules, 3)
+
+	assert.Equal(t,
+		[]string{"apache-struts", "cve-2017-5638", "paranoia-level-1", "wordpress"},
+		ManagedRulesetCategories(testManagedRuleset))
+}
+
+func TestManagedRulesetOverrides_Validation(t *testing.T) {
+	o, err := NewManagedRulesetOverrides(testManagedRuleset)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Error(t, o.OverrideCategory("drupal", ManagedRulesetOverride{Enabled: BoolPtr(true)}))
+	assert.Error(t, o.OverrideCategory("wordpress", ManagedRulesetOverride{ScoreThreshold: 40}))
+	assert.Error(t, o.OverrideRule("doesnotexist", ManagedRulesetOverride{Enabled: BoolPtr(true)}))
+	assert.Error(t, o.OverrideRule("5de7edfa648c4d6891dc3e7f84534ffa", ManagedRulesetOverride{Action: "explode"}))
+	assert.EqualError(t, o.OverrideRule("5de7edfa648c4d6891dc3e7f84534ffa", ManagedRulesetOverride{Action: RulesetRuleActionSkip}),
+		`invalid override action "skip", expected one of block, challenge, js_challenge, managed_challenge, log`)
+	assert.Error(t, o.SetRuleset(ManagedRulesetOverride{Action: RulesetRuleActionExecute}))
+	assert.Error(t, o.OverrideRule("5de7edfa648c4d6891dc3e7f84534ffa", ManagedRulesetOverride{SensitivityLevel: "extreme"}))
+	assert.Error(t, o.SetRuleset(ManagedRulesetOverride{SensitivityLevel: RulesetRuleSensitivityLevelLow}))
+	assert.Equal(t, RulesetRuleActionParametersOverrides{}, o.Overrides())
+}
+
+func TestManagedRulesetOverrides_CategoryCase(t *testing.T) {
+	o, err := NewManagedRulesetOverrides(testManagedRuleset)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, o.OverrideCategory("WordPress", ManagedRulesetOverride{Action: RulesetRuleActionLog}))
+	assert.NoError(t, o.OverrideCategory("wordpress", ManagedRulesetOverride{Action: RulesetRuleActionBlock}))
+	assert.Equal(t, []RulesetRuleActionParametersCategories{
+		{Category: "wordpress", Action: string(RulesetRuleActionBlock)},
+	}, o.Overrides().Categories)
+}
+
+func TestManagedRulesetOverrides_ExecuteRule(t *testing.T) {
+	o, err := NewManagedRulesetOverrides(testManagedRuleset)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rule := o.ExecuteRule("", "deploy managed ruleset")
+	assert.Nil(t, rule.ActionParameters.Overrides)
+
+	assert.NoError(t, o.SetRuleset(ManagedRulesetOverride{Action: RulesetRuleActionLog}))
+	assert.NoError(t, o.OverrideCategory("wordpress", ManagedRulesetOverride{Enabled: BoolPtr(true)}))
+	assert.NoError(t, o.OverrideCategory("wordpress", ManagedRulesetOverride{Enabled: BoolPtr(true), Action: RulesetRuleActionBlock}))
+	n, err := o.OverrideRules(ManagedRulesetRuleFilter{Description: "anomaly score"}, ManagedRulesetOverride{ScoreThreshold: 40})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	want := RulesetRule{
+		Action:      string(RulesetRuleActionExecute),
+		Expression:  "true",
+		Description: "deploy managed ruleset",
+		Enabled:     true,
+		ActionParameters: &RulesetRuleActionParameters{
+			ID: "efb7b8c949ac4650a09736fc376e9aee",
+			Overrides: &RulesetRuleActionParametersOverrides{
+				Action: string(RulesetRuleActionLog),
+				Categories: []RulesetRuleActionParametersCategories{
+					{Category: "wordpress", Action: string(RulesetRuleActionBlock), Enabled: BoolPtr(true)},
+				},
+				Rules: []RulesetRuleActionParametersRules{
+					{ID: "6179ae15870a4bb7b2d480d4843b323c", ScoreThreshold: 40},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, want, o.ExecuteRule("", "deploy managed ruleset"))
+}
+
+func TestManagedRulesetOverrides_Diff(t *testing.T) {
+	o, err := NewManagedRulesetOverrides(testManagedRuleset)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Empty(t, o.Diff())
+
+	assert.NoError(t, o.SetRuleset(ManagedRulesetOverride{Action: RulesetRuleActionLog}))
+	assert.NoError(t, o.OverrideCategory("wordpress", ManagedRulesetOverride{Enabled: BoolPtr(true)}))
+	assert.NoError(t, o.OverrideRule("5de7edfa648c4d6891dc3e7f84534ffa", ManagedRulesetOverride{Action: RulesetRuleActionBlock}))
+	assert.NoError(t, o.OverrideRule("6179ae15870a4bb7b2d480d4843b323c", ManagedRulesetOverride{ScoreThreshold: 25, Action: RulesetRuleActionBlock}))
+
+	effective := o.EffectiveRules()
+	if assert.Len(t, effective, 3) {
+		assert.Equal(t, string(RulesetRuleActionBlock), effective[0].Action)
+		assert.Equal(t, string(RulesetRuleActionLog), effective[1].Action)
+		assert.True(t, effective[1].Enabled)
+	}
+
+	diffs := o.Diff()
+	if assert.Len(t, diffs, 2) {
+		assert.Equal(t, "e3a567afc347477d9702d9047e97d760", diffs[0].Effective.ID)
+		assert.Equal(t, "e3a567afc347477d9702d9047e97d760 (WordPress - Dangerous File Upload): enabled false -> true", diffs[0].String())
+		assert.Equal(t, "6179ae15870a4bb7b2d480d4843b323c (Anomaly score threshold): score threshold 0 -> 25", diffs[1].String())
+	}
+}
@@ -0,0 +1,287 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Device posture check statuses used in compliance reports.
+const (
+	TeamsDeviceCheckPassed        = "passed"
+	TeamsDeviceCheckFailed        = "failed"
+	TeamsDeviceCheckUnknown       = "unknown"
+	TeamsDeviceCheckNotApplicable = "not_applicable"
+)
+
+// Device compliance statuses used in compliance reports.
+const (
+	TeamsDeviceCompliant    = "compliant"
+	TeamsDeviceNonCompliant = "non_compliant"
+	TeamsDeviceUnknown      = "unknown"
+)
+
+// TeamsDevicePostureResult is the outcome of a single posture rule on a
+// device.
+type TeamsDevicePostureResult struct {
+	RuleID  string
+	Success bool
+}
+
+// TeamsDevicePostureResultsFunc returns the latest posture results for a
+// device. The API does not expose per-device results, so callers supply
+// them from wherever they are collected, such as Gateway logs.
+type TeamsDevicePostureResultsFunc func(ctx context.Context, device TeamsDeviceListItem) ([]TeamsDevicePostureResult, error)
+
+// TeamsDeviceComplianceOptions configures TeamsDeviceComplianceReport.
+type TeamsDeviceComplianceOptions struct {
+	// Results looks up posture results per device. Without it every
+	// applicable check is reported as unknown.
+	Results TeamsDevicePostureResultsFunc
+	// IncludeRevoked includes revoked and deleted devices in the report.
+	IncludeRevoked bool
+}
+
+// TeamsDeviceComplianceCheck is the status of one posture rule on a device.
+type TeamsDeviceComplianceCheck struct {
+	RuleID   string `json:"rule_id"`
+	RuleName string `json:"rule_name"`
+	RuleType string `json:"rule_type"`
+	Status   string `json:"status"`
+}
+
+// TeamsDeviceComplianceEntry is the compliance of a single device.
+type TeamsDeviceComplianceEntry struct {
+	Device TeamsDeviceListItem          `json:"device"`
+	Status string                       `json:"status"`
+	Checks []TeamsDeviceComplianceCheck `json:"checks"`
+}
+
+// FailedChecks returns the checks the device failed.
+func (e TeamsDeviceComplianceEntry) FailedChecks() []TeamsDeviceComplianceCheck {
+	var failed []TeamsDeviceComplianceCheck
+	for _, check := range e.Checks {
+		if check.Status == TeamsDeviceCheckFailed {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// TeamsDeviceComplianceReport joins devices, their users and the account's
+// posture rules.
+type TeamsDeviceComplianceReport struct {
+	Rules   []DevicePostureRule          `json:"rules"`
+	Devices []TeamsDeviceComplianceEntry `json:"devices"`
+}
+
+// NonCompliant returns the devices failing at least one posture check.
+func (r TeamsDeviceComplianceReport) NonCompliant() []TeamsDeviceComplianceEntry {
+	var entries []TeamsDeviceComplianceEntry
+	for _, entry := range r.Devices {
+		if entry.Status == TeamsDeviceNonCompliant {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r TeamsDeviceComplianceReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the report with one row per device and one column per
+// posture rule.
+func (r TeamsDeviceComplianceReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"device_id", "device_name", "device_type", "os_version", "serial_number", "user_name", "user_email", "last_seen", "status", "failed_checks"}
+	for _, rule := range r.Rules {
+		header = append(header, rule.Name)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range r.Devices {
+		var failed []string
+		for _, check := range entry.FailedChecks() {
+			failed = append(failed, check.RuleName)
+		}
+
+		d := entry.Device
+		row := []string{d.ID, d.Name, d.DeviceType, d.OSVersion, d.SerialNumber, d.User.Name, d.User.Email, d.LastSeen, entry.Status, strings.Join(failed, ";")}
+		for _, check := range entry.Checks {
+			row = append(row, check.Status)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// TeamsDeviceComplianceReport builds a posture compliance report for every
+// device in an account.
+func (api *API) TeamsDeviceComplianceReport(ctx context.Context, accountID string, opts TeamsDeviceComplianceOptions) (TeamsDeviceComplianceReport, error) {
+	devices, err := api.ListTeamsDevices(ctx, accountID)
+	if err != nil {
+		return TeamsDeviceComplianceReport{}, err
+	}
+
+	rules, _, err := api.DevicePostureRules(ctx, accountID)
+	if err != nil {
+		return TeamsDeviceComplianceReport{}, err
+	}
+
+	report := TeamsDeviceComplianceReport{Rules: rules}
+	for _, device := range devices {
+		if !opts.IncludeRevoked && (device.Deleted || device.RevokedAt != "") {
+			continue
+		}
+
+		var results []TeamsDevicePostureResult
+		if opts.Results != nil {
+			results, err = opts.Results(ctx, device)
+			if err != nil {
+				return TeamsDeviceComplianceReport{}, errors.Wrapf(err, "failed to get posture results for device %s", device.ID)
+			}
+		}
+
+		report.Devices = append(report.Devices, teamsDeviceCompliance(device, rules, results))
+	}
+
+	return report, nil
+}
+
+// teamsDeviceCompliance evaluates a device against the posture rules given
+// the results known for it.
+func teamsDeviceCompliance(device TeamsDeviceListItem, rules []DevicePostureRule, results []TeamsDevicePostureResult) TeamsDeviceComplianceEntry {
+	success := make(map[string]bool, len(results))
+	for _, result := range results {
+		success[result.RuleID] = result.Success
+	}
+
+	entry := TeamsDeviceComplianceEntry{Device: device, Status: TeamsDeviceCompliant}
+	for _, rule := range rules {
+		check := TeamsDeviceComplianceCheck{RuleID: rule.ID, RuleName: rule.Name, RuleType: rule.Type}
+		ok, known := success[rule.ID]
+		switch {
+		case !devicePostureRuleApplies(rule, device.DeviceType):
+			check.Status = TeamsDeviceCheckNotApplicable
+		case !known:
+			check.Status = TeamsDeviceCheckUnknown
+			if entry.Status == TeamsDeviceCompliant {
+				entry.Status = TeamsDeviceUnknown
+			}
+		case ok:
+			check.Status = TeamsDeviceCheckPassed
+		default:
+			check.Status = TeamsDeviceCheckFailed
+			entry.Status = TeamsDeviceNonCompliant
+		}
+		entry.Checks = append(entry.Checks, check)
+	}
+
+	return entry
+}
+
+// devicePostureRuleApplies reports whether a rule runs on the given device
+// platform. Rules without match conditions run everywhere.
+func devicePostureRuleApplies(rule DevicePostureRule, platform string) bool {
+	if len(rule.Match) == 0 {
+		return true
+	}
+	for _, match := range rule.Match {
+		if strings.EqualFold(match.Platform, platform) {
+			return true
+		}
+	}
+	return false
+}
+
+// StaleTeamsDevices returns the active devices that have not been seen since
+// the cutoff. Devices that have never been seen are judged by when they were
+// created.
+func StaleTeamsDevices(devices []TeamsDeviceListItem, cutoff time.Time) []TeamsDeviceListItem {
+	var stale []TeamsDeviceListItem
+	for _, device := range devices {
+		if device.Deleted || device.RevokedAt != "" {
+			continue
+		}
+
+		seen := device.LastSeen
+		if seen == "" {
+			seen = device.Created
+		}
+		t, err := time.Parse(time.RFC3339, seen)
+		if err != nil {
+			continue
+		}
+		if t.Before(cutoff) {
+			stale = append(stale, device)
+		}
+	}
+	return stale
+}
+
+// teamsDeviceRevokeChunkSize is the maximum number of devices revoked by a
+// single request.
+const teamsDeviceRevokeChunkSize = 100
+
+// RevokeStaleTeamsDevices revokes every device in an account that has not
+// been seen since the cutoff and returns the revoked devices. To revoke
+// devices unseen for 30 days, pass time.Now().AddDate(0, 0, -30).
+//
+// Devices are revoked in chunks of 100. A failed chunk does not stop the
+// others: the devices revoked by the successful chunks are returned along
+// with an error naming each failed chunk.
+func (api *API) RevokeStaleTeamsDevices(ctx context.Context, accountID string, cutoff time.Time) ([]TeamsDeviceListItem, error) {
+	devices, err := api.ListTeamsDevices(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := StaleTeamsDevices(devices, cutoff)
+	if len(stale) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(stale))
+	for _, device := range stale {
+		ids = append(ids, device.ID)
+	}
+
+	var revoked []TeamsDeviceListItem
+	var failures []string
+	failed := 0
+	for i := 0; i < len(ids); i += teamsDeviceRevokeChunkSize {
+		chunk := chunkStrings(ids, i, teamsDeviceRevokeChunkSize)
+		if _, err := api.RevokeTeamsDevices(ctx, accountID, chunk); err != nil {
+			failed += len(chunk)
+			failures = append(failures, fmt.Sprintf("devices %s to %s: %s", chunk[0], chunk[len(chunk)-1], err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		revoked = append(revoked, stale[i:i+len(chunk)]...)
+	}
+
+	if len(failures) > 0 {
+		return revoked, errors.Errorf("failed to revoke %d of %d stale devices: %s", failed, len(stale), strings.Join(failures, "; "))
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,160 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTeamsDevicesReportDevices = `[
+  {"id": "dev-1", "name": "Laptop", "device_type": "mac", "os_version": "12.1", "serial_number": "C02AAA", "last_seen": "2021-12-01T00:00:00Z", "user": {"name": "Ann", "email": "ann@example.com"}},
+  {"id": "dev-2", "name": "Desktop", "device_type": "windows", "os_version": "10.0", "serial_number": "W10BBB", "last_seen": "2021-10-01T00:00:00Z", "user": {"name": "Bob", "email": "bob@example.com"}},
+  {"id": "dev-3", "name": "Phone", "device_type": "ios", "created": "2021-09-01T00:00:00Z", "user": {"name": "Cat", "email": "cat@example.com"}},
+  {"id": "dev-4", "name": "Old", "device_type": "linux", "last_seen": "2020-01-01T00:00:00Z", "revoked_at": "2020-02-01T00:00:00Z"}
+]`
+
+func setupTeamsDevicesReport(t *testing.T) {
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, testTeamsDevicesReportDevices)
+	})
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices/posture", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": [
+			{"id": "disk", "name": "Disk encryption", "type": "disk_encryption"},
+			{"id": "fw", "name": "Firewall", "type": "firewall", "match": [{"platform": "windows"}, {"platform": "mac"}]}
+		]}`)
+	})
+}
+
+func TestTeamsDeviceComplianceReport(t *testing.T) {
+	setup()
+	defer teardown()
+	setupTeamsDevicesReport(t)
+
+	results := map[string][]TeamsDevicePostureResult{
+		"dev-1": {{RuleID: "disk", Success: true}, {RuleID: "fw", Success: true}},
+		"dev-2": {{RuleID: "disk", Success: false}, {RuleID: "fw", Success: true}},
+	}
+	report, err := client.TeamsDeviceComplianceReport(context.Background(), testAccountID, TeamsDeviceComplianceOptions{
+		Results: func(ctx context.Context, device TeamsDeviceListItem) ([]TeamsDevicePostureResult, error) {
+			return results[device.ID], nil
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if assert.Len(t, report.Devices, 3) {
+		assert.Equal(t, TeamsDeviceCompliant, report.Devices[0].Status)
+		assert.Equal(t, TeamsDeviceNonCompliant, report.Devices[1].Status)
+		assert.Equal(t, TeamsDeviceUnknown, report.Devices[2].Status)
+		assert.Equal(t, []TeamsDeviceComplianceCheck{
+			{RuleID: "disk", RuleName: "Disk encryption", RuleType: "disk_encryption", Status: TeamsDeviceCheckUnknown},
+			{RuleID: "fw", RuleName: "Firewall", RuleType: "firewall", Status: TeamsDeviceCheckNotApplicable},
+		}, report.Devices[2].Checks)
+	}
+
+	nonCompliant := report.NonCompliant()
+	if assert.Len(t, nonCompliant, 1) {
+		assert.Equal(t, "bob@example.com", nonCompliant[0].Device.User.Email)
+		assert.Equal(t, "Disk encryption", nonCompliant[0].FailedChecks()[0].RuleName)
+	}
+
+	var csv bytes.Buffer
+	assert.NoError(t, report.WriteCSV(&csv))
+	assert.Equal(t, "device_id,device_name,device_type,os_version,serial_number,user_name,user_email,last_seen,status,failed_checks,Disk encryption,Firewall\n"+
+		"dev-1,Laptop,mac,12.1,C02AAA,Ann,ann@example.com,2021-12-01T00:00:00Z,compliant,,passed,passed\n"+
+		"dev-2,Desktop,windows,10.0,W10BBB,Bob,bob@example.com,2021-10-01T00:00:00Z,non_compliant,Disk encryption,failed,passed\n"+
+		"dev-3,Phone,ios,,,Cat,cat@example.com,,unknown,,unknown,not_applicable\n", csv.String())
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteJSON(&buf))
+	var decoded TeamsDeviceComplianceReport
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded)) {
+		assert.Equal(t, report, decoded)
+	}
+
+	report, err = client.TeamsDeviceComplianceReport(context.Background(), testAccountID, TeamsDeviceComplianceOptions{IncludeRevoked: true})
+	if assert.NoError(t, err) {
+		assert.Len(t, report.Devices, 4)
+	}
+}
+
+func TestRevokeStaleTeamsDevices(t *testing.T) {
+	setup()
+	defer teardown()
+	setupTeamsDevicesReport(t)
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices/revoke", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+		var ids []string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&ids))
+		assert.Equal(t, []string{"dev-2", "dev-3"}, ids)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": null}`)
+	})
+
+	cutoff := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	revoked, err := client.RevokeStaleTeamsDevices(context.Background(), testAccountID, cutoff)
+	if assert.NoError(t, err) && assert.Len(t, revoked, 2) {
+		assert.Equal(t, "dev-2", revoked[0].ID)
+		assert.Equal(t, "dev-3", revoked[1].ID)
+	}
+
+	revoked, err = client.RevokeStaleTeamsDevices(context.Background(), testAccountID, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Empty(t, revoked)
+}
+
+func TestRevokeStaleTeamsDevices_Chunks(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var devices []string
+	for i := 1; i <= 250; i++ {
+		devices = append(devices, fmt.Sprintf(`{"id": "dev-%d", "device_type": "mac", "last_seen": "2021-01-01T00:00:00Z"}`, i))
+	}
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": [%s]}`, strings.Join(devices, ","))
+	})
+
+	// The second chunk fails; the first and third are still revoked.
+	var chunks [][]string
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices/revoke", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+		var ids []string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&ids))
+		chunks = append(chunks, ids)
+		w.Header().Set("content-type", "application/json")
+		if len(chunks) == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success": false, "errors": [{"code": 1000, "message": "revocation failed"}], "messages": [], "result": null}`)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": null}`)
+	})
+
+	revoked, err := client.RevokeStaleTeamsDevices(context.Background(), testAccountID, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.EqualError(t, err, "failed to revoke 100 of 250 stale devices: devices dev-101 to dev-200: HTTP status 400: revocation failed (1000)")
+	if assert.Len(t, chunks, 3) {
+		assert.Len(t, chunks[0], 100)
+		assert.Len(t, chunks[1], 100)
+		assert.Equal(t, []string{"dev-201", "dev-250"}, []string{chunks[2][0], chunks[2][49]})
+	}
+	if assert.Len(t, revoked, 150) {
+		assert.Equal(t, "dev-100", revoked[99].ID)
+		assert.Equal(t, "dev-201", revoked[100].ID)
+	}
+}
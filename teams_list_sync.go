@@ -0,0 +1,254 @@
+package cloudflare
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Teams list types.
+const (
+	TeamsListTypeDomain = "DOMAIN"
+	TeamsListTypeEmail  = "EMAIL"
+	TeamsListTypeIP     = "IP"
+	TeamsListTypeSerial = "SERIAL"
+	TeamsListTypeURL    = "URL"
+)
+
+const defaultTeamsListSyncChunkSize = 1000
+
+// TeamsListSyncOptions configures SyncTeamsList.
+type TeamsListSyncOptions struct {
+	// ChunkSize is the maximum number of items appended and removed by a
+	// single patch request. Defaults to 1000.
+	ChunkSize int
+	// DryRun computes the changes without applying them.
+	DryRun bool
+}
+
+// TeamsListDiff is the set of changes that brings a list in line with the
+// desired items.
+type TeamsListDiff struct {
+	Append    []string
+	Remove    []string
+	Unchanged int
+}
+
+// Empty reports whether the list is already in sync.
+func (d TeamsListDiff) Empty() bool {
+	return len(d.Append) == 0 && len(d.Remove) == 0
+}
+
+// ReadTeamsListItems reads list items from a feed with one item per line.
+// Blank lines and lines starting with # are skipped.
+func ReadTeamsListItems(r io.Reader) ([]string, error) {
+	var items []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ValidateTeamsListItem checks that a value can be stored in a list of the
+// given type.
+func ValidateTeamsListItem(listType, value string) error {
+	if value == "" {
+		return errors.New("value is empty")
+	}
+
+	switch listType {
+	case TeamsListTypeDomain:
+		return validateTeamsListDomain(value)
+	case TeamsListTypeEmail:
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return errors.New("not an email address")
+		}
+	case TeamsListTypeIP:
+		if net.ParseIP(value) == nil {
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return errors.New("not an IP address or CIDR")
+			}
+		}
+	case TeamsListTypeSerial:
+		if strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+			return errors.New("serial numbers cannot contain whitespace")
+		}
+	case TeamsListTypeURL:
+		raw := value
+		if !strings.Contains(raw, "://") {
+			raw = "https://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return errors.New("not a URL")
+		}
+		return validateTeamsListDomain(u.Hostname())
+	default:
+		return errors.Errorf("unknown list type %q", listType)
+	}
+
+	return nil
+}
+
+func validateTeamsListDomain(domain string) error {
+	domain = strings.TrimSuffix(domain, ".")
+	if net.ParseIP(domain) != nil {
+		return errors.New("IP addresses are not domains")
+	}
+	if len(domain) > 253 {
+		return errors.New("domain is longer than 253 characters")
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return errors.New("domain must have at least two labels")
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return errors.Errorf("invalid domain label %q", label)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return errors.Errorf("invalid domain label %q", label)
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeTeamsListItem returns the form of a value used to compare items,
+// so that case differences in domains and emails are not treated as
+// changes.
+func normalizeTeamsListItem(listType, value string) string {
+	value = strings.TrimSpace(value)
+	switch listType {
+	case TeamsListTypeDomain:
+		return strings.ToLower(strings.TrimSuffix(value, "."))
+	case TeamsListTypeEmail:
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// DiffTeamsListItems computes the items to append to and remove from a list
+// of the given type so that it holds exactly the desired items. Duplicates
+// in desired are ignored.
+func DiffTeamsListItems(listType string, current []TeamsListItem, desired []string) TeamsListDiff {
+	existing := make(map[string]string, len(current))
+	for _, item := range current {
+		existing[normalizeTeamsListItem(listType, item.Value)] = item.Value
+	}
+
+	var diff TeamsListDiff
+	wanted := make(map[string]bool, len(desired))
+	for _, value := range desired {
+		key := normalizeTeamsListItem(listType, value)
+		if wanted[key] {
+			continue
+		}
+		wanted[key] = true
+
+		if _, ok := existing[key]; ok {
+			diff.Unchanged++
+		} else {
+			diff.Append = append(diff.Append, strings.TrimSpace(value))
+		}
+	}
+
+	for key, value := range existing {
+		if !wanted[key] {
+			diff.Remove = append(diff.Remove, value)
+		}
+	}
+	sort.Strings(diff.Remove)
+
+	return diff
+}
+
+// SyncTeamsList makes a Teams list hold exactly the desired items, patching
+// only the items that differ. Every desired item is validated against the
+// list type before any change is made. Large changes are split into
+// several patch requests of at most ChunkSize items.
+func (api *API) SyncTeamsList(ctx context.Context, accountID, listID string, desired []string, opts TeamsListSyncOptions) (TeamsListDiff, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultTeamsListSyncChunkSize
+	}
+
+	list, err := api.TeamsList(ctx, accountID, listID)
+	if err != nil {
+		return TeamsListDiff{}, err
+	}
+
+	var invalid []string
+	for _, value := range desired {
+		if err := ValidateTeamsListItem(list.Type, strings.TrimSpace(value)); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q: %s", value, err))
+		}
+	}
+	if len(invalid) > 0 {
+		return TeamsListDiff{}, errors.Errorf("invalid items for %s list %q: %s", list.Type, list.Name, strings.Join(invalid, "; "))
+	}
+
+	var current []TeamsListItem
+	for page := 1; ; page++ {
+		items, info, err := api.teamsListItems(ctx, accountID, listID, PaginationOptions{Page: page, PerPage: 1000})
+		if err != nil {
+			return TeamsListDiff{}, err
+		}
+		current = append(current, items...)
+		if info.Page >= info.TotalPages {
+			break
+		}
+	}
+
+	diff := DiffTeamsListItems(list.Type, current, desired)
+	if opts.DryRun {
+		return diff, nil
+	}
+
+	for i := 0; i < len(diff.Append) || i < len(diff.Remove); i += chunkSize {
+		patch := PatchTeamsList{ID: listID, Append: []TeamsListItem{}, Remove: []string{}}
+		for _, value := range chunkStrings(diff.Append, i, chunkSize) {
+			patch.Append = append(patch.Append, TeamsListItem{Value: value})
+		}
+		patch.Remove = append(patch.Remove, chunkStrings(diff.Remove, i, chunkSize)...)
+
+		if _, err := api.PatchTeamsList(ctx, accountID, patch); err != nil {
+			return diff, errors.Wrapf(err, "failed to patch list %q", list.Name)
+		}
+	}
+
+	return diff, nil
+}
+
+// chunkStrings returns up to size values starting at offset.
+func chunkStrings(values []string, offset, size int) []string {
+	if offset >= len(values) {
+		return nil
+	}
+	end := offset + size
+	if end > len(values) {
+		end = len(values)
+	}
+	return values[offset:end]
+}
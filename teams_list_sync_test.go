@@ -0,0 +1,167 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTeamsListItem(t *testing.T) {
+	valid := map[string][]string{
+		TeamsListTypeDomain: {"example.com", "sub.example.co.uk", "xn--bcher-kva.example"},
+		TeamsListTypeEmail:  {"user@example.com"},
+		TeamsListTypeIP:     {"192.0.2.1", "2001:db8::/32", "198.51.100.0/24"},
+		TeamsListTypeSerial: {"C02XK1ABCDEF"},
+		TeamsListTypeURL:    {"example.com/path", "https://example.com/login?next=/"},
+	}
+	for listType, values := range valid {
+		for _, v := range values {
+			assert.NoError(t, ValidateTeamsListItem(listType, v), "%s %s", listType, v)
+		}
+	}
+
+	invalid := map[string][]string{
+		TeamsListTypeDomain: {"localhost", "192.0.2.1", "-bad.example.com", "exa mple.com", "a..b"},
+		TeamsListTypeEmail:  {"not-an-email", "User <user@example.com>"},
+		TeamsListTypeIP:     {"192.0.2.256", "example.com"},
+		TeamsListTypeSerial: {"C02 XK1"},
+		TeamsListTypeURL:    {"https://", "http://bad host/"},
+		"HOSTNAME":          {"example.com"},
+	}
+	for listType, values := range invalid {
+		for _, v := range values {
+			assert.Error(t, ValidateTeamsListItem(listType, v), "%s %s", listType, v)
+		}
+	}
+}
+
+func TestDiffTeamsListItems(t *testing.T) {
+	current := []TeamsListItem{{Value: "Example.com"}, {Value: "old.example.com"}, {Value: "keep.example.com"}}
+	diff := DiffTeamsListItems(TeamsListTypeDomain, current, []string{"example.com.", "keep.example.com", "new.example.com", "new.example.com"})
+
+	assert.Equal(t, TeamsListDiff{
+		Append:    []string{"new.example.com"},
+		Remove:    []string{"old.example.com"},
+		Unchanged: 2,
+	}, diff)
+	assert.False(t, diff.Empty())
+	assert.True(t, DiffTeamsListItems(TeamsListTypeIP, []TeamsListItem{{Value: "192.0.2.1"}}, []string{"192.0.2.1"}).Empty())
+}
+
+func TestReadTeamsListItems(t *testing.T) {
+	items, err := ReadTeamsListItems(strings.NewReader("# threat feed\n\nbad.example.com\n  worse.example.com  \n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"bad.example.com", "worse.example.com"}, items)
+	}
+}
+
+func TestSyncTeamsList(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var mu sync.Mutex
+	items := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		items[fmt.Sprintf("old-%d.example.com", i)] = true
+	}
+	items["keep.example.com"] = true
+	var patches []PatchTeamsList
+
+	mux.HandleFunc("/accounts/"+testAccountID+"/gateway/lists/blocked", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			writeFakeResult(t, w, TeamsList{ID: "blocked", Name: "Blocked domains", Type: "DOMAIN"})
+		case http.MethodPatch:
+			var patch PatchTeamsList
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			patches = append(patches, patch)
+			for _, item := range patch.Append {
+				items[item.Value] = true
+			}
+			for _, value := range patch.Remove {
+				delete(items, value)
+			}
+			writeFakeResult(t, w, TeamsList{ID: "blocked"})
+		default:
+			t.Errorf("unexpected method %s", r.Method)
+		}
+	})
+
+	// Items are served two per page to exercise pagination.
+	mux.HandleFunc("/accounts/"+testAccountID+"/gateway/lists/blocked/items", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		mu.Lock()
+		defer mu.Unlock()
+		var values []string
+		for v := range items {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		totalPages := (len(values) + 1) / 2
+		var result []TeamsListItem
+		for _, v := range chunkStrings(values, (page-1)*2, 2) {
+			result = append(result, TeamsListItem{Value: v})
+		}
+		b, _ := json.Marshal(result)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s, "result_info": {"page": %d, "total_pages": %d}}`, b, page, totalPages)
+	})
+
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# blocked domains\nkeep.example.com\nnew-1.example.com\nnew-2.example.com\nnew-3.example.com\n")
+	}))
+	defer feed.Close()
+
+	resp, err := http.Get(feed.URL)
+	require.NoError(t, err)
+	desired, err := ReadTeamsListItems(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	diff, err := client.SyncTeamsList(context.Background(), testAccountID, "blocked", desired, TeamsListSyncOptions{DryRun: true})
+	if assert.NoError(t, err) {
+		assert.Len(t, diff.Append, 3)
+		assert.Len(t, diff.Remove, 5)
+		assert.Equal(t, 1, diff.Unchanged)
+	}
+	assert.Empty(t, patches)
+
+	diff, err = client.SyncTeamsList(context.Background(), testAccountID, "blocked", desired, TeamsListSyncOptions{ChunkSize: 2})
+	if assert.NoError(t, err) {
+		assert.Len(t, diff.Append, 3)
+	}
+	assert.Len(t, patches, 3)
+	for _, p := range patches {
+		assert.LessOrEqual(t, len(p.Append), 2)
+		assert.LessOrEqual(t, len(p.Remove), 2)
+	}
+	assert.Equal(t, map[string]bool{
+		"keep.example.com":  true,
+		"new-1.example.com": true,
+		"new-2.example.com": true,
+		"new-3.example.com": true,
+	}, items)
+
+	diff, err = client.SyncTeamsList(context.Background(), testAccountID, "blocked", desired, TeamsListSyncOptions{})
+	if assert.NoError(t, err) {
+		assert.True(t, diff.Empty())
+	}
+	assert.Len(t, patches, 3)
+
+	_, err = client.SyncTeamsList(context.Background(), testAccountID, "blocked", []string{"192.0.2.1", "ok.example.com"}, TeamsListSyncOptions{})
+	assert.EqualError(t, err, `invalid items for DOMAIN list "Blocked domains": "192.0.2.1": IP addresses are not domains`)
+}
@@ -0,0 +1,383 @@
+package cloudflare
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TeamsField is a field that can be used in the traffic, identity or device
+// posture expression of a Teams rule.
+type TeamsField struct {
+	// Name is the name of the field in expressions, such as dns.fqdn.
+	Name string
+	// Array reports whether the field holds a list of values, which are
+	// compared with any(field[*] ...).
+	Array bool
+	// String reports whether values are quoted strings rather than numbers
+	// or IPs.
+	String bool
+	// IP reports whether values are IP addresses or CIDR ranges. Fields
+	// which are neither strings nor IPs take integers.
+	IP bool
+	// Filters are the filter types the field can be used with in traffic
+	// expressions. Identity and device posture fields have none.
+	Filters []TeamsFilterType
+	// ListType is the type of Teams list the field can be compared with,
+	// empty if lists are not supported.
+	ListType string
+}
+
+// Fields of Teams rule expressions.
+var (
+	TeamsFieldDNSDomains          = TeamsField{Name: "dns.domains", Array: true, String: true, Filters: []TeamsFilterType{DnsFilter}, ListType: "DOMAIN"}
+	TeamsFieldDNSFQDN             = TeamsField{Name: "dns.fqdn", String: true, Filters: []TeamsFilterType{DnsFilter}, ListType: "DOMAIN"}
+	TeamsFieldDNSContentCategory  = TeamsField{Name: "dns.content_category", Array: true, Filters: []TeamsFilterType{DnsFilter}}
+	TeamsFieldDNSSecurityCategory = TeamsField{Name: "dns.security_category", Array: true, Filters: []TeamsFilterType{DnsFilter}}
+	TeamsFieldDNSSourceIP         = TeamsField{Name: "dns.src_ip", IP: true, Filters: []TeamsFilterType{DnsFilter}, ListType: "IP"}
+	TeamsFieldDNSLocation         = TeamsField{Name: "dns.location", String: true, Filters: []TeamsFilterType{DnsFilter}}
+
+	TeamsFieldHTTPHost             = TeamsField{Name: "http.request.host", String: true, Filters: []TeamsFilterType{HttpFilter}, ListType: "DOMAIN"}
+	TeamsFieldHTTPURI              = TeamsField{Name: "http.request.uri", String: true, Filters: []TeamsFilterType{HttpFilter}, ListType: "URL"}
+	TeamsFieldHTTPContentCategory  = TeamsField{Name: "http.request.uri.content_category", Array: true, Filters: []TeamsFilterType{HttpFilter}}
+	TeamsFieldHTTPSecurityCategory = TeamsField{Name: "http.request.uri.security_category", Array: true, Filters: []TeamsFilterType{HttpFilter}}
+
+	TeamsFieldL4DestinationIP   = TeamsField{Name: "net.dst.ip", IP: true, Filters: []TeamsFilterType{L4Filter}, ListType: "IP"}
+	TeamsFieldL4DestinationPort = TeamsField{Name: "net.dst.port", Filters: []TeamsFilterType{L4Filter}}
+	TeamsFieldL4Protocol        = TeamsField{Name: "net.protocol", String: true, Filters: []TeamsFilterType{L4Filter}}
+	TeamsFieldL4SNI             = TeamsField{Name: "net.sni.host", String: true, Filters: []TeamsFilterType{L4Filter}, ListType: "DOMAIN"}
+
+	TeamsFieldIdentityEmail      = TeamsField{Name: "identity.email", String: true, ListType: "EMAIL"}
+	TeamsFieldIdentityGroupNames = TeamsField{Name: "identity.groups.name", Array: true, String: true}
+
+	TeamsFieldDevicePosturePassed = TeamsField{Name: "device_posture.checks.passed", Array: true, String: true}
+	TeamsFieldDeviceSerialNumber  = TeamsField{Name: "device_posture.serial_number", String: true, ListType: "SERIAL"}
+)
+
+// TeamsCondition is a condition in a Teams rule expression, created from a
+// TeamsField or by combining conditions with TeamsAnyOf.
+type TeamsCondition struct {
+	field    TeamsField
+	operator string
+	values   []string
+	list     string
+	anyOf    []TeamsCondition
+}
+
+// Equals matches when the field, or any of its values, equals value.
+func (f TeamsField) Equals(value string) TeamsCondition {
+	return TeamsCondition{field: f, operator: "==", values: []string{value}}
+}
+
+// In matches when the field, or any of its values, is one of values.
+func (f TeamsField) In(values ...string) TeamsCondition {
+	return TeamsCondition{field: f, operator: "in", values: values}
+}
+
+// Matches matches when the field, or any of its values, matches a regular
+// expression.
+func (f TeamsField) Matches(regex string) TeamsCondition {
+	return TeamsCondition{field: f, operator: "matches", values: []string{regex}}
+}
+
+// InList matches when the field, or any of its values, is in the Teams list
+// with the given name. Lists are resolved by TeamsRuleBuilder.Build.
+func (f TeamsField) InList(name string) TeamsCondition {
+	return TeamsCondition{field: f, operator: "in", list: name}
+}
+
+// TeamsAnyOf matches when any of the conditions match.
+func TeamsAnyOf(conditions ...TeamsCondition) TeamsCondition {
+	return TeamsCondition{anyOf: conditions}
+}
+
+// TeamsRuleBuilder builds a Teams rule from typed conditions, validating
+// that the action, settings and fields suit the rule's filter type.
+type TeamsRuleBuilder struct {
+	rule          TeamsRule
+	filter        TeamsFilterType
+	traffic       []TeamsCondition
+	identity      []TeamsCondition
+	devicePosture []TeamsCondition
+	lists         map[string]TeamsList
+}
+
+// NewTeamsRuleBuilder starts a rule for a single filter type.
+func NewTeamsRuleBuilder(name string, filter TeamsFilterType, action TeamsGatewayAction) *TeamsRuleBuilder {
+	return &TeamsRuleBuilder{
+		rule: TeamsRule{
+			Name:    name,
+			Action:  action,
+			Filters: []TeamsFilterType{filter},
+			Enabled: true,
+		},
+		filter: filter,
+		lists:  map[string]TeamsList{},
+	}
+}
+
+// Description sets the description of the rule.
+func (b *TeamsRuleBuilder) Description(description string) *TeamsRuleBuilder {
+	b.rule.Description = description
+	return b
+}
+
+// Precedence sets the precedence of the rule.
+func (b *TeamsRuleBuilder) Precedence(precedence uint64) *TeamsRuleBuilder {
+	b.rule.Precedence = precedence
+	return b
+}
+
+// Enabled sets whether the rule is enabled, which it is by default.
+func (b *TeamsRuleBuilder) Enabled(enabled bool) *TeamsRuleBuilder {
+	b.rule.Enabled = enabled
+	return b
+}
+
+// Settings sets the rule settings.
+func (b *TeamsRuleBuilder) Settings(settings TeamsRuleSettings) *TeamsRuleBuilder {
+	b.rule.RuleSettings = settings
+	return b
+}
+
+// Lists makes Teams lists available to InList conditions by name.
+func (b *TeamsRuleBuilder) Lists(lists ...TeamsList) *TeamsRuleBuilder {
+	for _, l := range lists {
+		b.lists[l.Name] = l
+	}
+	return b
+}
+
+// Traffic adds conditions on the traffic, all of which must match.
+func (b *TeamsRuleBuilder) Traffic(conditions ...TeamsCondition) *TeamsRuleBuilder {
+	b.traffic = append(b.traffic, conditions...)
+	return b
+}
+
+// Identity adds conditions on the user identity, all of which must match.
+func (b *TeamsRuleBuilder) Identity(conditions ...TeamsCondition) *TeamsRuleBuilder {
+	b.identity = append(b.identity, conditions...)
+	return b
+}
+
+// DevicePosture adds conditions on the device posture, all of which must
+// match.
+func (b *TeamsRuleBuilder) DevicePosture(conditions ...TeamsCondition) *TeamsRuleBuilder {
+	b.devicePosture = append(b.devicePosture, conditions...)
+	return b
+}
+
+// teamsFilterActions are the actions each filter type supports.
+var teamsFilterActions = map[TeamsFilterType][]TeamsGatewayAction{
+	DnsFilter:  {Allow, Block, SafeSearch, YTRestricted, Override},
+	HttpFilter: {Allow, Block, On, Off, Scan, NoScan, Isolate, NoIsolate},
+	L4Filter:   {Allow, Block, L4Override},
+}
+
+// Build renders the expressions and returns the rule, or an error listing
+// every problem found.
+func (b *TeamsRuleBuilder) Build() (TeamsRule, error) {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	rule := b.rule
+
+	actions, ok := teamsFilterActions[b.filter]
+	if !ok {
+		problem("unknown filter type %q", b.filter)
+	} else if !teamsActionIn(rule.Action, actions) {
+		problem("action %q is not supported by %s rules", rule.Action, b.filter)
+	}
+
+	for _, p := range validateTeamsRuleSettings(b.filter, rule.Action, rule.RuleSettings) {
+		problem("%s", p)
+	}
+
+	if len(b.devicePosture) > 0 && b.filter == DnsFilter {
+		problem("device posture conditions are not supported by dns rules")
+	}
+
+	render := func(kind string, conditions []TeamsCondition) string {
+		var parts []string
+		for _, c := range conditions {
+			expr, errs := b.render(kind, c)
+			for _, err := range errs {
+				problem("%s", err)
+			}
+			parts = append(parts, expr)
+		}
+		return strings.Join(parts, " and ")
+	}
+
+	rule.Traffic = render("traffic", b.traffic)
+	rule.Identity = render("identity", b.identity)
+	rule.DevicePosture = render("device posture", b.devicePosture)
+
+	if len(b.traffic)+len(b.identity)+len(b.devicePosture) == 0 {
+		problem("at least one condition is required")
+	}
+
+	if len(problems) > 0 {
+		return TeamsRule{}, errors.Errorf("invalid teams rule %q: %s", rule.Name, strings.Join(problems, "; "))
+	}
+
+	return rule, nil
+}
+
+// render renders a condition of the given kind of expression.
+func (b *TeamsRuleBuilder) render(kind string, c TeamsCondition) (string, []string) {
+	if c.anyOf != nil {
+		var parts, problems []string
+		for _, sub := range c.anyOf {
+			expr, errs := b.render(kind, sub)
+			parts = append(parts, expr)
+			problems = append(problems, errs...)
+		}
+		if len(parts) == 1 {
+			return parts[0], problems
+		}
+		return "(" + strings.Join(parts, " or ") + ")", problems
+	}
+
+	f := c.field
+	if f.Name == "" || c.operator == "" {
+		return "", []string{"empty condition"}
+	}
+
+	var problems []string
+	switch kind {
+	case "traffic":
+		if len(f.Filters) == 0 || !teamsFilterIn(b.filter, f.Filters) {
+			problems = append(problems, fmt.Sprintf("%s cannot be used in the traffic expression of %s rules", f.Name, b.filter))
+		}
+	case "identity":
+		if !strings.HasPrefix(f.Name, "identity.") {
+			problems = append(problems, fmt.Sprintf("%s cannot be used in the identity expression", f.Name))
+		}
+	case "device posture":
+		if !strings.HasPrefix(f.Name, "device_posture.") {
+			problems = append(problems, fmt.Sprintf("%s cannot be used in the device posture expression", f.Name))
+		}
+	}
+
+	var value string
+	switch {
+	case c.list != "":
+		l, ok := b.lists[c.list]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("unknown list %q", c.list))
+		case f.ListType == "":
+			problems = append(problems, fmt.Sprintf("%s cannot be compared with a list", f.Name))
+		case l.Type != f.ListType:
+			problems = append(problems, fmt.Sprintf("list %q of type %s cannot be used with %s, which needs a %s list", c.list, l.Type, f.Name, f.ListType))
+		}
+		value = "$" + l.ID
+	case c.operator == "in":
+		if len(c.values) == 0 {
+			problems = append(problems, fmt.Sprintf("%s in requires at least one value", f.Name))
+		}
+		values := make([]string, 0, len(c.values))
+		for _, v := range c.values {
+			v, err := teamsExpressionValue(f, v)
+			if err != nil {
+				problems = append(problems, err.Error())
+			}
+			values = append(values, v)
+		}
+		value = "{" + strings.Join(values, " ") + "}"
+	case c.operator == "matches":
+		value = strconv.Quote(c.values[0])
+	default:
+		var err error
+		if value, err = teamsExpressionValue(f, c.values[0]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if f.Array {
+		return fmt.Sprintf("any(%s[*] %s %s)", f.Name, c.operator, value), problems
+	}
+	return fmt.Sprintf("%s %s %s", f.Name, c.operator, value), problems
+}
+
+// teamsExpressionValue renders a value of a field. Values of fields which
+// are not strings are inserted unquoted, so they must parse as the field's
+// type to keep them from changing the rest of the expression.
+func teamsExpressionValue(f TeamsField, value string) (string, error) {
+	switch {
+	case f.String:
+		return strconv.Quote(value), nil
+	case f.IP:
+		if net.ParseIP(value) == nil {
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return "", errors.Errorf("%s requires an IP address or CIDR range, got %q", f.Name, value)
+			}
+		}
+	default:
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return "", errors.Errorf("%s requires an integer, got %q", f.Name, value)
+		}
+	}
+	return value, nil
+}
+
+// validateTeamsRuleSettings returns the problems with the settings of a rule
+// with the given filter type and action.
+func validateTeamsRuleSettings(filter TeamsFilterType, action TeamsGatewayAction, s TeamsRuleSettings) []string {
+	var problems []string
+	requireAction := func(setting string, set bool, filters []TeamsFilterType, actions ...TeamsGatewayAction) {
+		if set && (!teamsActionIn(action, actions) || !teamsFilterIn(filter, filters)) {
+			problems = append(problems, fmt.Sprintf("%s is not supported by %s rules with action %s", setting, filter, action))
+		}
+	}
+
+	all := []TeamsFilterType{DnsFilter, HttpFilter, L4Filter}
+	requireAction("override_ips", len(s.OverrideIPs) > 0, []TeamsFilterType{DnsFilter}, Override)
+	requireAction("override_host", s.OverrideHost != "", []TeamsFilterType{DnsFilter}, Override)
+	requireAction("block_reason", s.BlockReason != "", all, Block)
+	requireAction("block_page_enabled", s.BlockPageEnabled, all, Block)
+	requireAction("biso_admin_controls", s.BISOAdminControls != nil, []TeamsFilterType{HttpFilter}, Isolate)
+	requireAction("l4override", s.L4Override != nil, []TeamsFilterType{L4Filter}, L4Override)
+	requireAction("add_headers", len(s.AddHeaders) > 0, []TeamsFilterType{HttpFilter}, Allow)
+	requireAction("check_session", s.CheckSession != nil, []TeamsFilterType{HttpFilter, L4Filter}, Allow)
+	requireAction("insecure_disable_dnssec_validation", s.InsecureDisableDNSSECValidation, []TeamsFilterType{DnsFilter}, Allow)
+
+	if action == Override {
+		switch {
+		case len(s.OverrideIPs) > 0 && s.OverrideHost != "":
+			problems = append(problems, "override_ips and override_host cannot both be set")
+		case len(s.OverrideIPs) == 0 && s.OverrideHost == "":
+			problems = append(problems, "override rules require override_ips or override_host")
+		}
+	}
+
+	if action == L4Override && (s.L4Override == nil || (s.L4Override.IP == "" && s.L4Override.Port == 0)) {
+		problems = append(problems, "l4_override rules require l4override settings")
+	}
+
+	return problems
+}
+
+func teamsActionIn(action TeamsGatewayAction, actions []TeamsGatewayAction) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func teamsFilterIn(filter TeamsFilterType, filters []TeamsFilterType) bool {
+	for _, f := range filters {
+		if f == filter {
+			return true
+		}
+	}
+	return false
+}
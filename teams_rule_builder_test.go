@@ -0,0 +1,130 @@
+package cloudflare
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTeamsLists = []TeamsList{
+	{ID: "2b7ae2d4-0e32-4f64-9cde-9a7e6e2dfe32", Name: "Blocked domains", Type: "DOMAIN"},
+	{ID: "a2a4f3ab-4ed1-4f6e-8b3a-f2aa4ab9e5d4", Name: "Contractors", Type: "EMAIL"},
+	{ID: "5e58e3a0-13a6-46ac-bc6f-07bd14d9d3d0", Name: "Office IPs", Type: "IP"},
+}
+
+func TestTeamsRuleBuilder_DNS(t *testing.T) {
+	rule, err := NewTeamsRuleBuilder("Block malware", DnsFilter, Block).
+		Description("Block known bad domains").
+		Precedence(1000).
+		Lists(testTeamsLists...).
+		Traffic(
+			TeamsAnyOf(
+				TeamsFieldDNSDomains.InList("Blocked domains"),
+				TeamsFieldDNSSecurityCategory.In("68", "178"),
+			),
+			TeamsFieldDNSSourceIP.In("192.0.2.0/24"),
+		).
+		Identity(TeamsFieldIdentityEmail.InList("Contractors")).
+		Settings(TeamsRuleSettings{BlockPageEnabled: true, BlockReason: "malware"}).
+		Build()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, TeamsRule{
+			Name:        "Block malware",
+			Description: "Block known bad domains",
+			Precedence:  1000,
+			Enabled:     true,
+			Action:      Block,
+			Filters:     []TeamsFilterType{DnsFilter},
+			Traffic:     `(any(dns.domains[*] in $2b7ae2d4-0e32-4f64-9cde-9a7e6e2dfe32) or any(dns.security_category[*] in {68 178})) and dns.src_ip in {192.0.2.0/24}`,
+			Identity:    `identity.email in $a2a4f3ab-4ed1-4f6e-8b3a-f2aa4ab9e5d4`,
+			RuleSettings: TeamsRuleSettings{
+				BlockPageEnabled: true,
+				BlockReason:      "malware",
+			},
+		}, rule)
+	}
+}
+
+func TestTeamsRuleBuilder_HTTP(t *testing.T) {
+	rule, err := NewTeamsRuleBuilder("Allow engineering", HttpFilter, Allow).
+		Traffic(TeamsFieldHTTPHost.Equals("intranet.example.com"), TeamsFieldHTTPURI.Matches(`/api/v\d+/`)).
+		Identity(TeamsFieldIdentityGroupNames.In("Engineering")).
+		DevicePosture(TeamsFieldDevicePosturePassed.Equals("f174e90a-fafe-4643-bbbc-4a0ed4fc8415")).
+		Settings(TeamsRuleSettings{AddHeaders: http.Header{"X-Team": {"engineering"}}}).
+		Build()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, `http.request.host == "intranet.example.com" and http.request.uri matches "/api/v\\d+/"`, rule.Traffic)
+		assert.Equal(t, `any(identity.groups.name[*] in {"Engineering"})`, rule.Identity)
+		assert.Equal(t, `any(device_posture.checks.passed[*] == "f174e90a-fafe-4643-bbbc-4a0ed4fc8415")`, rule.DevicePosture)
+	}
+}
+
+func TestTeamsRuleBuilder_L4(t *testing.T) {
+	rule, err := NewTeamsRuleBuilder("Redirect SSH", L4Filter, L4Override).
+		Traffic(TeamsFieldL4DestinationPort.Equals("22"), TeamsFieldL4Protocol.Equals("tcp")).
+		Settings(TeamsRuleSettings{L4Override: &TeamsL4OverrideSettings{IP: "192.0.2.22", Port: 2222}}).
+		Build()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, `net.dst.port == 22 and net.protocol == "tcp"`, rule.Traffic)
+	}
+
+	_, err = NewTeamsRuleBuilder("Redirect SSH", L4Filter, L4Override).
+		Traffic(TeamsFieldL4DestinationPort.Equals("22")).
+		Build()
+	assert.EqualError(t, err, `invalid teams rule "Redirect SSH": l4_override rules require l4override settings`)
+}
+
+func TestTeamsRuleBuilder_Invalid(t *testing.T) {
+	_, err := NewTeamsRuleBuilder("Broken", DnsFilter, Isolate).
+		Lists(testTeamsLists...).
+		Traffic(
+			TeamsFieldHTTPHost.Equals("example.com"),
+			TeamsFieldDNSDomains.InList("Office IPs"),
+			TeamsFieldDNSFQDN.InList("Missing"),
+			TeamsFieldDNSContentCategory.InList("Blocked domains"),
+		).
+		Identity(TeamsFieldDNSFQDN.Equals("example.com")).
+		DevicePosture(TeamsFieldDevicePosturePassed.Equals("f174e90a-fafe-4643-bbbc-4a0ed4fc8415")).
+		Settings(TeamsRuleSettings{
+			OverrideHost:      "example.net",
+			BISOAdminControls: &TeamsBISOAdminControlSettings{DisablePrinting: true},
+		}).
+		Build()
+
+	assert.EqualError(t, err, `invalid teams rule "Broken": `+
+		`action "isolate" is not supported by dns rules; `+
+		`override_host is not supported by dns rules with action isolate; `+
+		`biso_admin_controls is not supported by dns rules with action isolate; `+
+		`device posture conditions are not supported by dns rules; `+
+		`http.request.host cannot be used in the traffic expression of dns rules; `+
+		`list "Office IPs" of type IP cannot be used with dns.domains, which needs a DOMAIN list; `+
+		`unknown list "Missing"; `+
+		`dns.content_category cannot be compared with a list; `+
+		`dns.fqdn cannot be used in the identity expression`)
+
+	_, err = NewTeamsRuleBuilder("Override", DnsFilter, Override).
+		Traffic(TeamsFieldDNSFQDN.Equals("example.com")).
+		Settings(TeamsRuleSettings{OverrideHost: "example.net", OverrideIPs: []string{"192.0.2.1"}}).
+		Build()
+	assert.EqualError(t, err, `invalid teams rule "Override": override_ips and override_host cannot both be set`)
+
+	_, err = NewTeamsRuleBuilder("Empty", HttpFilter, Block).Build()
+	assert.EqualError(t, err, `invalid teams rule "Empty": at least one condition is required`)
+
+	_, err = NewTeamsRuleBuilder("Zero", HttpFilter, Block).Traffic(TeamsCondition{}).Build()
+	assert.EqualError(t, err, `invalid teams rule "Zero": empty condition`)
+
+	_, err = NewTeamsRuleBuilder("Injected", L4Filter, Block).
+		Traffic(
+			TeamsFieldL4DestinationIP.Equals("1.2.3.4} or true or {"),
+			TeamsFieldL4DestinationPort.In("443", "80 or true"),
+		).
+		Build()
+	assert.EqualError(t, err, `invalid teams rule "Injected": `+
+		`net.dst.ip requires an IP address or CIDR range, got "1.2.3.4} or true or {"; `+
+		`net.dst.port requires an integer, got "80 or true"`)
+}
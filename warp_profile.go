@@ -0,0 +1,352 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Split tunnel modes used by ListSplitTunnels and UpdateSplitTunnel.
+const (
+	SplitTunnelModeInclude = "include"
+	SplitTunnelModeExclude = "exclude"
+)
+
+// WARPProfile is the WARP client configuration of an account: device
+// settings, split tunnels and local domain fallback. It can be kept in
+// version control as JSON and applied with ApplyWARPProfile. A nil section
+// is left unchanged when the profile is applied; an empty list clears it.
+type WARPProfile struct {
+	Settings           *TeamsDeviceSettings           `json:"settings,omitempty"`
+	Include            []SplitTunnel                  `json:"include"`
+	Exclude            []SplitTunnel                  `json:"exclude"`
+	FallbackDomains    []FallbackDomain               `json:"fallback_domains"`
+	ClientCertificates *WARPProfileClientCertificates `json:"client_certificates,omitempty"`
+}
+
+// WARPProfileClientCertificates is the client certificate provisioning
+// setting of the zone used for device certificates.
+type WARPProfileClientCertificates struct {
+	ZoneID  string `json:"zone_id"`
+	Enabled bool   `json:"enabled"`
+}
+
+// WARPProfileDiff lists the parts of a profile which differ.
+type WARPProfileDiff struct {
+	Settings           bool
+	Include            bool
+	Exclude            bool
+	FallbackDomains    bool
+	ClientCertificates bool
+}
+
+// Empty reports whether the profiles are the same.
+func (d WARPProfileDiff) Empty() bool {
+	return d == WARPProfileDiff{}
+}
+
+// String lists the parts which differ.
+func (d WARPProfileDiff) String() string {
+	var parts []string
+	if d.Settings {
+		parts = append(parts, "settings")
+	}
+	if d.Include {
+		parts = append(parts, "include")
+	}
+	if d.Exclude {
+		parts = append(parts, "exclude")
+	}
+	if d.FallbackDomains {
+		parts = append(parts, "fallback_domains")
+	}
+	if d.ClientCertificates {
+		parts = append(parts, "client_certificates")
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Validate checks split tunnel entries and fallback domains for mistakes:
+// malformed addresses, entries present more than once, addresses or hosts
+// that are both included and excluded, and duplicate fallback suffixes.
+func (p WARPProfile) Validate() error {
+	var problems []string
+
+	include, errs := warpProfileTunnels(SplitTunnelModeInclude, p.Include)
+	problems = append(problems, errs...)
+	exclude, errs := warpProfileTunnels(SplitTunnelModeExclude, p.Exclude)
+	problems = append(problems, errs...)
+
+	for _, in := range include {
+		for _, ex := range exclude {
+			switch {
+			case in.host != "" && in.host == ex.host:
+				problems = append(problems, fmt.Sprintf("host %s is both included and excluded", in.host))
+			case in.network != nil && ex.network != nil && (in.network.Contains(ex.network.IP) || ex.network.Contains(in.network.IP)):
+				problems = append(problems, fmt.Sprintf("included %s overlaps excluded %s", in.network, ex.network))
+			}
+		}
+	}
+
+	suffixes := make(map[string]bool, len(p.FallbackDomains))
+	for _, domain := range p.FallbackDomains {
+		suffix := strings.ToLower(strings.Trim(domain.Suffix, "."))
+		if suffix == "" {
+			problems = append(problems, "fallback domain without a suffix")
+			continue
+		}
+		if suffixes[suffix] {
+			problems = append(problems, fmt.Sprintf("duplicate fallback domain %s", suffix))
+		}
+		suffixes[suffix] = true
+
+		for _, server := range domain.DNSServer {
+			if net.ParseIP(server) == nil {
+				problems = append(problems, fmt.Sprintf("fallback domain %s has invalid DNS server %q", suffix, server))
+			}
+		}
+	}
+
+	if p.ClientCertificates != nil && p.ClientCertificates.ZoneID == "" {
+		problems = append(problems, "client_certificates requires a zone_id")
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid WARP profile: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// warpProfileTunnel is a parsed split tunnel entry.
+type warpProfileTunnel struct {
+	host    string
+	network *net.IPNet
+}
+
+// warpProfileTunnels parses the split tunnel entries of one mode, reporting
+// malformed and duplicate entries.
+func warpProfileTunnels(mode string, tunnels []SplitTunnel) ([]warpProfileTunnel, []string) {
+	var parsed []warpProfileTunnel
+	var problems []string
+	seen := make(map[string]bool, len(tunnels))
+
+	for _, tunnel := range tunnels {
+		switch {
+		case tunnel.Address != "" && tunnel.Host != "":
+			problems = append(problems, fmt.Sprintf("%s entry %s sets both address and host", mode, tunnel.Address))
+			continue
+		case tunnel.Host != "":
+			host := strings.ToLower(strings.TrimSuffix(tunnel.Host, "."))
+			if seen[host] {
+				problems = append(problems, fmt.Sprintf("duplicate %s host %s", mode, host))
+				continue
+			}
+			seen[host] = true
+			parsed = append(parsed, warpProfileTunnel{host: host})
+		case tunnel.Address != "":
+			network, err := parseWARPProfileAddress(tunnel.Address)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s address %q is not an IP address or CIDR", mode, tunnel.Address))
+				continue
+			}
+			if seen[network.String()] {
+				problems = append(problems, fmt.Sprintf("duplicate %s address %s", mode, network))
+				continue
+			}
+			seen[network.String()] = true
+			parsed = append(parsed, warpProfileTunnel{network: network})
+		default:
+			problems = append(problems, fmt.Sprintf("%s entry without an address or host", mode))
+		}
+	}
+
+	return parsed, problems
+}
+
+// parseWARPProfileAddress parses a split tunnel address, treating a bare IP
+// address as a single host network.
+func parseWARPProfileAddress(address string) (*net.IPNet, error) {
+	if !strings.Contains(address, "/") {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.New("invalid IP address")
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(address)
+	return network, err
+}
+
+// Diff compares the profile with a desired profile. Sections which are nil
+// in the desired profile never differ, and the order of split tunnel entries
+// and fallback domains is ignored.
+func (p WARPProfile) Diff(desired WARPProfile) WARPProfileDiff {
+	return WARPProfileDiff{
+		Settings:           desired.Settings != nil && (p.Settings == nil || *p.Settings != *desired.Settings),
+		Include:            desired.Include != nil && !reflect.DeepEqual(sortedSplitTunnels(p.Include), sortedSplitTunnels(desired.Include)),
+		Exclude:            desired.Exclude != nil && !reflect.DeepEqual(sortedSplitTunnels(p.Exclude), sortedSplitTunnels(desired.Exclude)),
+		FallbackDomains:    desired.FallbackDomains != nil && !reflect.DeepEqual(sortedFallbackDomains(p.FallbackDomains), sortedFallbackDomains(desired.FallbackDomains)),
+		ClientCertificates: desired.ClientCertificates != nil && (p.ClientCertificates == nil || *p.ClientCertificates != *desired.ClientCertificates),
+	}
+}
+
+// merge returns the profile with the nil sections of desired replaced by
+// those of p.
+func (p WARPProfile) merge(desired WARPProfile) WARPProfile {
+	if desired.Settings == nil {
+		desired.Settings = p.Settings
+	}
+	if desired.Include == nil {
+		desired.Include = p.Include
+	}
+	if desired.Exclude == nil {
+		desired.Exclude = p.Exclude
+	}
+	if desired.FallbackDomains == nil {
+		desired.FallbackDomains = p.FallbackDomains
+	}
+	if desired.ClientCertificates == nil {
+		desired.ClientCertificates = p.ClientCertificates
+	}
+	return desired
+}
+
+func sortedSplitTunnels(tunnels []SplitTunnel) []SplitTunnel {
+	sorted := append([]SplitTunnel{}, tunnels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Address != sorted[j].Address {
+			return sorted[i].Address < sorted[j].Address
+		}
+		return sorted[i].Host < sorted[j].Host
+	})
+	return sorted
+}
+
+func sortedFallbackDomains(domains []FallbackDomain) []FallbackDomain {
+	sorted := make([]FallbackDomain, 0, len(domains))
+	for _, domain := range domains {
+		domain.DNSServer = append([]string{}, domain.DNSServer...)
+		sort.Strings(domain.DNSServer)
+		sorted = append(sorted, domain)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Suffix < sorted[j].Suffix })
+	return sorted
+}
+
+// WARPProfile loads the WARP client configuration of an account. The client
+// certificate setting is only loaded when clientCertificatesZoneID is set.
+// Empty lists are returned as empty rather than nil slices so that applying
+// the profile keeps them empty.
+func (api *API) WARPProfile(ctx context.Context, accountID, clientCertificatesZoneID string) (WARPProfile, error) {
+	var profile WARPProfile
+
+	settings, err := api.TeamsAccountDeviceConfiguration(ctx, accountID)
+	if err != nil {
+		return WARPProfile{}, errors.Wrap(err, "failed to get device settings")
+	}
+	profile.Settings = &settings
+
+	if profile.Include, err = api.ListSplitTunnels(ctx, accountID, SplitTunnelModeInclude); err != nil {
+		return WARPProfile{}, errors.Wrap(err, "failed to get split tunnel include list")
+	}
+	if profile.Exclude, err = api.ListSplitTunnels(ctx, accountID, SplitTunnelModeExclude); err != nil {
+		return WARPProfile{}, errors.Wrap(err, "failed to get split tunnel exclude list")
+	}
+	if profile.FallbackDomains, err = api.ListFallbackDomains(ctx, accountID); err != nil {
+		return WARPProfile{}, errors.Wrap(err, "failed to get fallback domains")
+	}
+
+	if clientCertificatesZoneID != "" {
+		certificates, err := api.GetDeviceClientCertificatesZone(ctx, clientCertificatesZoneID)
+		if err != nil {
+			return WARPProfile{}, errors.Wrap(err, "failed to get client certificate setting")
+		}
+		profile.ClientCertificates = &WARPProfileClientCertificates{ZoneID: clientCertificatesZoneID, Enabled: certificates.Result.Enabled}
+	}
+
+	profile.Include = nonNilSplitTunnels(profile.Include)
+	profile.Exclude = nonNilSplitTunnels(profile.Exclude)
+	if profile.FallbackDomains == nil {
+		profile.FallbackDomains = []FallbackDomain{}
+	}
+
+	return profile, nil
+}
+
+// ApplyWARPProfile validates a desired profile, compares it with the
+// account's current configuration and updates the parts which differ. Nil
+// sections of the profile are left as they are, though split tunnel entries
+// are still checked against them. With dryRun set the differences are
+// returned without applying them.
+func (api *API) ApplyWARPProfile(ctx context.Context, accountID string, desired WARPProfile, dryRun bool) (WARPProfileDiff, error) {
+	if err := desired.Validate(); err != nil {
+		return WARPProfileDiff{}, err
+	}
+
+	var zoneID string
+	if desired.ClientCertificates != nil {
+		zoneID = desired.ClientCertificates.ZoneID
+	}
+	current, err := api.WARPProfile(ctx, accountID, zoneID)
+	if err != nil {
+		return WARPProfileDiff{}, err
+	}
+	if err := current.merge(desired).Validate(); err != nil {
+		return WARPProfileDiff{}, err
+	}
+
+	diff := current.Diff(desired)
+	if dryRun {
+		return diff, nil
+	}
+
+	if diff.Settings {
+		if _, err := api.TeamsAccountDeviceUpdateConfiguration(ctx, accountID, *desired.Settings); err != nil {
+			return diff, errors.Wrap(err, "failed to update device settings")
+		}
+	}
+	if diff.Include {
+		if _, err := api.UpdateSplitTunnel(ctx, accountID, SplitTunnelModeInclude, desired.Include); err != nil {
+			return diff, errors.Wrap(err, "failed to update split tunnel include list")
+		}
+	}
+	if diff.Exclude {
+		if _, err := api.UpdateSplitTunnel(ctx, accountID, SplitTunnelModeExclude, desired.Exclude); err != nil {
+			return diff, errors.Wrap(err, "failed to update split tunnel exclude list")
+		}
+	}
+	if diff.FallbackDomains {
+		if _, err := api.UpdateFallbackDomain(ctx, accountID, desired.FallbackDomains); err != nil {
+			return diff, errors.Wrap(err, "failed to update fallback domains")
+		}
+	}
+	if diff.ClientCertificates {
+		if _, err := api.UpdateDeviceClientCertificatesZone(ctx, zoneID, desired.ClientCertificates.Enabled); err != nil {
+			return diff, errors.Wrap(err, "failed to update client certificate setting")
+		}
+	}
+
+	return diff, nil
+}
+
+// nonNilSplitTunnels makes sure an empty list is kept as [] rather than
+// null.
+func nonNilSplitTunnels(tunnels []SplitTunnel) []SplitTunnel {
+	if tunnels == nil {
+		return []SplitTunnel{}
+	}
+	return tunnels
+}
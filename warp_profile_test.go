@@ -0,0 +1,144 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWARPProfile_Validate(t *testing.T) {
+	assert.NoError(t, WARPProfile{
+		Include:         []SplitTunnel{{Address: "10.0.0.0/8"}, {Host: "intranet.example.com"}},
+		Exclude:         []SplitTunnel{{Address: "192.168.0.0/16"}, {Address: "2001:db8::1"}},
+		FallbackDomains: []FallbackDomain{{Suffix: "corp.example.com", DNSServer: []string{"10.0.0.53"}}},
+	}.Validate())
+
+	err := WARPProfile{
+		Include: []SplitTunnel{{Address: "10.0.0.0/8"}, {Address: "10.0.0.0/8"}, {Host: "Intranet.example.com."}, {Address: "bogus"}},
+		Exclude: []SplitTunnel{{Address: "10.1.2.3"}, {Host: "intranet.example.com"}, {}},
+		FallbackDomains: []FallbackDomain{
+			{Suffix: "corp.example.com"},
+			{Suffix: "CORP.example.com.", DNSServer: []string{"dns.example.com"}},
+		},
+		ClientCertificates: &WARPProfileClientCertificates{Enabled: true},
+	}.Validate()
+	assert.EqualError(t, err, "invalid WARP profile: "+
+		"duplicate include address 10.0.0.0/8; "+
+		`include address "bogus" is not an IP address or CIDR; `+
+		"exclude entry without an address or host; "+
+		"included 10.0.0.0/8 overlaps excluded 10.1.2.3/32; "+
+		"host intranet.example.com is both included and excluded; "+
+		"duplicate fallback domain corp.example.com; "+
+		`fallback domain corp.example.com has invalid DNS server "dns.example.com"; `+
+		"client_certificates requires a zone_id")
+}
+
+func TestWARPProfile_Diff(t *testing.T) {
+	current := WARPProfile{
+		Include:         []SplitTunnel{{Address: "10.0.0.0/8"}, {Host: "example.com"}},
+		FallbackDomains: []FallbackDomain{{Suffix: "a.example.com", DNSServer: []string{"10.0.0.1", "10.0.0.2"}}},
+	}
+	desired := WARPProfile{
+		Include:         []SplitTunnel{{Host: "example.com"}, {Address: "10.0.0.0/8"}},
+		Exclude:         []SplitTunnel{},
+		FallbackDomains: []FallbackDomain{{Suffix: "a.example.com", DNSServer: []string{"10.0.0.2", "10.0.0.1"}}},
+	}
+	assert.True(t, current.Diff(desired).Empty())
+	assert.Equal(t, "no changes", current.Diff(desired).String())
+
+	// Nil sections are unchanged.
+	assert.True(t, current.Diff(WARPProfile{}).Empty())
+	assert.Equal(t, WARPProfileDiff{Include: true}, current.Diff(WARPProfile{Include: []SplitTunnel{}}))
+
+	desired.Settings = &TeamsDeviceSettings{GatewayProxyEnabled: true}
+	desired.Exclude = []SplitTunnel{{Address: "192.0.2.0/24"}}
+	desired.ClientCertificates = &WARPProfileClientCertificates{ZoneID: testZoneID, Enabled: true}
+	diff := current.Diff(desired)
+	assert.Equal(t, WARPProfileDiff{Settings: true, Exclude: true, ClientCertificates: true}, diff)
+	assert.Equal(t, "settings, exclude, client_certificates", diff.String())
+}
+
+func TestApplyWARPProfile(t *testing.T) {
+	setup()
+	defer teardown()
+
+	state := map[string]string{
+		"settings":         `{"gateway_proxy_enabled": false, "gateway_udp_proxy_enabled": false}`,
+		"include":          `[]`,
+		"exclude":          `[{"address": "192.168.0.0/16", "description": "Home"}]`,
+		"fallback_domains": `[{"suffix": "corp.example.com"}]`,
+	}
+	var updated []string
+	handle := func(key string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				var body json.RawMessage
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				state[key] = string(body)
+				updated = append(updated, key)
+			} else {
+				assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+			}
+			w.Header().Set("content-type", "application/json")
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": %s}`, state[key])
+		}
+	}
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices/settings", handle("settings"))
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices/policy/include", handle("include"))
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices/policy/exclude", handle("exclude"))
+	mux.HandleFunc("/accounts/"+testAccountID+"/devices/policy/fallback_domains", handle("fallback_domains"))
+
+	profile, err := client.WARPProfile(context.Background(), testAccountID, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, WARPProfile{
+			Settings:        &TeamsDeviceSettings{},
+			Include:         []SplitTunnel{},
+			Exclude:         []SplitTunnel{{Address: "192.168.0.0/16", Description: "Home"}},
+			FallbackDomains: []FallbackDomain{{Suffix: "corp.example.com"}},
+		}, profile)
+	}
+
+	desired := WARPProfile{
+		Settings:        &TeamsDeviceSettings{GatewayProxyEnabled: true},
+		Exclude:         []SplitTunnel{{Address: "192.168.0.0/16", Description: "Home"}, {Address: "203.0.113.0/24"}},
+		FallbackDomains: []FallbackDomain{{Suffix: "corp.example.com"}},
+	}
+
+	diff, err := client.ApplyWARPProfile(context.Background(), testAccountID, desired, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, WARPProfileDiff{Settings: true, Exclude: true}, diff)
+	}
+	assert.Empty(t, updated)
+
+	diff, err = client.ApplyWARPProfile(context.Background(), testAccountID, desired, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, WARPProfileDiff{Settings: true, Exclude: true}, diff)
+	}
+	assert.Equal(t, []string{"settings", "exclude"}, updated)
+
+	diff, err = client.ApplyWARPProfile(context.Background(), testAccountID, desired, false)
+	if assert.NoError(t, err) {
+		assert.True(t, diff.Empty())
+	}
+	assert.Len(t, updated, 2)
+
+	desired.Include = []SplitTunnel{{Address: "192.168.1.0/24"}}
+	_, err = client.ApplyWARPProfile(context.Background(), testAccountID, desired, false)
+	assert.EqualError(t, err, "invalid WARP profile: included 192.168.1.0/24 overlaps excluded 192.168.0.0/16")
+
+	// Sections left out of the profile keep their current values, and new
+	// entries are still checked against them.
+	diff, err = client.ApplyWARPProfile(context.Background(), testAccountID, WARPProfile{Include: []SplitTunnel{{Address: "10.0.0.0/8"}}}, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, WARPProfileDiff{Include: true}, diff)
+	}
+	assert.Equal(t, []string{"settings", "exclude", "include"}, updated)
+	assert.JSONEq(t, `{"gateway_proxy_enabled": true, "gateway_udp_proxy_enabled": false}`, state["settings"])
+
+	_, err = client.ApplyWARPProfile(context.Background(), testAccountID, WARPProfile{Include: []SplitTunnel{{Address: "192.168.1.0/24"}}}, false)
+	assert.EqualError(t, err, "invalid WARP profile: included 192.168.1.0/24 overlaps excluded 192.168.0.0/16")
+}
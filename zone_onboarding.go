@@ -0,0 +1,228 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ZoneNameServersSink receives the nameservers to configure at the
+// registrar of a newly created zone.
+type ZoneNameServersSink func(ctx context.Context, zone Zone, nameServers []string) error
+
+// ZoneOnboardingOptions configures OnboardZone.
+type ZoneOnboardingOptions struct {
+	Name string
+	// Account is passed on to CreateZone.
+	Account Account
+	// Type is "full" (the default) or "partial".
+	Type string
+	// JumpStart scans for existing DNS records when the zone is created.
+	JumpStart bool
+	// Records are created after the zone. Records already present, for
+	// instance found by JumpStart, are skipped. Names may be relative to
+	// the zone.
+	Records []DNSRecord
+	// VanityNameServers are set as the zone's custom nameservers.
+	VanityNameServers []string
+	// NameServers receives the nameservers to configure at the registrar.
+	NameServers ZoneNameServersSink
+
+	// Wait polls the zone until it is active.
+	Wait bool
+	// PollInterval is the initial delay between polls, doubled after each
+	// poll up to MaxPollInterval. Defaults to 1 minute.
+	PollInterval time.Duration
+	// MaxPollInterval defaults to 1 hour.
+	MaxPollInterval time.Duration
+	// ActivationCheckInterval is the minimum delay between activation
+	// checks triggered with ZoneActivationCheck, which is rate limited.
+	// Defaults to 1 hour.
+	ActivationCheckInterval time.Duration
+}
+
+// ZoneRecordImport is the outcome of importing one DNS record.
+type ZoneRecordImport struct {
+	Record DNSRecord
+	// Skipped is set when the record already existed.
+	Skipped bool
+	Err     error
+}
+
+// ZoneOnboardingReport describes the state of an onboarded zone.
+type ZoneOnboardingReport struct {
+	Zone Zone
+	// NameServers are the nameservers to configure at the registrar. They
+	// are empty for partial zones.
+	NameServers      []string
+	Records          []ZoneRecordImport
+	ActivationChecks int
+	Active           bool
+	// Warnings are problems which do not stop the onboarding.
+	Warnings []string
+}
+
+// FailedRecords returns the records which could not be imported.
+func (r ZoneOnboardingReport) FailedRecords() []ZoneRecordImport {
+	var failed []ZoneRecordImport
+	for _, record := range r.Records {
+		if record.Err != nil {
+			failed = append(failed, record)
+		}
+	}
+	return failed
+}
+
+// Ready reports whether the zone is active and every record was imported.
+func (r ZoneOnboardingReport) Ready() bool {
+	return r.Active && len(r.FailedRecords()) == 0
+}
+
+// OnboardZone creates a zone, imports DNS records, sets vanity nameservers
+// and hands the nameservers to configure at the registrar to
+// opts.NameServers. With opts.Wait set it then polls the zone with backoff,
+// triggering activation checks, until it is active. The report is returned
+// along with any error so the progress made is not lost.
+func (api *API) OnboardZone(ctx context.Context, opts ZoneOnboardingOptions) (ZoneOnboardingReport, error) {
+	zone, err := api.CreateZone(ctx, opts.Name, opts.JumpStart, opts.Account, opts.Type)
+	if err != nil {
+		return ZoneOnboardingReport{}, errors.Wrapf(err, "failed to create zone %s", opts.Name)
+	}
+	report := ZoneOnboardingReport{Zone: zone}
+
+	if len(opts.Records) > 0 {
+		if report.Records, err = api.importZoneRecords(ctx, zone, opts.Records); err != nil {
+			return report, err
+		}
+	}
+
+	if len(opts.VanityNameServers) > 0 {
+		if report.Zone, err = api.ZoneSetVanityNS(ctx, zone.ID, opts.VanityNameServers); err != nil {
+			return report, errors.Wrap(err, "failed to set vanity nameservers")
+		}
+	}
+
+	if report.Zone.Type != "partial" {
+		report.NameServers = report.Zone.NameServers
+		if len(report.Zone.VanityNS) > 0 {
+			report.NameServers = report.Zone.VanityNS
+		}
+	}
+	if opts.NameServers != nil {
+		if err := opts.NameServers(ctx, report.Zone, report.NameServers); err != nil {
+			return report, errors.Wrap(err, "failed to publish nameservers")
+		}
+	}
+
+	report.Active = report.Zone.Status == "active"
+	if !opts.Wait || report.Active {
+		return report, nil
+	}
+	return report, api.waitForZoneActivation(ctx, &report, opts)
+}
+
+// importZoneRecords creates the records not already in the zone.
+func (api *API) importZoneRecords(ctx context.Context, zone Zone, records []DNSRecord) ([]ZoneRecordImport, error) {
+	existing, err := api.DNSRecords(ctx, zone.ID, DNSRecord{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list DNS records")
+	}
+	present := make(map[string]bool, len(existing))
+	for _, record := range existing {
+		present[zoneRecordKey(zone.Name, record)] = true
+	}
+
+	imports := make([]ZoneRecordImport, 0, len(records))
+	for _, record := range records {
+		key := zoneRecordKey(zone.Name, record)
+		if present[key] {
+			imports = append(imports, ZoneRecordImport{Record: record, Skipped: true})
+			continue
+		}
+		res, err := api.CreateDNSRecord(ctx, zone.ID, record)
+		if err != nil {
+			imports = append(imports, ZoneRecordImport{Record: record, Err: err})
+			continue
+		}
+		present[key] = true
+		imports = append(imports, ZoneRecordImport{Record: res.Result})
+	}
+	return imports, nil
+}
+
+// zoneRecordKey identifies a record by type, name and content. Names are
+// qualified with the zone name, as the API accepts relative names such as
+// "www" or "@" but lists records by their full name.
+func zoneRecordKey(zoneName string, record DNSRecord) string {
+	zoneName = strings.ToLower(strings.TrimSuffix(zoneName, "."))
+	name := strings.ToLower(record.Name)
+	switch {
+	case name == "" || name == "@":
+		name = zoneName
+	case strings.HasSuffix(name, "."):
+		name = strings.TrimSuffix(name, ".")
+	case name != zoneName && !strings.HasSuffix(name, "."+zoneName):
+		name += "." + zoneName
+	}
+	return fmt.Sprintf("%s %s %s", strings.ToUpper(record.Type), name, record.Content)
+}
+
+// waitForZoneActivation polls the zone until it is active, triggering an
+// activation check at most every opts.ActivationCheckInterval. Failed polls
+// are reported as warnings and retried, as the wait can last hours.
+func (api *API) waitForZoneActivation(ctx context.Context, report *ZoneOnboardingReport, opts ZoneOnboardingOptions) error {
+	interval, maxInterval, checkInterval := opts.PollInterval, opts.MaxPollInterval, opts.ActivationCheckInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if maxInterval <= 0 {
+		maxInterval = time.Hour
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	if checkInterval <= 0 {
+		checkInterval = time.Hour
+	}
+
+	var lastCheck time.Time
+	for {
+		if time.Since(lastCheck) >= checkInterval {
+			lastCheck = time.Now()
+			if _, err := api.ZoneActivationCheck(ctx, report.Zone.ID); err != nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("activation check failed: %s", err))
+			} else {
+				report.ActivationChecks++
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "zone %s is still %s", report.Zone.Name, report.Zone.Status)
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+
+		zone, err := api.ZoneDetails(ctx, report.Zone.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.Wrapf(ctx.Err(), "zone %s is still %s", report.Zone.Name, report.Zone.Status)
+			}
+			report.Warnings = append(report.Warnings, fmt.Sprintf("failed to get zone status: %s", err))
+			continue
+		}
+		report.Zone = zone
+		switch zone.Status {
+		case "active":
+			report.Active = true
+			return nil
+		case "moved", "deleted", "deactivated":
+			return errors.Errorf("zone %s is %s", zone.Name, zone.Status)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// handleZoneCreation serves the creation of example.com as a pending zone.
+func handleZoneCreation(t *testing.T) {
+	mux.HandleFunc("/zones", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expected method 'POST', got %s", r.Method)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name": "example.com", "jump_start": true, "type": "full"}`, string(body))
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": `+testZoneJSON("pending")+`}`)
+	})
+}
+
+// handleZoneRecords serves the records of example.com found by JumpStart
+// and the creation of records, refusing MX records.
+func handleZoneRecords(t *testing.T, existing string) *[]DNSRecord {
+	var created []DNSRecord
+	mux.HandleFunc("/zones/"+testZoneID+"/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprintf(w, `{
+        "success": true,
+        "errors": [],
+        "messages": [],
+        "result": %s,
+        "result_info": {"page": 1, "per_page": 100, "count": 1, "total_count": 1, "total_pages": 1}
+      }`, existing)
+		case http.MethodPost:
+			var rr DNSRecord
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&rr))
+			if rr.Type == "MX" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"success": false, "errors": [{"code": 9000, "message": "invalid record"}], "messages": [], "result": null}`)
+				return
+			}
+			created = append(created, rr)
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "record-%d", "type": %q, "name": %q, "content": %q}}`,
+				len(created), rr.Type, rr.Name, rr.Content)
+		default:
+			t.Errorf("Expected method 'GET' or 'POST', got %s", r.Method)
+		}
+	})
+	return &created
+}
+
+func testZoneJSON(status string) string {
+	return fmt.Sprintf(`{
+      "id": %q,
+      "name": "example.com",
+      "status": %q,
+      "name_servers": ["ada.ns.cloudflare.com", "bob.ns.cloudflare.com"]
+    }`, testZoneID, status)
+}
+
+func TestOnboardZone(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleZoneCreation(t)
+	created := handleZoneRecords(t, `[{"id": "jumpstart", "type": "A", "name": "www.example.com", "content": "192.0.2.1"}]`)
+
+	polls := 0
+	mux.HandleFunc("/zones/"+testZoneID, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		polls++
+		status := "pending"
+		if polls == 3 {
+			status = "active"
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": `+testZoneJSON(status)+`}`)
+	})
+
+	activationChecks := 0
+	mux.HandleFunc("/zones/"+testZoneID+"/activation_check", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		activationChecks++
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": %q}}`, testZoneID)
+	})
+
+	var published []string
+	report, err := client.OnboardZone(context.Background(), ZoneOnboardingOptions{
+		Name:      "example.com",
+		JumpStart: true,
+		Records: []DNSRecord{
+			{Type: "a", Name: "WWW.example.com.", Content: "192.0.2.1"},
+			{Type: "CNAME", Name: "blog.example.com", Content: "blog.example.net"},
+			{Type: "MX", Name: "example.com", Content: "mail.example.com"},
+		},
+		NameServers: func(ctx context.Context, zone Zone, nameServers []string) error {
+			published = nameServers
+			return nil
+		},
+		Wait:                    true,
+		PollInterval:            time.Millisecond,
+		ActivationCheckInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	assert.True(t, report.Active)
+	assert.False(t, report.Ready())
+	assert.Equal(t, []string{"ada.ns.cloudflare.com", "bob.ns.cloudflare.com"}, published)
+	assert.Equal(t, published, report.NameServers)
+	assert.Equal(t, 1, report.ActivationChecks)
+	assert.Equal(t, 1, activationChecks)
+	assert.Equal(t, 3, polls)
+
+	require.Len(t, report.Records, 3)
+	assert.True(t, report.Records[0].Skipped)
+	assert.Equal(t, "record-1", report.Records[1].Record.ID)
+	failed := report.FailedRecords()
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "MX", failed[0].Record.Type)
+		assert.EqualError(t, failed[0].Err, "HTTP status 400: invalid record (9000)")
+	}
+	assert.Equal(t, []DNSRecord{{Type: "CNAME", Name: "blog.example.com", Content: "blog.example.net"}}, *created)
+}
+
+func TestOnboardZone_PollFails(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleZoneCreation(t)
+
+	// The second poll fails, which must not end the wait.
+	polls := 0
+	mux.HandleFunc("/zones/"+testZoneID, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expected method 'GET', got %s", r.Method)
+		polls++
+		w.Header().Set("content-type", "application/json")
+		status := "pending"
+		switch polls {
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success": false, "errors": [{"code": 1000, "message": "temporary failure"}], "messages": [], "result": null}`)
+			return
+		case 3:
+			status = "active"
+		}
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": `+testZoneJSON(status)+`}`)
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/activation_check", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": %q}}`, testZoneID)
+	})
+
+	report, err := client.OnboardZone(context.Background(), ZoneOnboardingOptions{
+		Name:                    "example.com",
+		JumpStart:               true,
+		Wait:                    true,
+		PollInterval:            time.Millisecond,
+		ActivationCheckInterval: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.True(t, report.Active)
+	assert.Equal(t, []string{"failed to get zone status: HTTP status 400: temporary failure (1000)"}, report.Warnings)
+	assert.Equal(t, 3, polls)
+}
+
+func TestOnboardZone_RelativeRecordNames(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleZoneCreation(t)
+	created := handleZoneRecords(t, `[
+      {"id": "jumpstart-1", "type": "A", "name": "www.example.com", "content": "192.0.2.1"},
+      {"id": "jumpstart-2", "type": "TXT", "name": "example.com", "content": "v=spf1 -all"}
+    ]`)
+
+	report, err := client.OnboardZone(context.Background(), ZoneOnboardingOptions{
+		Name:      "example.com",
+		JumpStart: true,
+		Records: []DNSRecord{
+			{Type: "A", Name: "www", Content: "192.0.2.1"},
+			{Type: "TXT", Name: "@", Content: "v=spf1 -all"},
+			{Type: "CNAME", Name: "blog", Content: "blog.example.net"},
+			{Type: "CNAME", Name: "blog.example.com", Content: "blog.example.net"},
+			{Type: "CNAME", Name: "example.net.", Content: "blog.example.net"},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, report.Records, 5)
+	assert.True(t, report.Records[0].Skipped)
+	assert.True(t, report.Records[1].Skipped)
+	assert.Equal(t, "record-1", report.Records[2].Record.ID)
+	assert.True(t, report.Records[3].Skipped)
+	assert.Equal(t, "record-2", report.Records[4].Record.ID)
+	assert.Equal(t, []DNSRecord{
+		{Type: "CNAME", Name: "blog", Content: "blog.example.net"},
+		{Type: "CNAME", Name: "example.net.", Content: "blog.example.net"},
+	}, *created)
+}
+
+func TestOnboardZone_VanityNameServers(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleZoneCreation(t)
+
+	// The zone stays pending, so the onboarding is cancelled after a few
+	// polls.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	polls := 0
+	mux.HandleFunc("/zones/"+testZoneID, func(w http.ResponseWriter, r *http.Request) {
+		result := testZoneJSON("pending")
+		switch r.Method {
+		case http.MethodPatch:
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"vanity_name_servers": ["ns1.example.com", "ns2.example.com"]}`, string(body))
+			result = fmt.Sprintf(`{
+        "id": %q,
+        "name": "example.com",
+        "status": "pending",
+        "name_servers": ["ada.ns.cloudflare.com", "bob.ns.cloudflare.com"],
+        "vanity_name_servers": ["ns1.example.com", "ns2.example.com"]
+      }`, testZoneID)
+		case http.MethodGet:
+			if polls++; polls == 3 {
+				cancel()
+			}
+		default:
+			t.Errorf("Expected method 'PATCH' or 'GET', got %s", r.Method)
+		}
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprint(w, `{"success": true, "errors": [], "messages": [], "result": `+result+`}`)
+	})
+	mux.HandleFunc("/zones/"+testZoneID+"/activation_check", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method, "Expected method 'PUT', got %s", r.Method)
+		w.Header().Set("content-type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": %q}}`, testZoneID)
+	})
+
+	report, err := client.OnboardZone(ctx, ZoneOnboardingOptions{
+		Name:                    "example.com",
+		JumpStart:               true,
+		VanityNameServers:       []string{"ns1.example.com", "ns2.example.com"},
+		Wait:                    true,
+		PollInterval:            time.Millisecond,
+		MaxPollInterval:         5 * time.Millisecond,
+		ActivationCheckInterval: time.Hour,
+	})
+	assert.EqualError(t, err, "zone example.com is still pending: context canceled")
+	assert.False(t, report.Active)
+	assert.Equal(t, []string{"ns1.example.com", "ns2.example.com"}, report.NameServers)
+	assert.Empty(t, report.Records)
+	assert.Equal(t, 3, polls)
+}